@@ -31,6 +31,10 @@ type JsonextAST struct {
 	ast      JsonNode
 	astTrace *util.Stack[JsonNode]
 	state    astState
+	// policy for the literal keys, the keys with variables or conditions are left to the interpreters
+	duplicateKeys DuplicateKeyPolicy
+	// literal key to its index in the open objects, only kept when there's a policy
+	keyIndex map[*JsonObjectNode]map[string]int
 }
 
 func NewJsonextAST() *JsonextAST {
@@ -41,6 +45,13 @@ func NewJsonextAST() *JsonextAST {
 	}
 }
 
+func (i *JsonextAST) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) {
+	i.duplicateKeys = policy
+	if policy != DUPLICATE_KEY_ALLOW {
+		i.keyIndex = make(map[*JsonObjectNode]map[string]int)
+	}
+}
+
 func (i *JsonextAST) GetAST() JsonNode {
 	return i.ast
 }
@@ -105,6 +116,7 @@ func (i *JsonextAST) createNewNodeForArrayObject(owner *JsonArrayNode, t AST_NOD
 }
 
 func (i *JsonextAST) createNewNodeForObject(owner *JsonObjectNode, t AST_NODETYPE, value interface{}) (JsonNode, error) {
+	t, value, condition := extractKeyCondition(t, value)
 	keyNode, err := NodeFactory(t, value)
 	if err != nil {
 		return nil, err
@@ -113,6 +125,9 @@ func (i *JsonextAST) createNewNodeForObject(owner *JsonObjectNode, t AST_NODETYP
 	if err != nil {
 		return nil, err
 	}
+	if condition != nil {
+		kvNode.AddCondition(*condition)
+	}
 	i.astTrace.Push(kvNode)
 	return kvNode, nil
 }
@@ -155,8 +170,39 @@ func (i *JsonextAST) finlizeKVPair() error {
 		return ErrorASTUnexpectedElement
 	}
 	el := kvOwnerObj.(*JsonObjectNode)
-	el.Append(kvElement.(*JsonKeyValuePairNode))
+	return i.appendMember(el, kvElement.(*JsonKeyValuePairNode))
+}
 
+func (i *JsonextAST) appendMember(owner *JsonObjectNode, kv *JsonKeyValuePairNode) error {
+	if i.duplicateKeys == DUPLICATE_KEY_ALLOW || kv.Key.GetNodeType() != AST_STRING || len(kv.GetConditions()) > 0 {
+		owner.Append(kv)
+		return nil
+	}
+	if _, isSpread := kv.SpreadVariable(); isSpread {
+		owner.Append(kv)
+		return nil
+	}
+	key, err := kv.Key.GetValue()
+	if err != nil {
+		return err
+	}
+	keys, ok := i.keyIndex[owner]
+	if !ok {
+		keys = make(map[string]int)
+		i.keyIndex[owner] = keys
+	}
+	index, ok := keys[key]
+	if !ok {
+		keys[key] = len(owner.Value)
+		owner.Append(kv)
+		return nil
+	}
+	switch i.duplicateKeys {
+	case DUPLICATE_KEY_ERROR:
+		return NewDuplicateKeyError(key, owner.Value[index], kv)
+	case DUPLICATE_KEY_LAST_WINS:
+		owner.Value[index] = kv
+	}
 	return nil
 }
 
@@ -179,10 +225,31 @@ func (i *JsonextAST) TopElementType() (AST_NODETYPE, error) {
 	return t.GetNodeType(), nil
 }
 
+// the open array or object on top of the stack
+func (i *JsonextAST) TopElement() (JsonNode, error) {
+	return i.astTrace.Peek()
+}
+
 func (i *JsonextAST) storeFinlizedItemToOwner(itemToFinalize JsonNode) (JsonNode, error) {
 	nodeType := itemToFinalize.GetNodeType()
 	switch nodeType {
 	case AST_OBJECT: // item can only be value of kv or element of array
+		object := itemToFinalize.(*JsonObjectNode)
+		if i.keyIndex != nil {
+			delete(i.keyIndex, object)
+		}
+		trivia := TriviaOf(object)
+		if trivia != nil {
+			trivia.Members = append([]*JsonKeyValuePairNode(nil), object.Value...)
+		}
+		err := extractObjectLoop(object)
+		if err != nil {
+			return nil, err
+		}
+		itemToFinalize = extractObjectCondition(object)
+		if valueTrivia := TriviaOf(itemToFinalize); trivia != nil && valueTrivia != nil && itemToFinalize != JsonNode(object) {
+			valueTrivia.Owner = object
+		}
 		fallthrough
 	case AST_ARRAY:
 		ownerElement, err := i.astTrace.Peek()
@@ -218,3 +285,97 @@ func (i *JsonextAST) HasOpenElement() bool {
 func (i *JsonextAST) HasComplete() bool {
 	return i.state == AST_STATE_FINISHED
 }
+
+// `"${?name}key"`: strip the condition prefix from the key, the rest of the key is still a normal key
+func extractKeyCondition(t AST_NODETYPE, value interface{}) (AST_NODETYPE, interface{}, *Condition) {
+	if t != AST_STRING && t != AST_STRING_VARIABLE {
+		return t, value, nil
+	}
+	key, ok := value.([]byte)
+	if !ok || len(key) < 2 {
+		return t, value, nil
+	}
+	content := key[1 : len(key)-1]
+	rs := util.RegConditionPrefix.FindSubmatch(content)
+	if rs == nil {
+		return t, value, nil
+	}
+	rest := content[len(rs[0]):]
+	newKey := make([]byte, 0, len(rest)+2)
+	newKey = append(newKey, '"')
+	newKey = append(newKey, rest...)
+	newKey = append(newKey, '"')
+	t = AST_STRING
+	if util.RegStringWithVariable.Match(rest) {
+		t = AST_STRING_VARIABLE
+	}
+	return t, newKey, &Condition{Variable: string(rs[2]), Negate: len(rs[1]) > 0}
+}
+
+// `{"$if": ${name}, ...}`: the `$if`/`$unless` members become conditions of the object,
+// an object left with only a `$value` member is replaced by the value.
+func extractObjectCondition(node *JsonObjectNode) JsonNode {
+	conditions := make([]Condition, 0)
+	members := make([]*JsonKeyValuePairNode, 0, len(node.Value))
+	for _, kv := range node.Value {
+		key, err := kv.Key.GetValue()
+		variableNode, isVariable := kv.Value.(*JsonExtendedVariableNode)
+		if err != nil || !isVariable || variableNode.Spread || (key != IF_KEY && key != UNLESS_KEY) {
+			members = append(members, kv)
+			continue
+		}
+		conditions = append(conditions, Condition{Variable: variableNode.Variable, Negate: key == UNLESS_KEY})
+	}
+	if len(conditions) == 0 {
+		return node
+	}
+	var result JsonNode = node
+	node.Value = members
+	if len(members) == 1 {
+		if key, err := members[0].Key.GetValue(); err == nil && key == VALUE_KEY {
+			result = members[0].Value
+		}
+	}
+	for _, c := range conditions {
+		result.AddCondition(c)
+	}
+	return result
+}
+
+// `{"$for": "item in ${items}", "$do": body}`: the `$for` and `$do` members become the loop of the object
+func extractObjectLoop(node *JsonObjectNode) error {
+	var clause, body JsonNode
+	members := make([]*JsonKeyValuePairNode, 0, len(node.Value))
+	for _, kv := range node.Value {
+		key, err := kv.Key.GetValue()
+		switch {
+		case err == nil && key == FOR_KEY:
+			clause = kv.Value
+		case err == nil && key == DO_KEY:
+			body = kv.Value
+		default:
+			members = append(members, kv)
+		}
+	}
+	if clause == nil {
+		return nil
+	}
+	if body == nil {
+		return ErrorASTLoopWithoutBody
+	}
+	stringNode, ok := clause.(JsonStringValueNode)
+	if !ok {
+		return ErrorASTLoopClauseFormat
+	}
+	value, err := stringNode.GetValue()
+	if err != nil {
+		return err
+	}
+	rs := util.RegLoopClause.FindStringSubmatch(value)
+	if rs == nil {
+		return ErrorASTLoopClauseFormat
+	}
+	node.Value = members
+	node.Loop = &Loop{Item: rs[1], Source: rs[2], Body: body}
+	return nil
+}
@@ -3,6 +3,7 @@ package ast
 import (
 	"encoding/base64"
 	"fmt"
+	"maps"
 	"strconv"
 
 	"github.com/jaksonlin/go-jsonextend/util"
@@ -62,10 +63,26 @@ func NodeFactory(t AST_NODETYPE, value interface{}) (JsonNode, error) {
 	}
 }
 
+// the node is only rendered when the variable is truthy, or falsy when Negate is set
+type Condition struct {
+	Variable string
+	Negate   bool
+}
+
 type astNodeBase struct {
 	visited     bool
 	nodePlugins nodePlugins
 	meta        map[string]interface{}
+	conditions  []Condition
+}
+
+// all the conditions must hold for the node to be rendered
+func (node *astNodeBase) AddCondition(c Condition) {
+	node.conditions = append(node.conditions, c)
+}
+
+func (node *astNodeBase) GetConditions() []Condition {
+	return node.conditions
 }
 
 func (node *astNodeBase) PrependPlugin(p ASTNodePlugin) {
@@ -76,6 +93,10 @@ func (node *astNodeBase) AddPlugin(p ASTNodePlugin) {
 	node.nodePlugins.RegisterPlugin(p)
 }
 
+func (node *astNodeBase) GetPlugins() []ASTNodePlugin {
+	return node.nodePlugins.plugins
+}
+
 func (node *astNodeBase) RemovePlugin(name string) {
 	node.nodePlugins.RemovePlugin(name)
 }
@@ -98,6 +119,11 @@ func (node *astNodeBase) GetMeta(key string) interface{} {
 	return val
 }
 
+// a copy of all the meta of the node, nil when there is none
+func (node *astNodeBase) GetMetas() map[string]interface{} {
+	return maps.Clone(node.meta)
+}
+
 func (node *astNodeBase) SetVisited() {
 	node.visited = true
 }
@@ -385,13 +411,45 @@ func (node *JsonKeyValuePairNode) IsFilled() bool {
 	return node.Value != nil
 }
 
+// the map variable whose entries are spliced into the owner object, the member is written either as
+// `"...": ${name}` or as `"${...name}": null` (the value of the latter is ignored)
+func (node *JsonKeyValuePairNode) SpreadVariable() (string, bool) {
+	if node.Key == nil || node.Value == nil || node.Key.GetNodeType() != AST_STRING {
+		return "", false
+	}
+	key, err := node.Key.GetValue()
+	if err != nil {
+		return "", false
+	}
+	if key == SPREAD_KEY {
+		if variableNode, ok := node.Value.(*JsonExtendedVariableNode); ok {
+			return variableNode.Variable, true
+		}
+		return "", false
+	}
+	if rs := util.RegSpreadVariable.FindStringSubmatch(key); rs != nil {
+		return rs[1], true
+	}
+	return "", false
+}
+
 func (node *JsonKeyValuePairNode) String() string {
 	return fmt.Sprintf("key value pair node, key: [%s], value: [%s]\n", node.Key.String(), node.Value.String())
 }
 
+// `{"$for": "item in ${items}", "$do": body}`, the body is rendered once for each element of items
+// with the element bound to the item variable.
+type Loop struct {
+	Item   string
+	Source string
+	Body   JsonNode
+}
+
 type JsonObjectNode struct {
 	astNodeBase
 	Value []*JsonKeyValuePairNode
+	// not nil when the object is a `$for` loop, the loop takes the place of the object when rendering
+	Loop *Loop
 }
 
 var _ JsonCollectionNode = &JsonObjectNode{}
@@ -460,6 +518,10 @@ type JsonExtendedVariableNode struct {
 	astNodeBase
 	Value    []byte
 	Variable string
+	// `${...name}`, the entries of the variable are spliced into the enclosing object/array
+	Spread bool
+	// `${include:path}`, the path of the document that takes the place of the node
+	Include string
 }
 
 var _ JsonNode = &JsonExtendedVariableNode{}
@@ -487,6 +549,16 @@ func (node *JsonExtendedVariableNode) Visit(visitor JsonVisitor) error {
 }
 
 func (node *JsonExtendedVariableNode) extractVariable() {
+	if rs := util.RegIncludeVariable.FindSubmatch(node.Value); rs != nil {
+		node.Variable = string(node.Value[2 : len(node.Value)-1])
+		node.Include = string(rs[1])
+		return
+	}
+	if rs := util.RegSpreadVariable.FindSubmatch(node.Value); rs != nil {
+		node.Variable = string(rs[1])
+		node.Spread = true
+		return
+	}
 	rs := util.RegStringWithVariable.FindSubmatch(node.Value)
 	node.Variable = string(rs[1])
 }
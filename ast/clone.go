@@ -0,0 +1,149 @@
+package ast
+
+import (
+	"maps"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+type cloneOptions struct {
+	skipMeta    bool
+	skipPlugins bool
+}
+
+type CloneOption func(*cloneOptions)
+
+// the copy has no meta, e.g. the positions and the trivia of the nodes read from a document
+func CloneWithoutMeta() CloneOption {
+	return func(o *cloneOptions) {
+		o.skipMeta = true
+	}
+}
+
+// the copy has no plugins
+func CloneWithoutPlugins() CloneOption {
+	return func(o *cloneOptions) {
+		o.skipPlugins = true
+	}
+}
+
+func (node *astNodeBase) clone(options *cloneOptions) astNodeBase {
+	rs := astNodeBase{
+		conditions: append([]Condition(nil), node.conditions...),
+	}
+	if !options.skipMeta {
+		rs.meta = maps.Clone(node.meta)
+	}
+	if !options.skipPlugins {
+		rs.nodePlugins.plugins = append([]ASTNodePlugin(nil), node.nodePlugins.plugins...)
+	}
+	return rs
+}
+
+// copy of the node alone, the children are shared with the original
+func cloneNode(node JsonNode, options *cloneOptions) JsonNode {
+	switch n := node.(type) {
+	case *JsonStringNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonNumberNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonBooleanNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonNullNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonExtendedVariableNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonExtendedStringWIthVariableNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonArrayNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	case *JsonObjectNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		if n.Loop != nil {
+			loop := *n.Loop
+			rs.Loop = &loop
+		}
+		return &rs
+	case *JsonKeyValuePairNode:
+		rs := *n
+		rs.astNodeBase = n.astNodeBase.clone(options)
+		return &rs
+	default:
+		return node
+	}
+}
+
+// deep copy of the node, the copy is not visited. conditions are copied along, and so are meta and plugins
+// unless excluded with CloneWithoutMeta and CloneWithoutPlugins. the trivia of the copy refers to the copy.
+func Clone(node JsonNode, opts ...CloneOption) JsonNode {
+	type clonePair struct {
+		source JsonNode
+		target JsonNode
+	}
+	options := &cloneOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	cloned := make(map[JsonNode]JsonNode)
+	root := cloneNode(node, options)
+	s := util.NewStack[clonePair]()
+	s.Push(clonePair{node, root})
+	for {
+		item, err := s.Pop()
+		if err != nil {
+			break
+		}
+		cloned[item.source] = item.target
+		switch source := item.source.(type) {
+		case *JsonArrayNode:
+			target := item.target.(*JsonArrayNode)
+			target.Value = make([]JsonNode, len(source.Value))
+			for i, element := range source.Value {
+				target.Value[i] = cloneNode(element, options)
+				s.Push(clonePair{element, target.Value[i]})
+			}
+		case *JsonObjectNode:
+			target := item.target.(*JsonObjectNode)
+			target.Value = make([]*JsonKeyValuePairNode, len(source.Value))
+			for i, kv := range source.Value {
+				target.Value[i] = cloneNode(kv, options).(*JsonKeyValuePairNode)
+				s.Push(clonePair{kv, target.Value[i]})
+			}
+			if source.Loop != nil {
+				target.Loop.Body = cloneNode(source.Loop.Body, options)
+				s.Push(clonePair{source.Loop.Body, target.Loop.Body})
+			}
+		case *JsonKeyValuePairNode:
+			target := item.target.(*JsonKeyValuePairNode)
+			target.Key = cloneNode(source.Key, options).(JsonStringValueNode)
+			s.Push(clonePair{source.Key, target.Key})
+			if source.Value != nil {
+				target.Value = cloneNode(source.Value, options)
+				s.Push(clonePair{source.Value, target.Value})
+			}
+		}
+	}
+	if !options.skipMeta {
+		for _, target := range cloned {
+			if trivia := TriviaOf(target); trivia != nil {
+				target.SetMeta(TRIVIA_META, trivia.clone(cloned, options))
+			}
+		}
+	}
+	return root
+}
@@ -19,3 +19,51 @@ const (
 	AST_NULL               AST_NODETYPE = 209
 	AST_NODE_UNDEFINED     AST_NODETYPE = 210
 )
+
+// object member key that marks a spread of a map variable: `{"...": ${labels}}`, see also `{"${...labels}": null}`
+const SPREAD_KEY = "..."
+
+// object members that make the owner object conditional: `{"$if": ${enableTLS}, ...}`,
+// with `$value` as the only other member, the value of `$value` takes the place of the object.
+const (
+	IF_KEY     = "$if"
+	UNLESS_KEY = "$unless"
+	VALUE_KEY  = "$value"
+)
+
+// `{"$for": "item in ${items}", "$do": {...}}` repeats the `$do` value for each element of items
+const (
+	FOR_KEY = "$for"
+	DO_KEY  = "$do"
+)
+
+// what to do when an object has the same key more than once
+type DuplicateKeyPolicy uint
+
+const (
+	// keep all of them, the interpreters write all of them and the unmarshaller keeps the last
+	DUPLICATE_KEY_ALLOW DuplicateKeyPolicy = iota
+	DUPLICATE_KEY_ERROR
+	DUPLICATE_KEY_FIRST_WINS
+	// the last value takes the position of the first key
+	DUPLICATE_KEY_LAST_WINS
+)
+
+// meta of the kv pair, the token.Position of its key, set by the builders that read a document.
+// with the positions option of the builder the values hold the token.Position where they start too
+const POSITION_META = "position"
+
+// meta of the nodes from Merge, the name of the source the node is taken from
+const SOURCE_META = "source"
+
+// how Merge puts the array of a later source together with the array of an earlier one
+type ArrayMergeStrategy uint
+
+const (
+	// the later array takes the place of the earlier one
+	ARRAY_MERGE_REPLACE ArrayMergeStrategy = iota
+	// the elements of the later array are appended to the earlier one
+	ARRAY_MERGE_APPEND
+	// the objects with the same value of the key member are merged, the other elements are appended
+	ARRAY_MERGE_BY_KEY
+)
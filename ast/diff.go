@@ -0,0 +1,333 @@
+package ast
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+type ChangeType byte
+
+const (
+	CHANGE_ADD ChangeType = iota
+	CHANGE_REMOVE
+	CHANGE_REPLACE
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case CHANGE_ADD:
+		return "add"
+	case CHANGE_REMOVE:
+		return "remove"
+	case CHANGE_REPLACE:
+		return "replace"
+	default:
+		return "unknown"
+	}
+}
+
+// a difference between two templates
+type Change struct {
+	Type ChangeType
+	// the JSON Pointer (RFC 6901) of the node, `/$do` for the body of a `$for` object. the changes are in the order
+	// of RFC 6902 JSON Patch: the array indexes are the ones after the changes before are applied.
+	Path string
+	// the node in the old template, nil for CHANGE_ADD
+	From JsonNode
+	// the node in the new template, nil for CHANGE_REMOVE
+	To JsonNode
+}
+
+type diffItem struct {
+	path string
+	a    JsonNode
+	b    JsonNode
+	// the changes of the item are ready, e.g. the removed members
+	changes []Change
+}
+
+// compare a and b, a is nil when b is added and b is nil when a is removed
+func newDiffItem(path string, a JsonNode, b JsonNode) *diffItem {
+	switch {
+	case b == nil:
+		return &diffItem{changes: []Change{{Type: CHANGE_REMOVE, Path: path, From: a}}}
+	case a == nil:
+		return &diffItem{changes: []Change{{Type: CHANGE_ADD, Path: path, To: b}}}
+	default:
+		return &diffItem{path: path, a: a, b: b}
+	}
+}
+
+// arrays longer than this, after the same elements at both ends are taken out, are compared by index
+const diffArrayLimit = 4096
+
+// the changes that turn the template a into b. variables are compared as they are written, `${a}` and `${b}`
+// are different values and a variable replaced by a value is a change. the nodes with different conditions,
+// or objects with a different `$for`, are replaced as a whole. the members with the same key are compared by
+// the last one, the same as Get. to review rendered documents, parse the documents rendered with the same
+// variables and diff them.
+func Diff(a JsonNode, b JsonNode) []Change {
+	rs := make([]Change, 0)
+	s := util.NewStack[*diffItem]()
+	s.Push(&diffItem{a: a, b: b})
+	for !s.IsEmpty() {
+		item, _ := s.Pop()
+		if item.changes != nil {
+			rs = append(rs, item.changes...)
+			continue
+		}
+		if Equal(item.a, item.b) {
+			continue
+		}
+		if !diffable(item.a, item.b) {
+			rs = append(rs, Change{Type: CHANGE_REPLACE, Path: item.path, From: item.a, To: item.b})
+			continue
+		}
+		// the children are pushed in reverse, so that the changes come out in document order
+		next := make([]*diffItem, 0)
+		switch from := item.a.(type) {
+		case *JsonObjectNode:
+			to := item.b.(*JsonObjectNode)
+			members, added := memberKeys(from), memberKeys(to)
+			removed := make([]Change, 0)
+			for _, key := range members.order {
+				path := item.path + "/" + escapePointer(key)
+				kv, ok := added.members[key]
+				switch {
+				case !ok:
+					removed = append(removed, Change{Type: CHANGE_REMOVE, Path: path, From: members.members[key].Value})
+				case !slices.Equal(members.members[key].GetConditions(), kv.GetConditions()):
+					next = append(next, &diffItem{changes: []Change{{Type: CHANGE_REPLACE, Path: path, From: members.members[key].Value, To: kv.Value}}})
+				default:
+					next = append(next, newDiffItem(path, members.members[key].Value, kv.Value))
+				}
+			}
+			if len(removed) > 0 {
+				next = append(next, &diffItem{changes: removed})
+			}
+			for _, key := range added.order {
+				if _, ok := members.members[key]; !ok {
+					next = append(next, newDiffItem(item.path+"/"+escapePointer(key), nil, added.members[key].Value))
+				}
+			}
+			if from.Loop != nil {
+				next = append(next, &diffItem{path: item.path + "/" + DO_KEY, a: from.Loop.Body, b: to.Loop.Body})
+			}
+		case *JsonArrayNode:
+			next = diffArray(item.path, from.Value, item.b.(*JsonArrayNode).Value)
+		}
+		for i := len(next) - 1; i >= 0; i-- {
+			s.Push(next[i])
+		}
+	}
+	return rs
+}
+
+// the two nodes are compared member by member, or element by element
+func diffable(a JsonNode, b JsonNode) bool {
+	if a == nil || b == nil || a.GetNodeType() != b.GetNodeType() || !slices.Equal(a.GetConditions(), b.GetConditions()) {
+		return false
+	}
+	switch from := a.(type) {
+	case *JsonObjectNode:
+		to := b.(*JsonObjectNode)
+		if (from.Loop == nil) != (to.Loop == nil) {
+			return false
+		}
+		return from.Loop == nil || (from.Loop.Item == to.Loop.Item && from.Loop.Source == to.Loop.Source)
+	case *JsonArrayNode:
+		return true
+	}
+	return false
+}
+
+type keyedMembers struct {
+	order   []string
+	members map[string]*JsonKeyValuePairNode
+}
+
+// the members by key, the last one wins
+func memberKeys(node *JsonObjectNode) keyedMembers {
+	rs := keyedMembers{members: make(map[string]*JsonKeyValuePairNode, len(node.Value))}
+	for _, kv := range node.Value {
+		if kv.Key == nil || kv.Value == nil {
+			continue
+		}
+		key := keyOf(kv)
+		if _, ok := rs.members[key]; !ok {
+			rs.order = append(rs.order, key)
+		}
+		rs.members[key] = kv
+	}
+	return rs
+}
+
+// the array changes from the longest common subsequence of the elements, the indexes in the paths are the ones
+// after the changes before are applied. a removed element followed by an added one is compared in place.
+func diffArray(path string, a []JsonNode, b []JsonNode) []*diffItem {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && Equal(a[prefix], b[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && Equal(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// the operations: 0 keeps a[i] as b[j], 1 removes a[i], 2 adds b[j]
+	ops := make([]byte, 0, len(a)+len(b))
+	if len(a)*len(b) > diffArrayLimit*diffArrayLimit {
+		for i := 0; i < len(a) || i < len(b); i++ {
+			switch {
+			case i >= len(a):
+				ops = append(ops, 2)
+			case i >= len(b):
+				ops = append(ops, 1)
+			default:
+				ops = append(ops, 1, 2)
+			}
+		}
+	} else {
+		ops = lcsOps(a, b)
+	}
+
+	rs := make([]*diffItem, 0)
+	index, i, j := prefix, 0, 0
+	for k := 0; k < len(ops); k++ {
+		elementPath := path + "/" + strconv.Itoa(index)
+		switch {
+		case ops[k] == 0:
+			i++
+			j++
+			index++
+		case ops[k] == 1 && k+1 < len(ops) && ops[k+1] == 2:
+			rs = append(rs, newDiffItem(elementPath, a[i], b[j]))
+			k++
+			i++
+			j++
+			index++
+		case ops[k] == 1:
+			rs = append(rs, newDiffItem(elementPath, a[i], nil))
+			i++
+		default:
+			rs = append(rs, newDiffItem(elementPath, nil, b[j]))
+			j++
+			index++
+		}
+	}
+	return rs
+}
+
+// the operations of a longest common subsequence of a and b in linear space (Hirschberg): a is split in the middle,
+// b where the common subsequences of the two halves are the longest, until a part is empty or a has one element.
+// in a run of changes the removed elements come before the added ones, to be compared in place.
+func lcsOps(a []JsonNode, b []JsonNode) []byte {
+	hashes := func(nodes []JsonNode) []uint64 {
+		rs := make([]uint64, len(nodes))
+		for i, node := range nodes {
+			rs[i] = Hash(node)
+		}
+		return rs
+	}
+	ha, hb := hashes(a), hashes(b)
+	same := func(i int, j int) bool {
+		return ha[i] == hb[j] && Equal(a[i], b[j])
+	}
+	type part struct {
+		a0, a1, b0, b1 int
+	}
+	ops := make([]byte, 0, len(a)+len(b))
+	// forward[k] is the length of the common subsequence of the first half of a and b[b0:b0+k], backward[k] of
+	// the second half and b[b0+k:b1]
+	forward := make([]int, len(b)+1)
+	backward := make([]int, len(b)+1)
+	s := util.NewStack[part]()
+	s.Push(part{0, len(a), 0, len(b)})
+	for !s.IsEmpty() {
+		p, _ := s.Pop()
+		switch {
+		case p.a0 == p.a1:
+			for j := p.b0; j < p.b1; j++ {
+				ops = append(ops, 2)
+			}
+		case p.b0 == p.b1:
+			for i := p.a0; i < p.a1; i++ {
+				ops = append(ops, 1)
+			}
+		case p.a1-p.a0 == 1:
+			k := p.b0
+			for k < p.b1 && !same(p.a0, k) {
+				k++
+			}
+			if k == p.b1 {
+				ops = append(ops, 1)
+				k = p.b0 - 1
+			}
+			for j := p.b0; j < p.b1; j++ {
+				if j == k {
+					ops = append(ops, 0)
+				} else {
+					ops = append(ops, 2)
+				}
+			}
+		default:
+			mid, m := (p.a0+p.a1)/2, p.b1-p.b0
+			clear(forward[:m+1])
+			for i := p.a0; i < mid; i++ {
+				diagonal := 0
+				for k := 1; k <= m; k++ {
+					up := forward[k]
+					if same(i, p.b0+k-1) {
+						forward[k] = diagonal + 1
+					} else {
+						forward[k] = max(forward[k], forward[k-1])
+					}
+					diagonal = up
+				}
+			}
+			clear(backward[:m+1])
+			for i := p.a1 - 1; i >= mid; i-- {
+				diagonal := 0
+				for k := m - 1; k >= 0; k-- {
+					up := backward[k]
+					if same(i, p.b0+k) {
+						backward[k] = diagonal + 1
+					} else {
+						backward[k] = max(backward[k], backward[k+1])
+					}
+					diagonal = up
+				}
+			}
+			split := 0
+			for k := 1; k <= m; k++ {
+				if forward[k]+backward[k] > forward[split]+backward[split] {
+					split = k
+				}
+			}
+			s.Push(part{mid, p.a1, p.b0 + split, p.b1})
+			s.Push(part{p.a0, mid, p.b0, p.b0 + split})
+		}
+	}
+	// the halves can leave the added elements before the removed ones
+	for start := 0; start < len(ops); start++ {
+		if ops[start] == 0 {
+			continue
+		}
+		end := start
+		for end < len(ops) && ops[end] != 0 {
+			end++
+		}
+		slices.Sort(ops[start:end])
+		start = end
+	}
+	return ops
+}
+
+// RFC 6901: `~` is written as `~0` and `/` as `~1`
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,203 @@
+package ast
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+type equalOptions struct {
+	ignoreKeyOrder bool
+	numeric        bool
+}
+
+type EqualOption func(*equalOptions)
+
+// objects with the same members in another order are equal, the members with the same key are still compared in order
+func IgnoreKeyOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreKeyOrder = true
+	}
+}
+
+// numbers are compared by their value as float64, e.g. int 1 and float64 1 are equal, by default the go values must be the same
+func CompareNumbersNumerically() EqualOption {
+	return func(o *equalOptions) {
+		o.numeric = true
+	}
+}
+
+func newEqualOptions(opts []EqualOption) *equalOptions {
+	options := &equalOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// whether the two templates are the same: the node types, the values, the keys, the conditions and the loops.
+// strings are compared by their value, `"\u0041"` and `"A"` are equal. meta, plugins and visited flags are not compared.
+func Equal(a JsonNode, b JsonNode, opts ...EqualOption) bool {
+	options := newEqualOptions(opts)
+	type equalPair struct {
+		a JsonNode
+		b JsonNode
+	}
+	s := util.NewStack[equalPair]()
+	s.Push(equalPair{a, b})
+	for !s.IsEmpty() {
+		pair, _ := s.Pop()
+		if pair.a == nil || pair.b == nil {
+			if pair.a != pair.b {
+				return false
+			}
+			continue
+		}
+		if pair.a.GetNodeType() != pair.b.GetNodeType() || !slices.Equal(pair.a.GetConditions(), pair.b.GetConditions()) {
+			return false
+		}
+		switch a := pair.a.(type) {
+		case *JsonArrayNode:
+			b := pair.b.(*JsonArrayNode)
+			if len(a.Value) != len(b.Value) {
+				return false
+			}
+			for i := range a.Value {
+				s.Push(equalPair{a.Value[i], b.Value[i]})
+			}
+		case *JsonObjectNode:
+			b := pair.b.(*JsonObjectNode)
+			if len(a.Value) != len(b.Value) || (a.Loop == nil) != (b.Loop == nil) {
+				return false
+			}
+			if a.Loop != nil {
+				if a.Loop.Item != b.Loop.Item || a.Loop.Source != b.Loop.Source {
+					return false
+				}
+				s.Push(equalPair{a.Loop.Body, b.Loop.Body})
+			}
+			membersA, membersB := members(a, options), members(b, options)
+			for i := range membersA {
+				s.Push(equalPair{membersA[i], membersB[i]})
+			}
+		case *JsonKeyValuePairNode:
+			b := pair.b.(*JsonKeyValuePairNode)
+			if keyOf(a) != keyOf(b) || !slices.Equal(a.Key.GetConditions(), b.Key.GetConditions()) {
+				return false
+			}
+			s.Push(equalPair{a.Value, b.Value})
+		default:
+			if leafValue(pair.a, options) != leafValue(pair.b, options) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// the hash of the template, the templates that are Equal with the same options have the same hash
+func Hash(node JsonNode, opts ...EqualOption) uint64 {
+	options := newEqualOptions(opts)
+	h := fnv.New64a()
+	write := func(s string) {
+		_ = binary.Write(h, binary.LittleEndian, uint32(len(s)))
+		h.Write([]byte(s))
+	}
+	s := util.NewStack[JsonNode]()
+	s.Push(node)
+	for !s.IsEmpty() {
+		item, _ := s.Pop()
+		if item == nil {
+			write("")
+			continue
+		}
+		write(fmt.Sprint(item.GetNodeType(), item.GetConditions()))
+		switch n := item.(type) {
+		case *JsonArrayNode:
+			write(fmt.Sprint(len(n.Value)))
+			for i := len(n.Value) - 1; i >= 0; i-- {
+				s.Push(n.Value[i])
+			}
+		case *JsonObjectNode:
+			write(fmt.Sprint(len(n.Value)))
+			items := members(n, options)
+			for i := len(items) - 1; i >= 0; i-- {
+				s.Push(items[i])
+			}
+			if n.Loop != nil {
+				write(n.Loop.Item + " in " + n.Loop.Source)
+				s.Push(n.Loop.Body)
+			}
+		case *JsonKeyValuePairNode:
+			write(fmt.Sprint(keyOf(n), n.Key.GetConditions()))
+			s.Push(n.Value)
+		default:
+			write(leafValue(item, options))
+		}
+	}
+	return h.Sum64()
+}
+
+// the members of the object in the order they are compared
+func members(node *JsonObjectNode, options *equalOptions) []JsonNode {
+	rs := make([]JsonNode, len(node.Value))
+	for i, kv := range node.Value {
+		rs[i] = kv
+	}
+	if options.ignoreKeyOrder {
+		sort.SliceStable(rs, func(i, j int) bool {
+			return keyOf(rs[i].(*JsonKeyValuePairNode)) < keyOf(rs[j].(*JsonKeyValuePairNode))
+		})
+	}
+	return rs
+}
+
+func keyOf(kv *JsonKeyValuePairNode) string {
+	if kv.Key == nil {
+		return ""
+	}
+	key, err := kv.Key.GetValue()
+	if err != nil {
+		return rawSnapshot(kv.Key)
+	}
+	return key
+}
+
+// the value of a primitive node as compared by Equal
+func leafValue(node JsonNode, options *equalOptions) string {
+	switch n := node.(type) {
+	case *JsonExtendedStringWIthVariableNode:
+		value, err := n.GetValue()
+		if err != nil {
+			return string(n.Value)
+		}
+		return value
+	case *JsonStringNode:
+		value, err := n.GetValue()
+		if err != nil {
+			return string(n.Value)
+		}
+		return value
+	case *JsonNumberNode:
+		if options.numeric {
+			if value, err := util.ConvertInterfaceNumberToFloat64(n.Value); err == nil {
+				if value == 0 { // -0
+					value = 0
+				}
+				return fmt.Sprint(math.Float64bits(value))
+			}
+		}
+		return fmt.Sprintf("%T %v", n.Value, n.Value)
+	case *JsonBooleanNode:
+		return fmt.Sprint(n.Value)
+	case *JsonExtendedVariableNode:
+		return string(n.Value)
+	default:
+		return ""
+	}
+}
@@ -2,6 +2,9 @@ package ast
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/jaksonlin/go-jsonextend/token"
 )
 
 var (
@@ -13,4 +16,42 @@ var (
 	ErrorASTEncloseElementType         = errors.New("enclose element type must be array or object")
 	ErrorASTIncorrectNodeType          = errors.New("incorrect node type")
 	ErrorASTKeyValuePairNotStringAsKey = errors.New("object key should be string")
+	ErrorASTLoopClauseFormat           = errors.New("`$for` should be of \"item in ${items}\" format")
+	ErrorASTLoopWithoutBody            = errors.New("`$for` should come with a `$do` member")
+	ErrorASTDuplicateKey               = errors.New("duplicate key")
+	ErrorASTInvalidPath                = errors.New("invalid json path")
+	ErrorASTIndexOutOfRange            = errors.New("index out of range")
+	ErrorASTInvalidVariableName        = errors.New("invalid variable name")
+	ErrorASTInvalidPatch               = errors.New("invalid json patch")
+	ErrorASTPatchPathNotFound          = errors.New("json patch path not found")
+	ErrorASTPatchTestFailed            = errors.New("json patch test failed")
 )
+
+// the key appears twice in an object, the positions are zero when the node is not read from a document
+type DuplicateKeyError struct {
+	Key    string
+	First  token.Position
+	Second token.Position
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.First.Line == 0 || e.Second.Line == 0 {
+		return fmt.Sprintf("duplicate key %q", e.Key)
+	}
+	return fmt.Sprintf("duplicate key %q at %s, first defined at %s", e.Key, e.Second.String(), e.First.String())
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return ErrorASTDuplicateKey
+}
+
+func NewDuplicateKeyError(key string, first, second JsonNode) *DuplicateKeyError {
+	rs := &DuplicateKeyError{Key: key}
+	if position, ok := first.GetMeta(POSITION_META).(token.Position); ok {
+		rs.First = position
+	}
+	if position, ok := second.GetMeta(POSITION_META).(token.Position); ok {
+		rs.Second = position
+	}
+	return rs
+}
@@ -36,9 +36,13 @@ type JsonNode interface {
 	String() string
 	SetMeta(key string, value interface{})
 	GetMeta(key string) interface{}
+	GetMetas() map[string]interface{}
 	AddPlugin(p ASTNodePlugin)
 	RemovePlugin(name string)
 	PrependPlugin(p ASTNodePlugin)
+	GetPlugins() []ASTNodePlugin
+	AddCondition(c Condition)
+	GetConditions() []Condition
 }
 
 type ASTNodePluginFunc func(visitor JsonVisitor, pluginHolder JsonNode) error
@@ -0,0 +1,229 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// a template to merge, Name is recorded as the SOURCE_META of its nodes, e.g. the file name
+type MergeSource struct {
+	Name string
+	Node JsonNode
+}
+
+type arrayMerge struct {
+	// the JSON Pointer tokens of the arrays, `*` matches any token; nil for all the arrays
+	pattern  []string
+	strategy ArrayMergeStrategy
+	key      string
+}
+
+type mergeOptions struct {
+	arrays []arrayMerge
+	err    error
+}
+
+type MergeOption func(*mergeOptions)
+
+// the strategy of all the arrays, ARRAY_MERGE_REPLACE by default. key is the member that identifies the objects
+// for ARRAY_MERGE_BY_KEY, e.g. "name"
+func MergeArrays(strategy ArrayMergeStrategy, key string) MergeOption {
+	return func(o *mergeOptions) {
+		o.arrays = append(o.arrays, arrayMerge{strategy: strategy, key: key})
+	}
+}
+
+// the strategy of the arrays at the JSON Pointer, e.g. `/spec/containers`, `*` matches any key or index as in
+// `/spec/containers/*/env`. it takes precedence over MergeArrays, the last one given wins.
+func MergeArraysAt(pointer string, strategy ArrayMergeStrategy, key string) MergeOption {
+	return func(o *mergeOptions) {
+		tokens, err := parsePointer(pointer)
+		if err != nil {
+			if o.err == nil {
+				o.err = fmt.Errorf("%w: %q", err, pointer)
+			}
+			return
+		}
+		o.arrays = append(o.arrays, arrayMerge{pattern: tokens, strategy: strategy, key: key})
+	}
+}
+
+func (o *mergeOptions) arrayMergeAt(path []string) arrayMerge {
+	rs := arrayMerge{strategy: ARRAY_MERGE_REPLACE}
+	matched := false
+	for _, item := range o.arrays {
+		switch {
+		case item.pattern == nil && !matched:
+			rs = item
+		case item.pattern != nil && pointerMatch(item.pattern, path):
+			rs, matched = item, true
+		}
+	}
+	return rs
+}
+
+func pointerMatch(pattern []string, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deep merge the templates, the later sources take precedence over the earlier ones. objects are merged member by
+// member, arrays by their strategy and other values are replaced by the later one, the `${}` nodes are kept as they
+// are. the objects and arrays with conditions and the objects with `$for` are values, they are not merged, and the
+// spread members of the later objects are added after the members of the earlier ones rather than matched by key.
+// the matches of an array merged by key are applied in the order of the source, the last one wins.
+// the nodes of the result are copies, each with SOURCE_META naming the source it is taken from; a merged object
+// or array is the one from the earliest source. the result is nil when there are no sources.
+func Merge(sources []MergeSource, opts ...MergeOption) (JsonNode, error) {
+	options := &mergeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	type mergeItem struct {
+		path   []string
+		target JsonNode
+		source JsonNode
+	}
+	rs := cloneFromSource(sources[0])
+	for _, source := range sources[1:] {
+		if !mergeableCollection(rs, source.Node) {
+			rs = cloneFromSource(source)
+			continue
+		}
+		stack := util.NewStack[mergeItem]()
+		stack.Push(mergeItem{path: []string{}, target: rs, source: source.Node})
+		for !stack.IsEmpty() {
+			item, _ := stack.Pop()
+			// the members and elements to merge, in the order of the source
+			next := make([]mergeItem, 0)
+			switch target := item.target.(type) {
+			case *JsonObjectNode:
+				for _, kv := range item.source.(*JsonObjectNode).Value {
+					if kv.Key == nil || kv.Value == nil {
+						continue
+					}
+					// all the spreads have the same key
+					if _, ok := kv.SpreadVariable(); ok {
+						target.Append(cloneFromSource(MergeSource{source.Name, kv}).(*JsonKeyValuePairNode))
+						continue
+					}
+					key := keyOf(kv)
+					path := append(item.path[:len(item.path):len(item.path)], key)
+					existing := target.Get(key)
+					switch {
+					case existing == nil:
+						target.Append(cloneFromSource(MergeSource{source.Name, kv}).(*JsonKeyValuePairNode))
+					case mergeableCollection(existing, kv.Value):
+						next = append(next, mergeItem{path, existing, kv.Value})
+					default:
+						target.Set(key, cloneFromSource(MergeSource{source.Name, kv.Value}))
+					}
+				}
+			case *JsonArrayNode:
+				elements := item.source.(*JsonArrayNode).Value
+				strategy := options.arrayMergeAt(item.path)
+				switch strategy.strategy {
+				case ARRAY_MERGE_APPEND:
+					for _, element := range elements {
+						target.Append(cloneFromSource(MergeSource{source.Name, element}))
+					}
+				case ARRAY_MERGE_BY_KEY:
+					for _, element := range elements {
+						i := indexByKey(target, element, strategy.key)
+						if i < 0 {
+							target.Append(cloneFromSource(MergeSource{source.Name, element}))
+							continue
+						}
+						path := append(item.path[:len(item.path):len(item.path)], strconv.Itoa(i))
+						next = append(next, mergeItem{path, target.Value[i], element})
+					}
+				default:
+					// the array keeps its place and spaces in the template, the elements are replaced
+					target.Value = cloneFromSource(MergeSource{source.Name, item.source}).(*JsonArrayNode).Value
+					target.SetMeta(SOURCE_META, source.Name)
+				}
+			}
+			for i := len(next) - 1; i >= 0; i-- {
+				stack.Push(next[i])
+			}
+		}
+	}
+	return rs, nil
+}
+
+// copy of the node, the copy and all its descendants have the name of the source
+func cloneFromSource(source MergeSource) JsonNode {
+	rs := Clone(source.Node)
+	if kv, ok := rs.(*JsonKeyValuePairNode); ok {
+		kv.SetMeta(SOURCE_META, source.Name)
+		kv.Key.SetMeta(SOURCE_META, source.Name)
+		Walk(kv.Value, func(ctx *WalkContext) WalkAction {
+			ctx.Node.SetMeta(SOURCE_META, source.Name)
+			return WalkContinue
+		})
+		return rs
+	}
+	Walk(rs, func(ctx *WalkContext) WalkAction {
+		ctx.Node.SetMeta(SOURCE_META, source.Name)
+		return WalkContinue
+	})
+	return rs
+}
+
+// both are objects, or both are arrays, to be merged
+func mergeableCollection(target JsonNode, source JsonNode) bool {
+	if _, ok := mergeable(target); ok {
+		_, ok = mergeable(source)
+		return ok
+	}
+	targetArray, ok := target.(*JsonArrayNode)
+	if !ok || len(targetArray.GetConditions()) > 0 {
+		return false
+	}
+	sourceArray, ok := source.(*JsonArrayNode)
+	return ok && len(sourceArray.GetConditions()) == 0
+}
+
+// the index of the object in the array with the same value of the key member as element, -1 when there is none
+func indexByKey(array *JsonArrayNode, element JsonNode, key string) int {
+	object, ok := mergeable(element)
+	if !ok || key == "" {
+		return -1
+	}
+	value := object.Get(key)
+	if value == nil {
+		return -1
+	}
+	for i, candidate := range array.Value {
+		if candidateObject, ok := mergeable(candidate); ok {
+			if existing := candidateObject.Get(key); existing != nil && Equal(existing, value, CompareNumbersNumerically()) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// the name of the source the node is taken from by Merge, empty when the node is not from Merge
+func SourceOf(node JsonNode) string {
+	if node == nil {
+		return ""
+	}
+	name, _ := node.GetMeta(SOURCE_META).(string)
+	return name
+}
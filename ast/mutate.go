@@ -0,0 +1,158 @@
+package ast
+
+import (
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// a string node holding s, the node is a string with variables when s refers to any `${name}`,
+// the same as when the string is read from a template
+func NewStringNode(s string) JsonStringValueNode {
+	value := util.EncodeToJsonString(s)
+	if util.RegStringWithVariable.Match(value) {
+		node, _ := NodeFactory(AST_STRING_VARIABLE, value)
+		return node.(*JsonExtendedStringWIthVariableNode)
+	}
+	return &JsonStringNode{Value: value}
+}
+
+func NewNumberNode(v float64) *JsonNumberNode {
+	return &JsonNumberNode{Value: v}
+}
+
+func NewBooleanNode(v bool) *JsonBooleanNode {
+	return &JsonBooleanNode{Value: v}
+}
+
+func NewNullNode() *JsonNullNode {
+	return &JsonNullNode{}
+}
+
+// `${name}`, name can also be `...name` for a spread or `include:path` for an include
+func NewVariableNode(name string) (*JsonExtendedVariableNode, error) {
+	value := []byte("${" + name + "}")
+	if !util.RegSpreadVariable.Match(value) && !util.RegIncludeVariable.Match(value) {
+		rs := util.RegStringWithVariable.Find(value)
+		if len(rs) != len(value) {
+			return nil, ErrorASTInvalidVariableName
+		}
+	}
+	node, err := NodeFactory(AST_VARIABLE, value)
+	if err != nil {
+		return nil, err
+	}
+	return node.(*JsonExtendedVariableNode), nil
+}
+
+// set the value of the member with the key, the member is appended when there is none.
+// when the key appears more than once the last one is set, the one returned by Get.
+func (node *JsonObjectNode) Set(key string, value JsonNode) {
+	for i := len(node.Value) - 1; i >= 0; i-- {
+		if kv := node.Value[i]; kv.Key != nil && keyEquals(kv.Key, key) {
+			if kv.Value != nil {
+				moveTrivia(kv.Value, value)
+			}
+			kv.Value = value
+			return
+		}
+	}
+	node.Append(&JsonKeyValuePairNode{Key: NewStringNode(key), Value: value})
+}
+
+// insert a member at index, index equals to Length() appends the member
+func (node *JsonObjectNode) Insert(index int, key string, value JsonNode) error {
+	if index < 0 || index > len(node.Value) {
+		return ErrorASTIndexOutOfRange
+	}
+	kv := &JsonKeyValuePairNode{Key: NewStringNode(key), Value: value}
+	node.Value = append(node.Value, nil)
+	copy(node.Value[index+1:], node.Value[index:])
+	node.Value[index] = kv
+	return nil
+}
+
+// remove all the members with the key, return false when there is none
+func (node *JsonObjectNode) Delete(key string) bool {
+	members := node.Value[:0]
+	for _, kv := range node.Value {
+		if kv.Key == nil || !keyEquals(kv.Key, key) {
+			members = append(members, kv)
+		}
+	}
+	deleted := len(members) != len(node.Value)
+	clear(node.Value[len(members):])
+	node.Value = members
+	return deleted
+}
+
+func (node *JsonArrayNode) Set(index int, value JsonNode) error {
+	if index < 0 || index >= len(node.Value) {
+		return ErrorASTIndexOutOfRange
+	}
+	moveTrivia(node.Value[index], value)
+	node.Value[index] = value
+	return nil
+}
+
+// insert an element at index, index equals to Length() appends the element
+func (node *JsonArrayNode) Insert(index int, value JsonNode) error {
+	if index < 0 || index > len(node.Value) {
+		return ErrorASTIndexOutOfRange
+	}
+	node.Value = append(node.Value, nil)
+	copy(node.Value[index+1:], node.Value[index:])
+	node.Value[index] = value
+	return nil
+}
+
+func (node *JsonArrayNode) Delete(index int) error {
+	if index < 0 || index >= len(node.Value) {
+		return ErrorASTIndexOutOfRange
+	}
+	node.Value = append(node.Value[:index], node.Value[index+1:]...)
+	return nil
+}
+
+// put replacement in the place of target under root, e.g. a node found by Query. the conditions and the
+// spaces around the target are moved to the replacement, return false when target is root or not found under root.
+func Replace(root JsonNode, target JsonNode, replacement JsonNode) bool {
+	stack := util.NewStack[JsonNode]()
+	stack.Push(root)
+	for !stack.IsEmpty() {
+		node, _ := stack.Pop()
+		switch n := node.(type) {
+		case *JsonArrayNode:
+			for i, element := range n.Value {
+				if element == target {
+					n.Value[i] = replacement
+					moveConditions(target, replacement)
+					return true
+				}
+			}
+		case *JsonObjectNode:
+			for _, kv := range n.Value {
+				if kv.Value == target {
+					kv.Value = replacement
+					moveConditions(target, replacement)
+					return true
+				}
+			}
+			if n.Loop != nil && n.Loop.Body == target {
+				n.Loop.Body = replacement
+				moveConditions(target, replacement)
+				return true
+			}
+		}
+		stack.PushElements(children(node))
+	}
+	return false
+}
+
+func moveConditions(from JsonNode, to JsonNode) {
+	moveTrivia(from, to)
+	if len(to.GetConditions()) > 0 {
+		return
+	}
+	for _, c := range from.GetConditions() {
+		to.AddCondition(c)
+	}
+}
@@ -0,0 +1,285 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+func newPatchError(err error, index int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: operation %d, %s", err, index, fmt.Sprintf(format, args...))
+}
+
+// apply the RFC 6902 JSON Patch to the template, the patch is an array of operations as read by ParseAST.
+// the values of the patch can have variables, conditions and loops, they are put into the template as they are.
+// the template is not changed, the patched copy is returned; no operation is applied when one fails.
+// `test` compares with Equal, the numbers numerically and the members in any order.
+func ApplyPatch(root JsonNode, patch JsonNode) (JsonNode, error) {
+	operations, ok := patch.(*JsonArrayNode)
+	if !ok {
+		return nil, fmt.Errorf("%w: the patch should be an array", ErrorASTInvalidPatch)
+	}
+	rs := Clone(root)
+	for i, element := range operations.Value {
+		operation, ok := element.(*JsonObjectNode)
+		if !ok {
+			return nil, newPatchError(ErrorASTInvalidPatch, i, "should be an object")
+		}
+		op, err := patchMember(operation, "op", i)
+		if err != nil {
+			return nil, err
+		}
+		path, err := patchMember(operation, "path", i)
+		if err != nil {
+			return nil, err
+		}
+		target, err := parsePointer(path)
+		if err != nil {
+			return nil, newPatchError(err, i, "path %q", path)
+		}
+		switch op {
+		case "add", "replace", "test":
+			value := operation.Get("value")
+			if value == nil {
+				return nil, newPatchError(ErrorASTInvalidPatch, i, "`%s` should come with a value", op)
+			}
+			value = Clone(value, CloneWithoutMeta())
+			switch op {
+			case "add":
+				rs, err = addAt(rs, target, value)
+			case "replace":
+				rs, err = replaceAt(rs, target, value)
+			default:
+				var current JsonNode
+				current, err = resolvePointer(rs, target)
+				if err == nil && !Equal(current, value, IgnoreKeyOrder(), CompareNumbersNumerically()) {
+					err = ErrorASTPatchTestFailed
+				}
+			}
+		case "remove":
+			_, err = removeAt(rs, target)
+		case "move", "copy":
+			var from string
+			from, err = patchMember(operation, "from", i)
+			if err != nil {
+				return nil, err
+			}
+			var source []string
+			source, err = parsePointer(from)
+			if err != nil {
+				return nil, newPatchError(err, i, "from %q", from)
+			}
+			var value JsonNode
+			if op == "copy" {
+				value, err = resolvePointer(rs, source)
+				if err == nil {
+					value = Clone(value, CloneWithoutMeta())
+				}
+			} else if len(target) > len(source) && strings.HasPrefix(path, from+"/") {
+				err = fmt.Errorf("%w: cannot move %q into itself", ErrorASTInvalidPatch, from)
+			} else {
+				value, err = removeAt(rs, source)
+			}
+			if err == nil {
+				rs, err = addAt(rs, target, value)
+			}
+		default:
+			return nil, newPatchError(ErrorASTInvalidPatch, i, "unknown op %q", op)
+		}
+		if err != nil {
+			return nil, newPatchError(err, i, "%s %q", op, path)
+		}
+	}
+	return rs, nil
+}
+
+// the member of the operation that must be a plain string, e.g. `op`, `path` and `from`
+func patchMember(operation *JsonObjectNode, key string, index int) (string, error) {
+	node, ok := operation.Get(key).(*JsonStringNode)
+	if !ok {
+		return "", newPatchError(ErrorASTInvalidPatch, index, "`%s` should be a string", key)
+	}
+	return node.GetValue()
+}
+
+// the reference tokens of the RFC 6901 JSON Pointer, `~1` is `/` and `~0` is `~`
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, ErrorASTInvalidPath
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// the index of an array element, `-` is the end of the array
+func pointerIndex(token string, length int) (int, error) {
+	if token == "-" {
+		return length, nil
+	}
+	if token == "" || (token[0] == '0' && len(token) > 1) || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, ErrorASTInvalidPath
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, ErrorASTInvalidPath
+	}
+	return index, nil
+}
+
+func resolvePointer(root JsonNode, tokens []string) (JsonNode, error) {
+	node := root
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case *JsonObjectNode:
+			node = n.Get(token)
+		case *JsonArrayNode:
+			index, err := pointerIndex(token, len(n.Value))
+			if err != nil {
+				return nil, err
+			}
+			node = n.At(index)
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, ErrorASTPatchPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// the root after value is added at the tokens, the root is replaced when the tokens are empty
+func addAt(root JsonNode, tokens []string, value JsonNode) (JsonNode, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := resolvePointer(root, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch n := parent.(type) {
+	case *JsonObjectNode:
+		if n.Loop != nil && last == DO_KEY {
+			n.Loop.Body = value
+			return root, nil
+		}
+		n.Set(last, value)
+		return root, nil
+	case *JsonArrayNode:
+		index, err := pointerIndex(last, len(n.Value))
+		if err != nil {
+			return nil, err
+		}
+		return root, n.Insert(index, value)
+	default:
+		return nil, ErrorASTPatchPathNotFound
+	}
+}
+
+func replaceAt(root JsonNode, tokens []string, value JsonNode) (JsonNode, error) {
+	current, err := resolvePointer(root, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		moveTrivia(current, value)
+		return value, nil
+	}
+	parent, _ := resolvePointer(root, tokens[:len(tokens)-1])
+	if array, ok := parent.(*JsonArrayNode); ok {
+		index, _ := pointerIndex(tokens[len(tokens)-1], len(array.Value))
+		return root, array.Set(index, value)
+	}
+	return addAt(root, tokens, value)
+}
+
+// remove the node at the tokens, return the node removed
+func removeAt(root JsonNode, tokens []string) (JsonNode, error) {
+	current, err := resolvePointer(root, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the root", ErrorASTInvalidPatch)
+	}
+	parent, _ := resolvePointer(root, tokens[:len(tokens)-1])
+	last := tokens[len(tokens)-1]
+	switch n := parent.(type) {
+	case *JsonObjectNode:
+		if !n.Delete(last) {
+			return nil, fmt.Errorf("%w: cannot remove the body of `$for`", ErrorASTInvalidPatch)
+		}
+	case *JsonArrayNode:
+		index, _ := pointerIndex(last, len(n.Value))
+		if err = n.Delete(index); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// apply the RFC 7396 JSON Merge Patch to the template: the members of the patch are merged into the objects of
+// the template, a null member removes the member. an object with `$for` is a value, it is replaced and not merged.
+// the template is not changed, the merged copy is returned.
+func ApplyMergePatch(root JsonNode, patch JsonNode) JsonNode {
+	type mergePair struct {
+		target *JsonObjectNode
+		patch  *JsonObjectNode
+	}
+	patchObject, ok := mergeable(patch)
+	if !ok {
+		return Clone(patch, CloneWithoutMeta())
+	}
+	rs := Clone(root)
+	target, ok := mergeable(rs)
+	if !ok {
+		target = &JsonObjectNode{Value: make([]*JsonKeyValuePairNode, 0)}
+		moveTrivia(rs, target)
+		rs = target
+	}
+	s := util.NewStack[mergePair]()
+	s.Push(mergePair{target, patchObject})
+	for !s.IsEmpty() {
+		pair, _ := s.Pop()
+		for _, kv := range pair.patch.Value {
+			if kv.Key == nil || kv.Value == nil {
+				continue
+			}
+			key := keyOf(kv)
+			if _, ok := kv.Value.(*JsonNullNode); ok && len(kv.Value.GetConditions()) == 0 {
+				pair.target.Delete(key)
+				continue
+			}
+			member, ok := mergeable(kv.Value)
+			if !ok {
+				pair.target.Set(key, Clone(kv.Value, CloneWithoutMeta()))
+				continue
+			}
+			existing, ok := mergeable(pair.target.Get(key))
+			if !ok {
+				existing = &JsonObjectNode{Value: make([]*JsonKeyValuePairNode, 0)}
+				pair.target.Set(key, existing)
+			}
+			s.Push(mergePair{existing, member})
+		}
+	}
+	return rs
+}
+
+// an object without conditions or `$for`, the members are merged
+func mergeable(node JsonNode) (*JsonObjectNode, bool) {
+	object, ok := node.(*JsonObjectNode)
+	if !ok || object.Loop != nil || len(object.GetConditions()) > 0 {
+		return nil, false
+	}
+	return object, true
+}
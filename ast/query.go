@@ -0,0 +1,256 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// the value of the member with the key, nil when there is none. the key is compared as written in the template,
+// e.g. `${name}` for a key with variable. when the key appears more than once the last one is returned,
+// as the unmarshaller keeps the last one. the body of a `$for` object is returned for `$do`.
+func (node *JsonObjectNode) Get(key string) JsonNode {
+	for i := len(node.Value) - 1; i >= 0; i-- {
+		if kv := node.Value[i]; kv.Key != nil && kv.Value != nil && keyEquals(kv.Key, key) {
+			return kv.Value
+		}
+	}
+	if node.Loop != nil && key == DO_KEY {
+		return node.Loop.Body
+	}
+	return nil
+}
+
+// the element at index i, nil when i is out of range
+func (node *JsonArrayNode) At(i int) JsonNode {
+	if i < 0 || i >= len(node.Value) {
+		return nil
+	}
+	return node.Value[i]
+}
+
+func keyEquals(key JsonStringValueNode, name string) bool {
+	value, err := key.GetValue()
+	return err == nil && value == name
+}
+
+type pathSegmentType byte
+
+const (
+	pathSegmentName pathSegmentType = iota
+	pathSegmentIndex
+	pathSegmentWildcard
+)
+
+type pathSegment struct {
+	segmentType pathSegmentType
+	// `..`, the segment applies to the node and all its descendants
+	recursive bool
+	names     []string
+	indexes   []int
+}
+
+// the nodes matching the JSONPath expression, in document order. supported are `$`, `.name`, `['name']`,
+// `[0]`, `[-1]`, `[0,2]`, `['a','b']`, `.*`, `[*]` and `..` for the descendants, filters and slices are not.
+// the query runs on the template as written: variables are not resolved and `$if`, `$for` and spreads
+// are not expanded, a variable node only matches as a leaf.
+func Query(root JsonNode, path string) ([]JsonNode, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	current := []JsonNode{root}
+	for _, segment := range segments {
+		if segment.recursive {
+			current = descendants(current)
+		}
+		next := make([]JsonNode, 0, len(current))
+		for _, node := range current {
+			next = segment.match(node, next)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func (segment *pathSegment) match(node JsonNode, rs []JsonNode) []JsonNode {
+	switch n := node.(type) {
+	case *JsonObjectNode:
+		switch segment.segmentType {
+		case pathSegmentWildcard:
+			return append(rs, children(n)...)
+		case pathSegmentName:
+			for _, name := range segment.names {
+				if value := n.Get(name); value != nil {
+					rs = append(rs, value)
+				}
+			}
+		}
+	case *JsonArrayNode:
+		switch segment.segmentType {
+		case pathSegmentWildcard:
+			return append(rs, n.Value...)
+		case pathSegmentIndex:
+			for _, index := range segment.indexes {
+				if index < 0 {
+					index += len(n.Value)
+				}
+				if value := n.At(index); value != nil {
+					rs = append(rs, value)
+				}
+			}
+		}
+	}
+	return rs
+}
+
+func children(node JsonNode) []JsonNode {
+	switch n := node.(type) {
+	case *JsonObjectNode:
+		rs := make([]JsonNode, 0, len(n.Value)+1)
+		for _, kv := range n.Value {
+			if kv.Value != nil {
+				rs = append(rs, kv.Value)
+			}
+		}
+		if n.Loop != nil {
+			rs = append(rs, n.Loop.Body)
+		}
+		return rs
+	case *JsonArrayNode:
+		return n.Value
+	}
+	return nil
+}
+
+// the nodes and all their descendants, each node comes before its descendants
+func descendants(nodes []JsonNode) []JsonNode {
+	rs := make([]JsonNode, 0, len(nodes))
+	stack := util.NewStack[JsonNode]()
+	for i := len(nodes) - 1; i >= 0; i-- {
+		stack.Push(nodes[i])
+	}
+	for !stack.IsEmpty() {
+		node, _ := stack.Pop()
+		rs = append(rs, node)
+		items := children(node)
+		for i := len(items) - 1; i >= 0; i-- {
+			stack.Push(items[i])
+		}
+	}
+	return rs
+}
+
+func newPathError(path string, offset int) error {
+	return fmt.Errorf("%w: %q at offset %d", ErrorASTInvalidPath, path, offset)
+}
+
+func parsePath(path string) ([]pathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, newPathError(path, 0)
+	}
+	rs := make([]pathSegment, 0)
+	i := 1
+	for i < len(path) {
+		segment := pathSegment{}
+		switch path[i] {
+		case '.':
+			i++
+			if i < len(path) && path[i] == '.' {
+				segment.recursive = true
+				i++
+			}
+			if i < len(path) && path[i] == '[' {
+				if !segment.recursive {
+					return nil, newPathError(path, i)
+				}
+				continue
+			}
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			name := path[start:i]
+			switch name {
+			case "":
+				return nil, newPathError(path, start)
+			case "*":
+				segment.segmentType = pathSegmentWildcard
+			default:
+				segment.segmentType = pathSegmentName
+				segment.names = []string{name}
+			}
+		case '[':
+			end, err := parseBracket(path, i, &segment)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		default:
+			return nil, newPathError(path, i)
+		}
+		rs = append(rs, segment)
+	}
+	return rs, nil
+}
+
+// parse the `[...]` at start into segment, return the offset after the `]`
+func parseBracket(path string, start int, segment *pathSegment) (int, error) {
+	// `..[` carries the recursive flag over from the previous dots
+	if start > 1 && path[start-1] == '.' && path[start-2] == '.' {
+		segment.recursive = true
+	}
+	i := start + 1
+	if strings.HasPrefix(path[i:], "*]") {
+		segment.segmentType = pathSegmentWildcard
+		return i + 2, nil
+	}
+	for {
+		if i >= len(path) {
+			return 0, newPathError(path, i)
+		}
+		switch c := path[i]; {
+		case c == '\'' || c == '"':
+			if segment.indexes != nil {
+				return 0, newPathError(path, i)
+			}
+			end := strings.IndexByte(path[i+1:], c)
+			if end < 0 {
+				return 0, newPathError(path, i)
+			}
+			segment.segmentType = pathSegmentName
+			segment.names = append(segment.names, path[i+1:i+1+end])
+			i += end + 2
+		case c == '-' || (c >= '0' && c <= '9'):
+			if segment.names != nil {
+				return 0, newPathError(path, i)
+			}
+			end := i + 1
+			for end < len(path) && path[end] >= '0' && path[end] <= '9' {
+				end++
+			}
+			index, err := strconv.Atoi(path[i:end])
+			if err != nil {
+				return 0, newPathError(path, i)
+			}
+			segment.segmentType = pathSegmentIndex
+			segment.indexes = append(segment.indexes, index)
+			i = end
+		default:
+			return 0, newPathError(path, i)
+		}
+		if i >= len(path) {
+			return 0, newPathError(path, i)
+		}
+		switch path[i] {
+		case ',':
+			i++
+		case ']':
+			return i + 1, nil
+		default:
+			return 0, newPathError(path, i)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// meta of the nodes read in lossless mode, the *Trivia of the node
+const TRIVIA_META = "trivia"
+
+// the text around a node as written in the document, so that the document can be written back as it is
+type Trivia struct {
+	// spaces and comments before the node
+	Leading []byte
+	// the node as written, e.g. `1e3` or `'single'` in relaxed mode
+	Raw []byte
+	// spaces and comments after the node, before the `,` or `:` that follows it, or the end of the document for the root
+	Trailing []byte
+	// the spaces and comments after the `,` that follows the node, up to the end of the line
+	Comma []byte
+	// collections, the spaces and comments before the closing symbol
+	Closing []byte
+	// collections, the collection ends with a comma in relaxed mode
+	TrailingComma bool
+	// objects, the members as written, including the `$if`, `$unless`, `$for` and `$do` members folded into the object
+	Members []*JsonKeyValuePairNode
+	// the `{"$if": ..., "$value": node}` object the node takes the place of
+	Owner *JsonObjectNode
+	// the value of the node when Raw is read
+	snapshot string
+}
+
+func NewTrivia(node JsonNode, leading []byte, raw []byte) *Trivia {
+	return &Trivia{Leading: leading, Raw: raw, snapshot: rawSnapshot(node)}
+}
+
+// the trivia of the node, nil when the node is not read in lossless mode
+func TriviaOf(node JsonNode) *Trivia {
+	if node == nil {
+		return nil
+	}
+	trivia, _ := node.GetMeta(TRIVIA_META).(*Trivia)
+	return trivia
+}
+
+// Raw when the node still has the value it is read with, nil otherwise
+func (t *Trivia) RawText(node JsonNode) []byte {
+	if t == nil || t.Raw == nil || rawSnapshot(node) != t.snapshot {
+		return nil
+	}
+	return t.Raw
+}
+
+// the replacement takes the place of the node in the document, it takes the spaces around the node
+func moveTrivia(from JsonNode, to JsonNode) {
+	trivia := TriviaOf(from)
+	if trivia == nil || TriviaOf(to) != nil {
+		return
+	}
+	to.SetMeta(TRIVIA_META, &Trivia{Leading: trivia.Leading, Trailing: trivia.Trailing, Comma: trivia.Comma})
+}
+
+// the trivia of the copy of a node, the members and the owner refer to the copies in cloned
+func (t *Trivia) clone(cloned map[JsonNode]JsonNode, options *cloneOptions) *Trivia {
+	rs := *t
+	if t.Members != nil {
+		rs.Members = make([]*JsonKeyValuePairNode, len(t.Members))
+		for i, kv := range t.Members {
+			// the `$if` and `$for` members folded into the object are not in the tree, they are shared
+			if target, ok := cloned[kv]; ok {
+				kv = target.(*JsonKeyValuePairNode)
+			}
+			rs.Members[i] = kv
+		}
+	}
+	if t.Owner != nil {
+		owner := cloneNode(t.Owner, options).(*JsonObjectNode)
+		owner.Value = make([]*JsonKeyValuePairNode, len(t.Owner.Value))
+		for i, kv := range t.Owner.Value {
+			owner.Value[i] = cloneNode(kv, options).(*JsonKeyValuePairNode)
+			if target, ok := cloned[kv.Value]; ok {
+				owner.Value[i].Value = target
+			}
+		}
+		rs.Owner = owner
+	}
+	return &rs
+}
+
+func rawSnapshot(node JsonNode) string {
+	switch n := node.(type) {
+	case *JsonStringNode:
+		return string(n.Value)
+	case *JsonExtendedStringWIthVariableNode:
+		return string(n.Value)
+	case *JsonExtendedVariableNode:
+		return string(n.Value)
+	case *JsonNumberNode:
+		return fmt.Sprint(n.Value)
+	case *JsonBooleanNode:
+		return strconv.FormatBool(n.Value)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,140 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+type WalkEvent byte
+
+const (
+	// the node is met, before its children
+	WalkEnter WalkEvent = iota
+	// after the children of the node
+	WalkLeave
+)
+
+type WalkAction byte
+
+const (
+	WalkContinue WalkAction = iota
+	// on WalkEnter, the children of the node are not walked, the WalkLeave of the node still comes
+	WalkSkipChildren
+	// nothing is walked after it, there is no WalkLeave for the nodes entered
+	WalkStop
+)
+
+// the node met by Walk and where it is in the template
+type WalkContext struct {
+	Event WalkEvent
+	Node  JsonNode
+	// the object or array holding the node, nil for the root
+	Parent JsonNode
+	// the JSONPath of the node as accepted by Query, `$` for the root, `$do` for the body of a `$for` object
+	Path  string
+	Depth int
+}
+
+type WalkFunc func(ctx *WalkContext) WalkAction
+
+type walkFrame struct {
+	ctx     WalkContext
+	entered bool
+}
+
+// walk the values under root in document order, the same nodes Query runs on: the members of the objects,
+// the elements of the arrays and the body of the `$for` objects. the keys and the kv pairs are not walked.
+// unlike the visitors Walk does not use the visited flags, the template can be walked any number of times.
+func Walk(root JsonNode, fn WalkFunc) {
+	if root == nil {
+		return
+	}
+	stack := util.NewStack[*walkFrame]()
+	stack.Push(&walkFrame{ctx: WalkContext{Node: root, Path: "$"}})
+	for !stack.IsEmpty() {
+		frame, _ := stack.Pop()
+		ctx := frame.ctx
+		if frame.entered {
+			ctx.Event = WalkLeave
+			if fn(&ctx) == WalkStop {
+				return
+			}
+			continue
+		}
+		ctx.Event = WalkEnter
+		action := fn(&ctx)
+		if action == WalkStop {
+			return
+		}
+		frame.entered = true
+		stack.Push(frame)
+		if action == WalkSkipChildren {
+			continue
+		}
+		items := childFrames(&frame.ctx)
+		for i := len(items) - 1; i >= 0; i-- {
+			stack.Push(items[i])
+		}
+	}
+}
+
+func childFrames(parent *WalkContext) []*walkFrame {
+	rs := make([]*walkFrame, 0)
+	child := func(node JsonNode, path string) {
+		rs = append(rs, &walkFrame{ctx: WalkContext{Node: node, Parent: parent.Node, Path: path, Depth: parent.Depth + 1}})
+	}
+	switch n := parent.Node.(type) {
+	case *JsonObjectNode:
+		for _, kv := range n.Value {
+			if kv.Key == nil || kv.Value == nil {
+				continue
+			}
+			key, err := kv.Key.GetValue()
+			if err != nil {
+				continue
+			}
+			child(kv.Value, parent.Path+pathName(key))
+		}
+		if n.Loop != nil {
+			child(n.Loop.Body, parent.Path+pathName(DO_KEY))
+		}
+	case *JsonArrayNode:
+		for i, element := range n.Value {
+			child(element, parent.Path+"["+strconv.Itoa(i)+"]")
+		}
+	}
+	return rs
+}
+
+// `.name`, or `['name']` when the name does not read back as a dot segment
+func pathName(name string) string {
+	if name != "" && name != "*" && !strings.ContainsAny(name, ".[") {
+		return "." + name
+	}
+	if strings.ContainsRune(name, '\'') {
+		return `["` + name + `"]`
+	}
+	return "['" + name + "']"
+}
+
+// walk the values under root in document order, the same as go/ast.Inspect: f is called with the node before
+// its children, when it returns true the children are walked and f is called with nil after them.
+func Inspect(root JsonNode, f func(node JsonNode) bool) {
+	entered := util.NewStack[bool]()
+	Walk(root, func(ctx *WalkContext) WalkAction {
+		if ctx.Event == WalkLeave {
+			if walked, _ := entered.Pop(); walked {
+				f(nil)
+			}
+			return WalkContinue
+		}
+		walked := f(ctx.Node)
+		entered.Push(walked)
+		if !walked {
+			return WalkSkipChildren
+		}
+		return WalkContinue
+	})
+}
@@ -1,7 +1,618 @@
 package jsonextend_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jaksonlin/go-jsonextend"
+	"github.com/jaksonlin/go-jsonextend/ast"
 )
 
 var testMarshaler = func(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func TestQuery(t *testing.T) {
+	template := `{
+	"spec": {
+		"replicas": ${replicas},
+		"containers": [
+			{"name": "web", "image": "nginx:${version}"},
+			{"name": "sidecar", "image": ${sidecarImage}},
+			{"$for": "port in ${ports}", "$do": {"image": "ignored"}}
+		]
+	}
+}`
+	root, err := jsonextend.ParseAST(strings.NewReader(template))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	images, err := ast.Query(root, "$.spec.containers[*].image")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(images) != 2 || images[0].GetNodeType() != ast.AST_STRING_VARIABLE || images[1].GetNodeType() != ast.AST_VARIABLE {
+		t.Log(images)
+		t.FailNow()
+	}
+	if images[1].(*ast.JsonExtendedVariableNode).Variable != "sidecarImage" {
+		t.FailNow()
+	}
+
+	// the loop body is reached with `$do`
+	all, err := ast.Query(root, "$..image")
+	if err != nil || len(all) != 3 {
+		t.Log(err, all)
+		t.FailNow()
+	}
+
+	names, err := ast.Query(root, `$['spec'].containers[0,-2]["name"]`)
+	if err != nil || len(names) != 2 {
+		t.Log(err, names)
+		t.FailNow()
+	}
+	if value, _ := names[1].(*ast.JsonStringNode).GetValue(); value != "sidecar" {
+		t.FailNow()
+	}
+
+	spec := root.(*ast.JsonObjectNode).Get("spec").(*ast.JsonObjectNode)
+	if spec.Get("replicas").GetNodeType() != ast.AST_VARIABLE || spec.Get("missing") != nil {
+		t.FailNow()
+	}
+	containers := spec.Get("containers").(*ast.JsonArrayNode)
+	if containers.At(2) == nil || containers.At(3) != nil || containers.At(-1) != nil {
+		t.FailNow()
+	}
+
+	missing, err := ast.Query(root, "$.spec.replicas.name")
+	if err != nil || len(missing) != 0 {
+		t.FailNow()
+	}
+
+	for _, path := range []string{"spec", "$.", "$.spec[", "$.spec['a'", "$[1,'a']", "$.[0]"} {
+		_, err = ast.Query(root, path)
+		if !errors.Is(err, ast.ErrorASTInvalidPath) {
+			t.Log(path, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestEditTemplate(t *testing.T) {
+	template := `{"image": "nginx:1.25", "${?debug}verbose": true, "ports": [80, 443], "$if": ${enabled},` +
+		` "env": {"$for": "e in ${envs}", "$do": {"name": "${e.name}"}}, "extra": {"$unless": ${slim}, "$value": ${...extras}}}`
+	root, err := jsonextend.ParseAST(strings.NewReader(template))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	object := root.(*ast.JsonObjectNode)
+
+	images, _ := ast.Query(root, "$.image")
+	if !ast.Replace(root, images[0], ast.NewStringNode("nginx:${version}")) {
+		t.FailNow()
+	}
+	replicas, err := ast.NewVariableNode("replicas")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err = object.Insert(0, "replicas", replicas); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	object.Set("name", ast.NewStringNode("web"))
+	object.Set("verbose", ast.NewBooleanNode(false))
+	ports := object.Get("ports").(*ast.JsonArrayNode)
+	if ports.Delete(0) != nil || ports.Insert(1, ast.NewNumberNode(8443)) != nil || ports.Set(0, ast.NewNullNode()) != nil {
+		t.FailNow()
+	}
+	if !errors.Is(ports.Insert(5, ast.NewNullNode()), ast.ErrorASTIndexOutOfRange) {
+		t.FailNow()
+	}
+	extra, err := jsonextend.FormatTemplate(object.Get("extra"), "")
+	if err != nil || string(extra) != `{"$unless":${slim},"$value":${...extras}}` {
+		t.Log(string(extra))
+		t.FailNow()
+	}
+	if !object.Delete("extra") || object.Delete("extra") {
+		t.FailNow()
+	}
+	if _, err = ast.NewVariableNode("a} ${b"); !errors.Is(err, ast.ErrorASTInvalidVariableName) {
+		t.FailNow()
+	}
+
+	out, err := jsonextend.FormatTemplate(root, "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `{"$if":${enabled},"replicas":${replicas},"image":"nginx:${version}","${?debug}verbose":false,` +
+		`"ports":[null,8443],"env":{"$for":"e in ${envs}","$do":{"name":"${e.name}"}},"name":"web"}`
+	if string(out) != expected {
+		t.Log(string(out))
+		t.FailNow()
+	}
+
+	// the written template renders the same as the edited AST
+	variables := map[string]interface{}{"enabled": true, "replicas": 2, "version": "1.27", "debug": true, "envs": []interface{}{map[string]interface{}{"name": "A"}}}
+	rendered, err := jsonextend.Parse(bytes.NewReader(out), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var result map[string]interface{}
+	if err = json.Unmarshal(rendered, &result); err != nil {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+	if result["image"] != "nginx:1.27" || result["verbose"] != false || len(result["env"].([]interface{})) != 1 {
+		t.Log(result)
+		t.FailNow()
+	}
+
+	pretty, err := jsonextend.FormatTemplate(object.Get("ports"), "  ")
+	if err != nil || string(pretty) != "[\n  null,\n  8443\n]" {
+		t.Log(string(pretty))
+		t.FailNow()
+	}
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	documents := []struct {
+		document string
+		relaxed  bool
+	}{
+		{"{\n  \"a\" : 1e3 ,\n  \"b\": [ 1, 2 ,3 ] ,\"c\":{}, \"d\" : [ ]\n}\n", false},
+		{"  42  ", false},
+		{"{\"$if\": ${x}, \"k\": \"${v}\",\n \"${?d}z\" : null, \"e\": {\"$for\": \"i in ${items}\", \"$do\": ${i} }, \"f\": { \"$unless\": ${y} , \"$value\" : true }}", false},
+		{"// head\n{\n  a: 'x', /* c */ b: 0x10, c: [1,2, // last\n  ],\n  d: Infinity,\n}\n// tail\n", true},
+	}
+	for _, item := range documents {
+		options := []jsonextend.Option{jsonextend.WithLosslessMode()}
+		if item.relaxed {
+			options = append(options, jsonextend.WithRelaxedMode())
+		}
+		root, err := jsonextend.ParseAST(strings.NewReader(item.document), options...)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		out, err := jsonextend.FormatTemplate(root, "  ")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if string(out) != item.document {
+			t.Logf("%q", out)
+			t.FailNow()
+		}
+	}
+}
+
+func TestLosslessEdit(t *testing.T) {
+	template := `{
+    "name": "web",   // the service
+    "replicas": 2,
+    "ports": [
+        80,
+        443
+    ],
+    "$if": ${enabled}
+}
+`
+	root, err := jsonextend.ParseAST(strings.NewReader(template), jsonextend.WithLosslessMode(), jsonextend.WithRelaxedMode())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	object := root.(*ast.JsonObjectNode)
+	object.Delete("name")
+	object.Set("replicas", ast.NewNumberNode(3))
+	object.Set("image", ast.NewStringNode("nginx:${version}"))
+	ports := object.Get("ports").(*ast.JsonArrayNode)
+	if err = ports.Insert(2, ast.NewNumberNode(8080)); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	out, err := jsonextend.FormatTemplate(root, "    ")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `{
+    "replicas": 3,
+    "ports": [
+        80,
+        443,
+        8080
+    ],
+    "$if": ${enabled},
+    "image": "nginx:${version}"
+}
+`
+	if string(out) != expected {
+		t.Log(string(out))
+		t.FailNow()
+	}
+}
+
+func TestWalk(t *testing.T) {
+	template := `{"name": "${name}", "a.b": [1, {"x": true}], "items": {"$for": "item in ${items}", "$do": {"id": "${item}"}}}`
+	root, err := jsonextend.ParseAST(strings.NewReader(template))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	for i := 0; i < 2; i++ {
+		paths := make([]string, 0)
+		leaves := 0
+		ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+			if ctx.Event == ast.WalkLeave {
+				leaves++
+				return ast.WalkContinue
+			}
+			paths = append(paths, ctx.Path)
+			if ctx.Path != "$" {
+				found, err := ast.Query(root, ctx.Path)
+				if err != nil || len(found) != 1 || found[0] != ctx.Node {
+					t.Log(ctx.Path, err)
+					t.FailNow()
+				}
+			}
+			return ast.WalkContinue
+		})
+		expected := []string{"$", "$.name", "$['a.b']", "$['a.b'][0]", "$['a.b'][1]", "$['a.b'][1].x", "$.items", "$.items.$do", "$.items.$do.id"}
+		if strings.Join(paths, " ") != strings.Join(expected, " ") || leaves != len(expected) {
+			t.Log(paths, leaves)
+			t.FailNow()
+		}
+	}
+
+	array, _ := ast.Query(root, "$['a.b']")
+	visited := 0
+	ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+		if ctx.Event == ast.WalkEnter {
+			visited++
+		}
+		if ctx.Parent == array[0] && ctx.Depth != 2 {
+			t.Log(ctx.Path, ctx.Depth)
+			t.FailNow()
+		}
+		if ctx.Node == array[0] {
+			return ast.WalkSkipChildren
+		}
+		if ctx.Path == "$.items" {
+			return ast.WalkStop
+		}
+		return ast.WalkContinue
+	})
+	if visited != 4 {
+		t.Log(visited)
+		t.FailNow()
+	}
+
+	depth, calls := 0, 0
+	ast.Inspect(root, func(node ast.JsonNode) bool {
+		calls++
+		if node == nil {
+			depth--
+			return true
+		}
+		_, isObject := node.(*ast.JsonObjectNode)
+		if node != root && isObject {
+			return false
+		}
+		depth++
+		return true
+	})
+	// 6 nodes met, the 2 objects under the root are not walked into and get no nil call
+	if depth != 0 || calls != 10 {
+		t.Log(depth, calls)
+		t.FailNow()
+	}
+}
+
+func TestCloneEqualHash(t *testing.T) {
+	template := `{"name": "${name}", "ports": [80, 443], "${?tls}cert": "x", "items": {"$for": "item in ${items}", "$do": {"id": "${item}"}}}`
+	root, err := jsonextend.ParseAST(strings.NewReader(template))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	clone := ast.Clone(root)
+	if !ast.Equal(root, clone) || ast.Hash(root) != ast.Hash(clone) {
+		t.FailNow()
+	}
+	clone.(*ast.JsonObjectNode).Get("ports").(*ast.JsonArrayNode).Set(0, ast.NewNumberNode(8080))
+	if ast.Equal(root, clone) || ast.Hash(root) == ast.Hash(clone) {
+		t.FailNow()
+	}
+	if root.(*ast.JsonObjectNode).Get("ports").(*ast.JsonArrayNode).At(0).(*ast.JsonNumberNode).Value != float64(80) {
+		t.Log("the clone shares the nodes with the original")
+		t.FailNow()
+	}
+
+	reordered, err := jsonextend.ParseAST(strings.NewReader(`{"ports": [80, 443], "items": {"$for": "item in ${items}", "$do": {"id": "${item}"}}, "${?tls}cert": "x", "name": "${name}"}`))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if ast.Equal(root, reordered) {
+		t.FailNow()
+	}
+	if !ast.Equal(root, reordered, ast.IgnoreKeyOrder()) || ast.Hash(root, ast.IgnoreKeyOrder()) != ast.Hash(reordered, ast.IgnoreKeyOrder()) {
+		t.FailNow()
+	}
+	unconditioned, _ := jsonextend.ParseAST(strings.NewReader(`{"name": "${name}", "ports": [80, 443], "cert": "x", "items": {"$for": "item in ${items}", "$do": {"id": "${item}"}}}`))
+	if ast.Equal(root, unconditioned) {
+		t.FailNow()
+	}
+
+	integer, float := &ast.JsonNumberNode{Value: 1}, ast.NewNumberNode(1)
+	if ast.Equal(integer, float) {
+		t.FailNow()
+	}
+	if !ast.Equal(integer, float, ast.CompareNumbersNumerically()) || ast.Hash(integer, ast.CompareNumbersNumerically()) != ast.Hash(float, ast.CompareNumbersNumerically()) {
+		t.FailNow()
+	}
+
+	lossless, err := jsonextend.ParseAST(strings.NewReader("{\n  \"a\": 1, // one\n  \"b\": 2\n}\n"), jsonextend.WithLosslessMode(), jsonextend.WithRelaxedMode())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	bare := ast.Clone(lossless, ast.CloneWithoutMeta())
+	if ast.TriviaOf(bare) != nil || !ast.Equal(lossless, bare) {
+		t.FailNow()
+	}
+	copied := ast.Clone(lossless).(*ast.JsonObjectNode)
+	copied.Delete("a")
+	out, err := jsonextend.FormatTemplate(copied, "  ")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(out) != "{\n  \"b\": 2\n}\n" {
+		t.Log(string(out))
+		t.FailNow()
+	}
+	out, _ = jsonextend.FormatTemplate(lossless, "  ")
+	if string(out) != "{\n  \"a\": 1, // one\n  \"b\": 2\n}\n" {
+		t.Log(string(out))
+		t.FailNow()
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before, err := jsonextend.ParseAST(strings.NewReader(`{"name": "${name}", "replicas": 2, "ports": [80, 443], "legacy": true, "env": {"A": "1"}, "list": [1, 2, 3, 4]}`))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	after, err := jsonextend.ParseAST(strings.NewReader(`{"name": "${app}", "replicas": 3, "ports": [8080, 80, 443], "env": {"A": "1", "a/b": "2"}, "list": [1, 3, 5, 4], "image": ${image}}`))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	changes := jsonextend.Diff(before, after)
+	patch, err := jsonextend.FormatPatch(changes)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `[{"op":"replace","path":"/name","value":"${app}"},{"op":"replace","path":"/replicas","value":3},` +
+		`{"op":"add","path":"/ports/0","value":8080},{"op":"add","path":"/env/a~1b","value":"2"},` +
+		`{"op":"remove","path":"/list/1"},{"op":"add","path":"/list/2","value":5},` +
+		`{"op":"remove","path":"/legacy"},{"op":"add","path":"/image","value":${image}}]`
+	if string(patch) != expected {
+		t.Log(string(patch))
+		t.FailNow()
+	}
+	if changes[0].From.(*ast.JsonExtendedStringWIthVariableNode).Variables == nil || changes[6].Type != ast.CHANGE_REMOVE {
+		t.FailNow()
+	}
+	if len(jsonextend.Diff(before, ast.Clone(before))) != 0 {
+		t.FailNow()
+	}
+
+	// a long array, the patch turns it into the other one
+	from, to := make([]string, 0), make([]string, 0)
+	for i := 0; i < 1000; i++ {
+		from = append(from, strconv.Itoa(i%7))
+		to = append(to, strconv.Itoa(i%5))
+	}
+	longBefore, _ := jsonextend.ParseAST(strings.NewReader("[" + strings.Join(from, ",") + "]"))
+	longAfter, _ := jsonextend.ParseAST(strings.NewReader("[" + strings.Join(to, ",") + "]"))
+	patch, _ = jsonextend.FormatPatch(jsonextend.Diff(longBefore, longAfter))
+	patchNode, _ := jsonextend.ParseAST(bytes.NewReader(patch))
+	patched, err := jsonextend.ApplyPatch(longBefore, patchNode)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !ast.Equal(patched, longAfter) {
+		t.Log("the patch does not turn the array into the other one")
+		t.FailNow()
+	}
+
+	// the rendered documents, rendered with the same variables
+	variables := map[string]interface{}{"name": "web", "app": "web", "image": "nginx"}
+	renderedBefore, _ := jsonextend.Parse(strings.NewReader(`{"name": "${name}", "tags": ["a"]}`), variables)
+	renderedAfter, _ := jsonextend.Parse(strings.NewReader(`{"name": "${app}", "tags": ["a", "${image}"]}`), variables)
+	a, _ := jsonextend.ParseAST(bytes.NewReader(renderedBefore))
+	b, _ := jsonextend.ParseAST(bytes.NewReader(renderedAfter))
+	patch, _ = jsonextend.FormatPatch(jsonextend.Diff(a, b))
+	if string(patch) != `[{"op":"add","path":"/tags/1","value":"nginx"}]` {
+		t.Log(string(patch))
+		t.FailNow()
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	base := `{"name": "${name}", "replicas": 1, "ports": [80], "env": {"LOG": "info", "DEBUG": "1"}}`
+	patch := `[
+		{"op": "test", "path": "/replicas", "value": 1.0},
+		{"op": "replace", "path": "/replicas", "value": ${replicas}},
+		{"op": "add", "path": "/ports/-", "value": 443},
+		{"op": "add", "path": "/ports/0", "value": {"$if": ${http}, "$value": 8080}},
+		{"op": "remove", "path": "/env/DEBUG"},
+		{"op": "copy", "from": "/name", "path": "/env/APP"},
+		{"op": "move", "from": "/env/LOG", "path": "/log"}
+	]`
+	template, err := jsonextend.ParseAST(strings.NewReader(base))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	operations, err := jsonextend.ParseAST(strings.NewReader(patch))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	patched, err := jsonextend.ApplyPatch(template, operations)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	out, err := jsonextend.FormatTemplate(patched, "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(out) != `{"name":"${name}","replicas":${replicas},"ports":[{"$if":${http},"$value":8080},80,443],"env":{"APP":"${name}"},"log":"info"}` {
+		t.Log(string(out))
+		t.FailNow()
+	}
+	rendered, err := jsonextend.ParseBytes(out, map[string]interface{}{"name": "web", "replicas": 3, "http": false})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var compact bytes.Buffer
+	if err = json.Compact(&compact, rendered); err != nil || compact.String() != `{"name":"web","replicas":3,"ports":[80,443],"env":{"APP":"web"},"log":"info"}` {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+
+	failing, _ := jsonextend.ParseAST(strings.NewReader(`[{"op": "remove", "path": "/name"}, {"op": "test", "path": "/replicas", "value": 2}]`))
+	_, err = jsonextend.ApplyPatch(template, failing)
+	if !errors.Is(err, ast.ErrorASTPatchTestFailed) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if template.(*ast.JsonObjectNode).Get("name") == nil {
+		t.Log("the template is changed")
+		t.FailNow()
+	}
+	for _, invalid := range []string{`{}`, `[{"op": "add", "path": "/x"}]`, `[{"op": "remove", "path": "/missing"}]`, `[{"op": "move", "from": "/env", "path": "/env/x"}]`, `[{"op": "add", "path": "/ports/01", "value": 1}]`} {
+		operations, _ := jsonextend.ParseAST(strings.NewReader(invalid))
+		if _, err = jsonextend.ApplyPatch(template, operations); err == nil {
+			t.Log(invalid)
+			t.FailNow()
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	template, _ := jsonextend.ParseAST(strings.NewReader(`{"name": "${name}", "env": {"LOG": "info", "DEBUG": "1"}, "tags": ["a"]}`))
+	patch, _ := jsonextend.ParseAST(strings.NewReader(`{"env": {"DEBUG": null, "REGION": "${region}"}, "tags": ["${tag}"], "limits": {"cpu": 1, "memory": null}}`))
+	merged := jsonextend.ApplyMergePatch(template, patch)
+	out, err := jsonextend.FormatTemplate(merged, "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(out) != `{"name":"${name}","env":{"LOG":"info","REGION":"${region}"},"tags":["${tag}"],"limits":{"cpu":1}}` {
+		t.Log(string(out))
+		t.FailNow()
+	}
+	original, _ := jsonextend.FormatTemplate(template, "")
+	if string(original) != `{"name":"${name}","env":{"LOG":"info","DEBUG":"1"},"tags":["a"]}` {
+		t.Log(string(original))
+		t.FailNow()
+	}
+	scalar, _ := jsonextend.ParseAST(strings.NewReader(`${value}`))
+	if _, ok := jsonextend.ApplyMergePatch(template, scalar).(*ast.JsonExtendedVariableNode); !ok {
+		t.FailNow()
+	}
+}
+
+func TestMerge(t *testing.T) {
+	documents := map[string]string{
+		"base.json":   `{"name": "${name}", "replicas": 1, "containers": [{"name": "app", "image": "app:1", "env": ["A=1"]}], "tags": ["base"], "ports": [80]}`,
+		"region.json": `{"replicas": 2, "containers": [{"name": "app", "env": ["REGION=${region}"]}, {"name": "sidecar", "image": "proxy"}], "tags": ["eu"]}`,
+		"prod.json":   `{"replicas": ${replicas}, "ports": [443], "limits": {"cpu": 2}}`,
+	}
+	sources := make([]jsonextend.MergeSource, 0)
+	for _, name := range []string{"base.json", "region.json", "prod.json"} {
+		node, err := jsonextend.ParseAST(strings.NewReader(documents[name]))
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		sources = append(sources, jsonextend.MergeSource{Name: name, Node: node})
+	}
+	merged, err := jsonextend.Merge(sources,
+		ast.MergeArrays(ast.ARRAY_MERGE_APPEND, ""),
+		ast.MergeArraysAt("/containers", ast.ARRAY_MERGE_BY_KEY, "name"),
+		ast.MergeArraysAt("/ports", ast.ARRAY_MERGE_REPLACE, ""))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	out, err := jsonextend.FormatTemplate(merged, "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `{"name":"${name}","replicas":${replicas},"containers":[{"name":"app","image":"app:1","env":["A=1","REGION=${region}"]},` +
+		`{"name":"sidecar","image":"proxy"}],"tags":["base","eu"],"ports":[443],"limits":{"cpu":2}}`
+	if string(out) != expected {
+		t.Log(string(out))
+		t.FailNow()
+	}
+	provenance := map[string]string{
+		"$.name":                 "base.json",
+		"$.replicas":             "prod.json",
+		"$.containers[0].image":  "base.json",
+		"$.containers[0].env[1]": "region.json",
+		"$.containers[1]":        "region.json",
+		"$.ports[0]":             "prod.json",
+		"$.limits.cpu":           "prod.json",
+	}
+	for path, source := range provenance {
+		nodes, _ := ast.Query(merged, path)
+		if len(nodes) != 1 || ast.SourceOf(nodes[0]) != source {
+			t.Log(path)
+			t.FailNow()
+		}
+	}
+	if sources[0].Node.(*ast.JsonObjectNode).Get("replicas").(*ast.JsonNumberNode).Value != float64(1) || ast.SourceOf(sources[0].Node) != "" {
+		t.Log("the source is changed")
+		t.FailNow()
+	}
+	if _, err = jsonextend.Merge(sources, ast.MergeArraysAt("containers", ast.ARRAY_MERGE_APPEND, "")); !errors.Is(err, ast.ErrorASTInvalidPath) {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	// the spreads are all kept, the same key in an array merged by key is applied in order
+	base, _ := jsonextend.ParseAST(strings.NewReader(`{"...": ${defaults}, "items": [{"name": "x", "v": 1}]}`))
+	override, _ := jsonextend.ParseAST(strings.NewReader(`{"${...extra}": null, "items": [{"name": "x", "v": 2}, {"name": "x", "v": 3}]}`))
+	merged, err = jsonextend.Merge([]jsonextend.MergeSource{{Name: "base", Node: base}, {Name: "override", Node: override}}, ast.MergeArrays(ast.ARRAY_MERGE_BY_KEY, "name"))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	out, _ = jsonextend.FormatTemplate(merged, "")
+	if string(out) != `{"...":${defaults},"items":[{"name":"x","v":3}],"${...extra}":null}` {
+		t.Log(string(out))
+		t.FailNow()
+	}
+}
@@ -11,6 +11,8 @@ import (
 type ASTByteBaseBuilder struct {
 	astConstructor *astByteBaseConstructor
 	provider       *tokenProvider
+	// lossless mode only
+	trivia *triviaRecorder
 }
 
 func NewASTByteBaseBuilder(reader io.Reader) *ASTByteBaseBuilder {
@@ -20,7 +22,67 @@ func NewASTByteBaseBuilder(reader io.Reader) *ASTByteBaseBuilder {
 	}
 }
 
+// the options are applied to the token provider, e.g. EnableRelaxedMode
+func NewASTByteBaseBuilderWithOptions(reader io.Reader, options []astbuilder.TokenProviderOptions) (*ASTByteBaseBuilder, error) {
+	return newASTByteBaseBuilder(newTokenProvider(reader), options)
+}
+
+// read a document in memory without first copying it into a buffer, the string nodes of the ast share the bytes of
+// data. the nodes and the values are allocated as they are for a reader.
+func NewASTByteBaseBuilderFromBytes(data []byte, options []astbuilder.TokenProviderOptions) (*ASTByteBaseBuilder, error) {
+	return newASTByteBaseBuilder(newTokenProviderFromSource(newSliceSource(data)), options)
+}
+
+func newASTByteBaseBuilder(provider *tokenProvider, options []astbuilder.TokenProviderOptions) (*ASTByteBaseBuilder, error) {
+	builder := &ASTByteBaseBuilder{
+		astConstructor: newASTConstructor(),
+		provider:       provider,
+	}
+	for _, option := range options {
+		err := option(builder.provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if builder.provider.relaxed {
+		builder.provider.isKeyPosition = func() bool {
+			t, err := builder.astConstructor.TopElementType()
+			return err == nil && t == ast.AST_OBJECT
+		}
+		builder.astConstructor.syntaxChecker.allowTrailingComma = true
+	}
+	if builder.provider.lossless {
+		builder.trivia = &triviaRecorder{}
+	}
+	builder.astConstructor.ast.SetDuplicateKeyPolicy(builder.provider.duplicateKeys)
+	return builder, nil
+}
+
+// the policy for the same literal key in an object, the keys keep their positions for the errors of the interpreters
+func WithDuplicateKeyPolicy(policy ast.DuplicateKeyPolicy) astbuilder.TokenProviderOptions {
+	return func(provider astbuilder.TokenProvider) error {
+		byteProvider, ok := provider.(*tokenProvider)
+		if !ok {
+			return nil
+		}
+		byteProvider.duplicateKeys = policy
+		return nil
+	}
+}
+
+// record where each value starts under ast.POSITION_META, e.g. for the tools that tell where a value of the template is
+func EnablePositions(provider astbuilder.TokenProvider) error {
+	byteProvider, ok := provider.(*tokenProvider)
+	if !ok {
+		return nil
+	}
+	byteProvider.positions = true
+	return nil
+}
+
 var _ astbuilder.ASTBuilder = &ASTByteBaseBuilder{}
+var _ astbuilder.PositionProvider = &ASTByteBaseBuilder{}
+var _ astbuilder.DocumentEndChecker = &ASTByteBaseBuilder{}
 
 // put the store to syntax symbol here, to decouple the relation of reader and writer
 func (t *ASTByteBaseBuilder) GetNextTokenType() (token.TokenType, error) {
@@ -30,11 +92,22 @@ func (t *ASTByteBaseBuilder) GetNextTokenType() (token.TokenType, error) {
 		return token.TOKEN_DUMMY, err
 	}
 
+	if t.trivia != nil {
+		t.recordTriviaBeforeSymbol(nextTokenType)
+	}
 	if token.IsSymbolToken(nextTokenType) { // note symbol token will be parse in the corresponding primitive value state
 		err = t.astConstructor.RecordSyntaxSymbol(nextTokenType)
 		if err != nil {
 			return token.TOKEN_DUMMY, err
 		}
+		if t.trivia != nil {
+			t.recordTriviaAfterSymbol(nextTokenType)
+		}
+		if t.provider.positions && (nextTokenType == token.TOKEN_LEFT_BRACE || nextTokenType == token.TOKEN_LEFT_BRACKET) {
+			if top, err := t.astConstructor.ast.TopElement(); err == nil {
+				top.SetMeta(ast.POSITION_META, t.provider.Position())
+			}
+		}
 	}
 
 	return nextTokenType, nil
@@ -64,8 +137,27 @@ func (t *ASTByteBaseBuilder) RecordSyntaxSymbol(b token.TokenType) error {
 }
 
 func (t *ASTByteBaseBuilder) RecordStateValue(valueType ast.AST_NODETYPE, nodeValue interface{}) error {
-	_, err := t.astConstructor.CreateNodeWithValue(valueType, nodeValue)
-	return err
+	if t.provider.duplicateKeys == ast.DUPLICATE_KEY_ALLOW && t.trivia == nil && !t.provider.positions {
+		_, err := t.astConstructor.CreateNodeWithValue(valueType, nodeValue)
+		return err
+	}
+	topType, _ := t.astConstructor.TopElementType()
+	node, err := t.astConstructor.CreateNodeWithValue(valueType, nodeValue)
+	if err != nil {
+		return err
+	}
+	switch {
+	case topType == ast.AST_OBJECT && (t.provider.duplicateKeys != ast.DUPLICATE_KEY_ALLOW || t.provider.positions): // the node is the kv pair of the key
+		node.SetMeta(ast.POSITION_META, t.provider.Position())
+	case topType == ast.AST_KVPAIR && t.provider.positions: // the node is the owner kv pair of the value
+		node.(*ast.JsonKeyValuePairNode).Value.SetMeta(ast.POSITION_META, t.provider.Position())
+	case t.provider.positions:
+		node.SetMeta(ast.POSITION_META, t.provider.Position())
+	}
+	if t.trivia != nil {
+		t.recordValueTrivia(node, topType)
+	}
+	return nil
 }
 
 func (i *ASTByteBaseBuilder) GetAST() ast.JsonNode {
@@ -83,3 +175,15 @@ func (i *ASTByteBaseBuilder) TopElementType() (ast.AST_NODETYPE, error) {
 func (i *ASTByteBaseBuilder) HasOpenElements() bool {
 	return i.astConstructor.HasOpenElements()
 }
+
+func (i *ASTByteBaseBuilder) Position() token.Position {
+	return i.provider.Position()
+}
+
+func (i *ASTByteBaseBuilder) CheckDocumentEnd() error {
+	err := i.provider.CheckDocumentEnd()
+	if err != nil || i.trivia == nil {
+		return err
+	}
+	return i.recordDocumentEnd()
+}
@@ -16,4 +16,19 @@ var (
 
 	ErrorIncorrectCharacter     = errors.New("incorrect character")
 	ErrorIncorrectValueForState = errors.New("extracted value not match state")
+	ErrorUnterminatedComment    = errors.New("comment is not closed by */")
+	ErrorRelaxedAndStrictMode   = errors.New("relaxed mode and strict mode cannot be enabled together")
+
+	ErrorStrictLeadingZero      = errors.New("number has leading zero")
+	ErrorStrictNumberFormat     = errors.New("number is not of RFC 8259 format")
+	ErrorStrictInvalidEscape    = errors.New("invalid escape sequence in string")
+	ErrorStrictLoneSurrogate    = errors.New("utf-16 surrogate is not paired in string")
+	ErrorStrictControlCharacter = errors.New("control character should be escaped in string")
+	ErrorStrictTrailingContent  = errors.New("unexpected content after the json value")
+
+	ErrorLimitDepth        = errors.New("nesting depth exceeds the limit")
+	ErrorLimitDocumentSize = errors.New("document size exceeds the limit")
+	ErrorLimitStringLength = errors.New("string length exceeds the limit")
+	ErrorLimitArrayLength  = errors.New("array length exceeds the limit")
+	ErrorLimitNegative     = errors.New("limit should not be negative")
 )
@@ -0,0 +1,152 @@
+package bytebase
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+// the limits enforced while reading a document, zero means no limit
+type Limits struct {
+	// nesting of arrays and objects
+	MaxDepth int
+	// bytes of the document
+	MaxDocumentSize int
+	// bytes of a string, an object key or a variable, without the quotation marks
+	MaxStringLength int
+	// elements of an array
+	MaxArrayLength int
+}
+
+// a limit is exceeded, Err is one of the ErrorLimit... errors
+type LimitError struct {
+	Err   error
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d", e.Err.Error(), e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+func WithLimits(limits Limits) astbuilder.TokenProviderOptions {
+	return func(provider astbuilder.TokenProvider) error {
+		byteProvider, ok := provider.(*tokenProvider)
+		if !ok {
+			return nil
+		}
+		if limits.MaxDepth < 0 || limits.MaxDocumentSize < 0 || limits.MaxStringLength < 0 || limits.MaxArrayLength < 0 {
+			return ErrorLimitNegative
+		}
+		byteProvider.limits = limits
+		byteProvider.limitDocumentSize(limits.MaxDocumentSize)
+		return nil
+	}
+}
+
+// the document is a part of a larger one, e.g. an included document: depth arrays and objects are open around it
+// and size bytes are read before it. the limits count from there, the option goes after WithLimits.
+func WithLimitsUsed(depth int, size int) astbuilder.TokenProviderOptions {
+	return func(provider astbuilder.TokenProvider) error {
+		byteProvider, ok := provider.(*tokenProvider)
+		if !ok {
+			return nil
+		}
+		byteProvider.usedDepth = depth
+		byteProvider.limitDocumentSize(max(byteProvider.limits.MaxDocumentSize-size, 0))
+		return nil
+	}
+}
+
+// no more than remaining bytes are read, the error names the limit of the document
+func (t *tokenProvider) limitDocumentSize(remaining int) {
+	if t.limits.MaxDocumentSize <= 0 {
+		return
+	}
+	sizeError := &LimitError{Err: ErrorLimitDocumentSize, Limit: t.limits.MaxDocumentSize}
+	switch source := t.dataSource.(type) {
+	case *sliceSource:
+		source.truncate(remaining, sizeError)
+	case *bufio.Reader:
+		t.dataSource = bufio.NewReader(&sizeLimitedReader{reader: source, remaining: remaining, err: sizeError})
+	}
+}
+
+// fails once the reader gives more than the limit
+type sizeLimitedReader struct {
+	reader    io.Reader
+	remaining int
+	err       error
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.remaining+1 {
+		p = p[:r.remaining+1] // one more byte tells if the document is too large
+	}
+	n, err := r.reader.Read(p)
+	if n > r.remaining {
+		n = r.remaining
+		r.remaining = 0
+		return n, r.err
+	}
+	r.remaining -= n
+	return n, err
+}
+
+// the arrays and objects that are not closed, for the depth and array length limits
+type openCollection struct {
+	isArray  bool
+	elements int
+}
+
+// the values are counted rather than the commas, a trailing comma is not an element
+func (t *tokenProvider) trackCollection(tokenType token.TokenType) error {
+	switch tokenType {
+	case token.TOKEN_STRING, token.TOKEN_NUMBER, token.TOKEN_BOOLEAN, token.TOKEN_NULL, token.TOKEN_VARIABLE:
+		return t.countElement()
+	case token.TOKEN_LEFT_BRACE, token.TOKEN_LEFT_BRACKET:
+		err := t.countElement()
+		if err != nil {
+			return err
+		}
+		if t.limits.MaxDepth > 0 && t.usedDepth+len(t.openCollections) >= t.limits.MaxDepth {
+			return &LimitError{Err: ErrorLimitDepth, Limit: t.limits.MaxDepth}
+		}
+		t.openCollections = append(t.openCollections, openCollection{isArray: tokenType == token.TOKEN_LEFT_BRACKET})
+	case token.TOKEN_RIGHT_BRACE, token.TOKEN_RIGHT_BRACKET:
+		if len(t.openCollections) > 0 {
+			t.openCollections = t.openCollections[:len(t.openCollections)-1]
+		}
+	}
+	return nil
+}
+
+// a value in an array is one more element, in an object it is a key or a member value
+func (t *tokenProvider) countElement() error {
+	if len(t.openCollections) == 0 {
+		return nil
+	}
+	top := &t.openCollections[len(t.openCollections)-1]
+	if !top.isArray {
+		return nil
+	}
+	top.elements += 1
+	if t.limits.MaxArrayLength > 0 && top.elements > t.limits.MaxArrayLength {
+		return &LimitError{Err: ErrorLimitArrayLength, Limit: t.limits.MaxArrayLength}
+	}
+	return nil
+}
+
+// length is with the quotation marks of the string
+func (t *tokenProvider) checkStringLength(length int) error {
+	if t.limits.MaxStringLength > 0 && length-2 > t.limits.MaxStringLength {
+		return &LimitError{Err: ErrorLimitStringLength, Limit: t.limits.MaxStringLength}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package bytebase
+
+import (
+	"bytes"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/token"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// lossless mode keeps the spaces, and the comments in relaxed mode, as the ast.Trivia of the nodes,
+// together with the text of the values as written, so that the document can be written back byte for byte.
+func EnableLosslessMode(provider astbuilder.TokenProvider) error {
+	byteProvider, ok := provider.(*tokenProvider)
+	if !ok {
+		return nil
+	}
+	byteProvider.lossless = true
+	return nil
+}
+
+// the bytes consumed since the last call
+func (t *tokenProvider) takeRecorded() []byte {
+	rs := t.recorded
+	t.recorded = nil
+	return rs
+}
+
+// lossless mode, the spaces after the json value are consumed, the content after them is left as it is
+func (t *tokenProvider) readDocumentEnd() error {
+	for {
+		b, err := t.dataSource.ReadByte()
+		if err != nil {
+			return nil
+		}
+		if t.relaxed && b == '/' {
+			_, _, err = t.skipComment()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !util.IsSpaces(b) {
+			return t.dataSource.UnreadByte()
+		}
+		t.advance([]byte{b})
+	}
+}
+
+// where the text between the tokens goes, see ast.Trivia
+type triviaRecorder struct {
+	// the spaces and comments not given to a node yet
+	pending []byte
+	// the latest value or key, the spaces before a `,` or `:` are its trailing
+	lastNode   ast.JsonNode
+	lastSymbol token.TokenType
+	// the node before the latest `,`
+	commaNode ast.JsonNode
+}
+
+func (r *triviaRecorder) takePending() []byte {
+	rs := r.pending
+	r.pending = nil
+	return rs
+}
+
+// the leading of the next node, after a `,` the spaces and comments up to the end of the line
+// stay with the node before the comma, so that they go along with it when it is deleted
+func (r *triviaRecorder) takeLeading() []byte {
+	pending := r.takePending()
+	if r.lastSymbol != token.TOKEN_COMMA || r.commaNode == nil {
+		return pending
+	}
+	i := bytes.IndexByte(pending, '\n')
+	if i < 0 {
+		return pending
+	}
+	triviaOf(r.commaNode).Comma = pending[:i]
+	return pending[i:]
+}
+
+func triviaOf(node ast.JsonNode) *ast.Trivia {
+	trivia := ast.TriviaOf(node)
+	if trivia == nil {
+		trivia = ast.NewTrivia(node, nil, nil)
+		node.SetMeta(ast.TRIVIA_META, trivia)
+	}
+	return trivia
+}
+
+// the trivia before a symbol, the closing symbols take it before the collection is enclosed
+func (t *ASTByteBaseBuilder) recordTriviaBeforeSymbol(tokenType token.TokenType) {
+	recorder := t.trivia
+	switch tokenType {
+	case token.TOKEN_SPACE, token.TOKEN_DROP:
+		recorder.pending = append(recorder.pending, t.provider.takeRecorded()...)
+		return
+	case token.TOKEN_COMMA, token.TOKEN_COLON:
+		if recorder.lastNode != nil {
+			triviaOf(recorder.lastNode).Trailing = recorder.takePending()
+		}
+		recorder.commaNode = recorder.lastNode
+	case token.TOKEN_LEFT_BRACE, token.TOKEN_LEFT_BRACKET:
+		recorder.pending = recorder.takeLeading()
+	case token.TOKEN_RIGHT_BRACE, token.TOKEN_RIGHT_BRACKET:
+		top, err := t.astConstructor.ast.TopElement()
+		if err == nil {
+			trivia := triviaOf(top)
+			trivia.Closing = recorder.takeLeading()
+			trivia.TrailingComma = recorder.lastSymbol == token.TOKEN_COMMA
+			recorder.lastNode = top
+		}
+	default: // the values are recorded when they are read
+		return
+	}
+	t.provider.takeRecorded() // the symbol itself
+	recorder.lastSymbol = tokenType
+}
+
+// the opening symbols take the trivia before them, once the collection is created
+func (t *ASTByteBaseBuilder) recordTriviaAfterSymbol(tokenType token.TokenType) {
+	if tokenType != token.TOKEN_LEFT_BRACE && tokenType != token.TOKEN_LEFT_BRACKET {
+		return
+	}
+	top, err := t.astConstructor.ast.TopElement()
+	if err != nil {
+		return
+	}
+	top.SetMeta(ast.TRIVIA_META, ast.NewTrivia(top, t.trivia.takePending(), nil))
+	t.trivia.lastNode = top
+}
+
+// node is the kv pair when the value is a key, or the owner kv pair when the value is the value of a kv pair
+func (t *ASTByteBaseBuilder) recordValueTrivia(node ast.JsonNode, ownerType ast.AST_NODETYPE) {
+	switch ownerType {
+	case ast.AST_OBJECT:
+		node = node.(*ast.JsonKeyValuePairNode).Key
+	case ast.AST_KVPAIR:
+		node = node.(*ast.JsonKeyValuePairNode).Value
+	}
+	node.SetMeta(ast.TRIVIA_META, ast.NewTrivia(node, t.trivia.takeLeading(), t.provider.takeRecorded()))
+	t.trivia.lastNode = node
+	t.trivia.lastSymbol = token.TOKEN_DUMMY
+}
+
+// the spaces after the json value are the trailing of the root
+func (t *ASTByteBaseBuilder) recordDocumentEnd() error {
+	err := t.provider.readDocumentEnd()
+	if err != nil {
+		return err
+	}
+	root := t.astConstructor.GetAST()
+	if root == nil {
+		return nil
+	}
+	t.trivia.pending = append(t.trivia.pending, t.provider.takeRecorded()...)
+	triviaOf(root).Trailing = t.trivia.takePending()
+	return nil
+}
@@ -0,0 +1,217 @@
+package bytebase
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+// relaxed mode accepts the JSON5 leniencies on top of json and the `${}` extension:
+// `//` and `/* */` comments, identifier keys, single-quoted strings, hex numbers, leading `+` or `.`,
+// trailing `.`, Infinity, NaN and a trailing comma in arrays and objects.
+func EnableRelaxedMode(provider astbuilder.TokenProvider) error {
+	byteProvider, ok := provider.(*tokenProvider)
+	if !ok {
+		return nil
+	}
+	if byteProvider.strict {
+		return ErrorRelaxedAndStrictMode
+	}
+	byteProvider.relaxed = true
+	return nil
+}
+
+func isIdentifierStart(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || b == '$' || b >= 0x80
+}
+
+func isIdentifierByte(b byte) bool {
+	return isIdentifierStart(b) || (b >= '0' && b <= '9')
+}
+
+func isRelaxedNumberByte(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '.' || b == '+' || b == '-'
+}
+
+// the token types that only exist in relaxed mode, handled is false for the bytes that are the same as json
+func (t *tokenProvider) relaxedTokenType(b byte) (tokenType token.TokenType, handled bool, err error) {
+	switch {
+	case b == '/':
+		return t.skipComment()
+	case t.isKeyPosition != nil && t.isKeyPosition() && isIdentifierStart(b):
+		err := t.dataSource.UnreadByte()
+		if err != nil {
+			return token.TOKEN_DUMMY, true, err
+		}
+		if b == '$' {
+			next, err := t.dataSource.Peek(2)
+			if err == nil && next[1] == '{' {
+				return token.TOKEN_VARIABLE, true, nil // `${` is a variable
+			}
+		}
+		t.pendingIdentifier = true
+		return token.TOKEN_STRING, true, nil
+	case b == '\'':
+		return token.TOKEN_STRING, true, t.dataSource.UnreadByte()
+	case b == '+' || b == '.' || b == 'I' || b == 'N':
+		return token.TOKEN_NUMBER, true, t.dataSource.UnreadByte()
+	}
+	return token.TOKEN_DUMMY, false, nil
+}
+
+// the `/` has been read, a comment is consumed as spaces
+func (t *tokenProvider) skipComment() (token.TokenType, bool, error) {
+	next, err := t.dataSource.ReadByte()
+	if err != nil {
+		return token.TOKEN_DUMMY, true, err
+	}
+	consumed := []byte{'/', next}
+	switch next {
+	case '/':
+		line, err := t.dataSource.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return token.TOKEN_DUMMY, true, err
+		}
+		consumed = append(consumed, line...)
+	case '*':
+		for {
+			part, err := t.dataSource.ReadBytes('/')
+			if err != nil {
+				if err == io.EOF {
+					return token.TOKEN_DUMMY, true, ErrorUnterminatedComment
+				}
+				return token.TOKEN_DUMMY, true, err
+			}
+			consumed = append(consumed, part...)
+			if len(consumed) >= 4 && consumed[len(consumed)-2] == '*' {
+				break
+			}
+		}
+	default:
+		return token.TOKEN_DUMMY, true, ErrorIncorrectCharacter
+	}
+	t.advance(consumed)
+	return token.TOKEN_SPACE, true, nil
+}
+
+// an identifier key is returned as a json string
+func (t *tokenProvider) readIdentifier() ([]byte, error) {
+	t.pendingIdentifier = false
+	consumed := make([]byte, 0)
+	for {
+		next, err := t.dataSource.Peek(1)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF || !isIdentifierByte(next[0]) {
+			break
+		}
+		b, _ := t.dataSource.ReadByte()
+		consumed = append(consumed, b)
+		err = t.checkStringLength(len(consumed) + 2)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.advance(consumed)
+	rs := make([]byte, 0, len(consumed)+2)
+	rs = append(rs, '"')
+	rs = append(rs, consumed...)
+	return append(rs, '"'), nil
+}
+
+// a single-quoted string is returned as a json string
+func (t *tokenProvider) readSingleQuotedString() ([]byte, error) {
+	quote, err := t.dataSource.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	consumed := []byte{quote}
+	rs := []byte{'"'}
+	escaped := false
+	for {
+		b, err := t.dataSource.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		consumed = append(consumed, b)
+		err = t.checkStringLength(len(consumed))
+		if err != nil {
+			return nil, err
+		}
+		if escaped {
+			escaped = false
+			if b == '\'' {
+				rs = append(rs, '\'')
+			} else {
+				rs = append(rs, '\\', b)
+			}
+			continue
+		}
+		switch b {
+		case '\\':
+			escaped = true
+		case '"':
+			rs = append(rs, '\\', '"')
+		case '\'':
+			t.advance(consumed)
+			return append(rs, '"'), nil
+		default:
+			rs = append(rs, b)
+		}
+	}
+}
+
+func (t *tokenProvider) readRelaxedNumber() (interface{}, error) {
+	consumed := make([]byte, 0)
+	for {
+		next, err := t.dataSource.Peek(1)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if err == io.EOF || !isRelaxedNumberByte(next[0]) {
+			break
+		}
+		b, _ := t.dataSource.ReadByte()
+		consumed = append(consumed, b)
+	}
+	t.advance(consumed)
+	return parseRelaxedNumber(consumed)
+}
+
+func parseRelaxedNumber(number []byte) (float64, error) {
+	sign := 1.0
+	body := number
+	if len(body) > 0 && (body[0] == '+' || body[0] == '-') {
+		if body[0] == '-' {
+			sign = -1.0
+		}
+		body = body[1:]
+	}
+	switch {
+	case bytes.Equal(body, []byte("Infinity")):
+		return math.Inf(int(sign)), nil
+	case bytes.Equal(body, []byte("NaN")):
+		return math.NaN(), nil
+	case len(body) > 2 && body[0] == '0' && (body[1] == 'x' || body[1] == 'X'):
+		u64, err := strconv.ParseUint(string(body[2:]), 16, 64)
+		if err != nil {
+			return 0, ErrorIncorrectValueForState
+		}
+		return sign * float64(u64), nil
+	}
+	// ParseFloat would take `inf`, `0x1p-2` and `1_000` which are not JSON5 numbers
+	if bytes.ContainsAny(body, "_xXpPiInN") || strings.HasPrefix(string(body), "+") || strings.HasPrefix(string(body), "-") {
+		return 0, ErrorIncorrectValueForState
+	}
+	f64, err := strconv.ParseFloat(string(body), 64)
+	if err != nil {
+		return 0, ErrorIncorrectValueForState
+	}
+	return sign * f64, nil
+}
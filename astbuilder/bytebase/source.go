@@ -0,0 +1,109 @@
+package bytebase
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// what the token provider reads from: a *bufio.Reader for an io.Reader, a *sliceSource for a document in memory.
+// the bytes given by Peek and ReadSlice are only valid till the next read.
+type byteSource interface {
+	ReadByte() (byte, error)
+	UnreadByte() error
+	Peek(n int) ([]byte, error)
+	Discard(n int) (int, error)
+	ReadSlice(delim byte) ([]byte, error)
+	ReadBytes(delim byte) ([]byte, error)
+}
+
+var _ byteSource = &bufio.Reader{}
+var _ byteSource = &sliceSource{}
+
+// reads a document in memory in place of a bufio.Reader, the bytes it gives are sub slices of the document and stay valid
+type sliceSource struct {
+	data   []byte
+	offset int
+	// io.EOF, or the limit error when the document is larger than the limit
+	endErr error
+}
+
+func newSliceSource(data []byte) *sliceSource {
+	return &sliceSource{data: data, endErr: io.EOF}
+}
+
+// the bytes after size are not read, reading there fails with err
+func (s *sliceSource) truncate(size int, err error) {
+	if len(s.data) > size {
+		s.data = s.data[:size]
+		s.endErr = err
+	}
+}
+
+func (s *sliceSource) ReadByte() (byte, error) {
+	if s.offset >= len(s.data) {
+		return 0, s.endErr
+	}
+	b := s.data[s.offset]
+	s.offset += 1
+	return b, nil
+}
+
+func (s *sliceSource) UnreadByte() error {
+	if s.offset == 0 {
+		return bufio.ErrInvalidUnreadByte
+	}
+	s.offset -= 1
+	return nil
+}
+
+func (s *sliceSource) Peek(n int) ([]byte, error) {
+	if s.offset+n > len(s.data) {
+		return s.data[s.offset:], s.endErr
+	}
+	return s.data[s.offset : s.offset+n], nil
+}
+
+func (s *sliceSource) Discard(n int) (int, error) {
+	if s.offset+n > len(s.data) {
+		n = len(s.data) - s.offset
+		s.offset = len(s.data)
+		return n, s.endErr
+	}
+	s.offset += n
+	return n, nil
+}
+
+func (s *sliceSource) ReadSlice(delim byte) ([]byte, error) {
+	i := bytes.IndexByte(s.data[s.offset:], delim)
+	if i < 0 {
+		rs := s.data[s.offset:]
+		s.offset = len(s.data)
+		return rs, s.endErr
+	}
+	rs := s.data[s.offset : s.offset+i+1]
+	s.offset += i + 1
+	return rs, nil
+}
+
+func (s *sliceSource) ReadBytes(delim byte) ([]byte, error) {
+	return s.ReadSlice(delim)
+}
+
+// the string with its quotation marks, from the quotation mark at the offset to the next one that is not escaped
+func (s *sliceSource) readString() ([]byte, error) {
+	start := s.offset
+	end := start + 1
+	for {
+		i := bytes.IndexByte(s.data[end:], '"')
+		if i < 0 {
+			s.offset = len(s.data)
+			return nil, s.endErr
+		}
+		end += i + 1
+		if !isEscapedQuotation(s.data[start:end]) {
+			s.offset = end
+			return s.data[start:end], nil
+		}
+	}
+}
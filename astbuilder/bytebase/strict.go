@@ -0,0 +1,191 @@
+package bytebase
+
+import (
+	"io"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+// strict mode accepts RFC 8259 json only (plus the `${}` extension): no leading zeros, no invalid escapes,
+// no lone surrogates, no unescaped control characters, no trailing commas and nothing after the json value.
+func EnableStrictMode(provider astbuilder.TokenProvider) error {
+	byteProvider, ok := provider.(*tokenProvider)
+	if !ok {
+		return nil
+	}
+	if byteProvider.relaxed {
+		return ErrorRelaxedAndStrictMode
+	}
+	byteProvider.strict = true
+	return nil
+}
+
+// the whitespace of RFC 8259, util.IsSpaces also takes \v and \f
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// move the position of the latest token to the offending byte, the token has no line break before the byte.
+func (t *tokenProvider) failAt(index int, err error) error {
+	t.tokenStart.Offset += index
+	t.tokenStart.Column += index
+	return err
+}
+
+// the checks on the token type that only exist in strict mode
+func (t *tokenProvider) strictTokenType(b byte, tokenType token.TokenType) error {
+	switch tokenType {
+	case token.TOKEN_SPACE:
+		if !isJSONSpace(b) {
+			return ErrorIncorrectCharacter
+		}
+		return nil
+	case token.TOKEN_RIGHT_BRACE, token.TOKEN_RIGHT_BRACKET:
+		if t.lastToken == token.TOKEN_COMMA {
+			t.tokenStart = t.lastTokenStart
+			return ErrorSyntaxCommaBehindLastItem
+		}
+	}
+	t.lastToken = tokenType
+	t.lastTokenStart = t.tokenStart
+	return nil
+}
+
+// -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func validateStrictNumber(number []byte) (int, error) {
+	i := 0
+	if i < len(number) && number[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(number) && number[i] == '0':
+		i++
+		if i < len(number) && isDigit(number[i]) {
+			return i - 1, ErrorStrictLeadingZero
+		}
+	case i < len(number) && isDigit(number[i]):
+		for i < len(number) && isDigit(number[i]) {
+			i++
+		}
+	default:
+		return i, ErrorStrictNumberFormat
+	}
+	if i < len(number) && number[i] == '.' {
+		i++
+		if i >= len(number) || !isDigit(number[i]) {
+			return i, ErrorStrictNumberFormat
+		}
+		for i < len(number) && isDigit(number[i]) {
+			i++
+		}
+	}
+	if i < len(number) && (number[i] == 'e' || number[i] == 'E') {
+		i++
+		if i < len(number) && (number[i] == '+' || number[i] == '-') {
+			i++
+		}
+		if i >= len(number) || !isDigit(number[i]) {
+			return i, ErrorStrictNumberFormat
+		}
+		for i < len(number) && isDigit(number[i]) {
+			i++
+		}
+	}
+	if i != len(number) {
+		return i, ErrorStrictNumberFormat
+	}
+	return 0, nil
+}
+
+func readHex4(s []byte, at int) (rune, bool) {
+	if at+4 > len(s) {
+		return 0, false
+	}
+	var r rune
+	for _, b := range s[at : at+4] {
+		if !isHexDigit(b) {
+			return 0, false
+		}
+		switch {
+		case isDigit(b):
+			r = r<<4 | rune(b-'0')
+		case b >= 'a':
+			r = r<<4 | rune(b-'a'+10)
+		default:
+			r = r<<4 | rune(b-'A'+10)
+		}
+	}
+	return r, true
+}
+
+// the string is with its double quotation marks
+func validateStrictString(s []byte) (int, error) {
+	end := len(s) - 1
+	for i := 1; i < end; {
+		b := s[i]
+		if b < 0x20 {
+			return i, ErrorStrictControlCharacter
+		}
+		if b != '\\' {
+			i++
+			continue
+		}
+		switch s[i+1] {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			i += 2
+		case 'u':
+			r, ok := readHex4(s[:end], i+2)
+			if !ok {
+				return i, ErrorStrictInvalidEscape
+			}
+			switch {
+			case r >= 0xD800 && r <= 0xDBFF: // high surrogate, the low one must follow
+				if i+8 > end || s[i+6] != '\\' || s[i+7] != 'u' {
+					return i, ErrorStrictLoneSurrogate
+				}
+				low, ok := readHex4(s[:end], i+8)
+				if !ok || low < 0xDC00 || low > 0xDFFF {
+					return i, ErrorStrictLoneSurrogate
+				}
+				i += 12
+			case r >= 0xDC00 && r <= 0xDFFF:
+				return i, ErrorStrictLoneSurrogate
+			default:
+				i += 6
+			}
+		default:
+			return i, ErrorStrictInvalidEscape
+		}
+	}
+	return 0, nil
+}
+
+// only spaces are allowed after the json value
+func (t *tokenProvider) CheckDocumentEnd() error {
+	if !t.strict {
+		return nil
+	}
+	for {
+		b, err := t.dataSource.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isJSONSpace(b) {
+			t.tokenStart = t.currentPosition()
+			return ErrorStrictTrailingContent
+		}
+		t.advance([]byte{b})
+	}
+}
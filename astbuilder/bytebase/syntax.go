@@ -8,6 +8,8 @@ import (
 type syntaxChecker struct {
 	syntaxState *util.Stack[byte]
 	length      int
+	// relaxed mode, `[1,2,]` and `{"a":1,}` are accepted
+	allowTrailingComma bool
 }
 
 func newSyntaxChecker() *syntaxChecker {
@@ -43,6 +45,12 @@ func (s *syntaxChecker) Enclose(b byte) error {
 	if t != b {
 		return ErrorSyntaxEncloseSymbolNotMatch
 	}
+	if s.allowTrailingComma {
+		err = s.dropTrailingComma()
+		if err != nil {
+			return err
+		}
+	}
 	if t == ']' {
 		return s.jsonArrayFormatCheck()
 	} else if t == '}' {
@@ -52,6 +60,20 @@ func (s *syntaxChecker) Enclose(b byte) error {
 	}
 }
 
+// the comma before the closing symbol is dropped, but a collection holding only a comma is still invalid
+func (s *syntaxChecker) dropTrailingComma() error {
+	t, err := s.syntaxState.Peek()
+	if err != nil || t != ',' {
+		return nil
+	}
+	s.syntaxState.Pop()
+	t, err = s.syntaxState.Peek()
+	if err == nil && (t == '[' || t == '{') {
+		return ErrorSyntaxCommaBehindLastItem
+	}
+	return nil
+}
+
 func (s *syntaxChecker) jsonArrayFormatCheck() error {
 	expectingValue := true
 	lastIsValue := false
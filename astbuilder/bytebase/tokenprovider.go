@@ -5,22 +5,92 @@ import (
 	"io"
 	"strconv"
 
+	"github.com/jaksonlin/go-jsonextend/ast"
 	"github.com/jaksonlin/go-jsonextend/astbuilder"
 	"github.com/jaksonlin/go-jsonextend/token"
 )
 
 type tokenProvider struct {
-	dataSource     *bufio.Reader
+	dataSource     byteSource
 	CurrentOffset  int
 	LastReadLength int // this can give us the correct startoffset of current element
+	line           int
+	column         int
+	tokenStart     token.Position // where the latest token starts
+	relaxed        bool
+	strict         bool
+	// relaxed mode, set when an identifier key is found, the key is then read by ReadString
+	pendingIdentifier bool
+	// tells if the next token is an object key, set by the builder
+	isKeyPosition func() bool
+	// strict mode, the latest token that is not space, to find the trailing comma
+	lastToken       token.TokenType
+	lastTokenStart  token.Position
+	limits          Limits
+	openCollections []openCollection
+	// the arrays and objects open around the document, see WithLimitsUsed
+	usedDepth     int
+	duplicateKeys ast.DuplicateKeyPolicy
+	// lossless mode, the bytes consumed since the builder takes them
+	lossless bool
+	recorded []byte
+	// the builder records the position of each value
+	positions bool
 }
 
 func newTokenProvider(reader io.Reader) *tokenProvider {
+	return newTokenProviderFromSource(bufio.NewReader(reader))
+}
+
+func newTokenProviderFromSource(source byteSource) *tokenProvider {
 	return &tokenProvider{
-		dataSource: bufio.NewReader(reader),
+		dataSource: source,
+		line:       1,
+		column:     1,
+		tokenStart: token.Position{Line: 1, Column: 1},
 	}
 }
 
+// the next n bytes, valid till the next read
+func (t *tokenProvider) take(n int) ([]byte, error) {
+	rs, err := t.dataSource.Peek(n)
+	if err != nil {
+		return nil, err
+	}
+	_, err = t.dataSource.Discard(n)
+	if err != nil {
+		return nil, err
+	}
+	t.advance(rs)
+	return rs, nil
+}
+
+// move the current location over the consumed bytes
+func (t *tokenProvider) advance(consumed []byte) {
+	t.LastReadLength = len(consumed)
+	t.CurrentOffset += t.LastReadLength
+	if t.lossless {
+		t.recorded = append(t.recorded, consumed...)
+	}
+	for _, b := range consumed {
+		if b == '\n' {
+			t.line += 1
+			t.column = 1
+		} else {
+			t.column += 1
+		}
+	}
+}
+
+func (t *tokenProvider) currentPosition() token.Position {
+	return token.Position{Offset: t.CurrentOffset, Line: t.line, Column: t.column}
+}
+
+// the position of the latest token
+func (t *tokenProvider) Position() token.Position {
+	return t.tokenStart
+}
+
 var _ astbuilder.TokenProvider = &tokenProvider{}
 
 func (t *tokenProvider) ReadBool() (bool, error) {
@@ -39,16 +109,11 @@ func (t *tokenProvider) ReadBool() (bool, error) {
 		return false, ErrorIncorrectCharacter
 	}
 
-	rs := make([]byte, numberOfRead)
-
-	_, err = io.ReadFull(t.dataSource, rs)
+	rs, err := t.take(numberOfRead)
 	if err != nil {
 		return false, err
 	}
 
-	t.LastReadLength = numberOfRead
-	t.CurrentOffset += t.LastReadLength
-
 	rsBoolean, err := strconv.ParseBool(string(rs))
 	if err != nil {
 		return false, ErrorIncorrectValueForState
@@ -58,12 +123,33 @@ func (t *tokenProvider) ReadBool() (bool, error) {
 
 func (t *tokenProvider) GetNextTokenType() (token.TokenType, error) {
 
+	t.tokenStart = t.currentPosition()
 	nextByte, err := t.dataSource.ReadByte()
 	if err != nil {
 		return token.TOKEN_DUMMY, err
 	}
+	if t.relaxed {
+		tokenType, handled, err := t.relaxedTokenType(nextByte)
+		if handled {
+			if err != nil {
+				return tokenType, err
+			}
+			return tokenType, t.trackCollection(tokenType)
+		}
+	}
 
 	nextTokenType := GetTokenTypeByStartCharacter(nextByte)
+	if t.strict {
+		err = t.strictTokenType(nextByte, nextTokenType)
+		if err != nil {
+			return token.TOKEN_DUMMY, err
+		}
+	}
+
+	err = t.trackCollection(nextTokenType)
+	if err != nil {
+		return token.TOKEN_DUMMY, err
+	}
 
 	if ShouldUnreadByte(nextTokenType) {
 		err = t.dataSource.UnreadByte()
@@ -71,21 +157,17 @@ func (t *tokenProvider) GetNextTokenType() (token.TokenType, error) {
 			return token.TOKEN_DUMMY, err
 		}
 	} else {
-		t.LastReadLength = 1
-		t.CurrentOffset += t.LastReadLength
+		t.advance([]byte{nextByte})
 	}
 
 	return nextTokenType, nil
 }
 
 func (t *tokenProvider) ReadNull() error {
-	rs := make([]byte, 4)
-	_, err := io.ReadFull(t.dataSource, rs)
+	rs, err := t.take(4)
 	if err != nil {
 		return err
 	}
-	t.LastReadLength = 4
-	t.CurrentOffset += t.LastReadLength
 	if string(rs) != "null" {
 		return ErrorIncorrectValueForState
 	}
@@ -94,6 +176,9 @@ func (t *tokenProvider) ReadNull() error {
 }
 
 func (t *tokenProvider) ReadNumber() (interface{}, error) {
+	if t.relaxed {
+		return t.readRelaxedNumber()
+	}
 	lengthOfNumber := 1
 	for {
 		nextByte, err := t.dataSource.Peek(lengthOfNumber)
@@ -112,13 +197,16 @@ func (t *tokenProvider) ReadNumber() (interface{}, error) {
 		lengthOfNumber += 1
 	}
 
-	result := make([]byte, lengthOfNumber)
-	_, err := io.ReadFull(t.dataSource, result)
+	result, err := t.take(lengthOfNumber)
 	if err != nil {
 		return 0, err
 	}
-	t.LastReadLength = lengthOfNumber
-	t.CurrentOffset += t.LastReadLength
+	if t.strict {
+		index, err := validateStrictNumber(result)
+		if err != nil {
+			return 0, t.failAt(index, err)
+		}
+	}
 	f64, err := strconv.ParseFloat(string(result), 64)
 	if err != nil {
 		return 0, ErrorIncorrectValueForState
@@ -127,49 +215,106 @@ func (t *tokenProvider) ReadNumber() (interface{}, error) {
 }
 
 func (t *tokenProvider) ReadString() ([]byte, error) {
+	if t.relaxed {
+		if t.pendingIdentifier {
+			return t.readIdentifier()
+		}
+		next, err := t.dataSource.Peek(1)
+		if err == nil && next[0] == '\'' {
+			return t.readSingleQuotedString()
+		}
+	}
 
-	// in order to deal with the multiple slash/escape sequence, we need a flag to check the string state
-	isSlashEnclosed := true
-	stringLength := 1
-	validQuotationCount := 0
+	var rs []byte
+	var err error
+	if source, ok := t.dataSource.(*sliceSource); ok {
+		rs, err = source.readString() // a sub slice of the document
+	} else {
+		rs, err = t.readBufferedString()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = t.checkStringLength(len(rs))
+	if err != nil {
+		return nil, err
+	}
+	t.advance(rs)
+	if t.strict {
+		index, err := validateStrictString(rs)
+		if err != nil {
+			return nil, t.failAt(index, err)
+		}
+	}
+	return rs, nil
+}
+
+// the string is copied out of the buffer chunk by chunk, so that a string can be longer than the buffer
+func (t *tokenProvider) readBufferedString() ([]byte, error) {
+	quotation, err := t.dataSource.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	rs := []byte{quotation}
 	for {
-		nextByte, err := t.dataSource.Peek(stringLength)
+		chunk, err := t.dataSource.ReadSlice('"')
+		rs = append(rs, chunk...)
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		err = t.checkStringLength(len(rs))
 		if err != nil {
 			return nil, err
 		}
-
-		// slashes are closed
-		if isSlashEnclosed {
-			// is double quotation mark, end of string
-			if nextByte[stringLength-1] == '"' {
-				validQuotationCount += 1
-				if validQuotationCount == 2 {
-					rs := make([]byte, stringLength)
-					_, err := io.ReadFull(t.dataSource, rs)
-					if err != nil {
-						return nil, err
-					}
-					t.LastReadLength = stringLength
-					t.CurrentOffset += t.LastReadLength
-					return rs, nil
-				}
-			} else if nextByte[stringLength-1] == 0x5c { // is slash
-				isSlashEnclosed = false
-			}
-		} else {
-			isSlashEnclosed = true // flip the slash when there's nextByte, in escape mode skip quotation count check
+		if rs[len(rs)-1] == '"' && !isEscapedQuotation(rs) {
+			return rs, nil
 		}
-		stringLength += 1
+	}
+}
 
+// the last quotation mark is escaped when there are odd number of slashes in front of it
+func isEscapedQuotation(s []byte) bool {
+	slashes := 0
+	for i := len(s) - 2; i > 0 && s[i] == '\\'; i-- {
+		slashes += 1
 	}
+	return slashes%2 == 1
 }
 
 func (t *tokenProvider) ReadVariable() ([]byte, error) {
-	variable, err := t.dataSource.ReadBytes('}')
+	var variable []byte
+	var err error
+	if source, ok := t.dataSource.(*sliceSource); ok {
+		variable, err = source.ReadBytes('}') // a sub slice of the document
+	} else {
+		variable, err = t.readBufferedVariable()
+	}
 	if err != nil {
 		return nil, err
 	}
-	t.LastReadLength = len(variable)
-	t.CurrentOffset += t.LastReadLength
+	err = t.checkStringLength(len(variable) - 1) // `${` and `}`
+	if err != nil {
+		return nil, err
+	}
+	t.advance(variable)
 	return variable, nil
 }
+
+// the variable is copied out of the buffer chunk by chunk as the string, the length limit is checked on each chunk
+func (t *tokenProvider) readBufferedVariable() ([]byte, error) {
+	rs := make([]byte, 0)
+	for {
+		chunk, err := t.dataSource.ReadSlice('}')
+		rs = append(rs, chunk...)
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if err == nil {
+			return rs, nil
+		}
+		err = t.checkStringLength(len(rs) - 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -14,4 +14,5 @@ var (
 	ErrorInvalidJsonTag                       = errors.New("invalid json tag")
 	ErrorStringConfigTypeInvalid              = errors.New("json tag string config only support pritmive data type")
 	ErrorIncorrectSyntaxSymbolForConstructAST = errors.New("incorrect character for construct ast")
+	ErrorEncodedValueInvalid                  = errors.New("encoder wrote more than one json value")
 )
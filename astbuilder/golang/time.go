@@ -0,0 +1,47 @@
+package golang
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// write time.Duration as its nanoseconds, rather than a duration string like "1m30s"
+func EnableDurationAsNanoseconds(provider astbuilder.TokenProvider) error {
+	if goProvider, ok := provider.(*tokenProvider); ok {
+		goProvider.durationAsNanoseconds = true
+	}
+	return nil
+}
+
+// write time.Time as RFC 3339, or the layout of its `jsonext:"time=..."` tag, and time.Duration as a duration string
+func (t *tokenProvider) encodeTime(item *workingItem) {
+	switch item.reflectValue.Type() {
+	case timeType:
+		if !item.reflectValue.CanInterface() {
+			return
+		}
+		layout := time.RFC3339Nano
+		if item.extendOptions != nil && item.extendOptions.TimeLayout != "" {
+			layout = item.extendOptions.TimeLayout
+		}
+		item.reflectValue = reflect.ValueOf(item.reflectValue.Interface().(time.Time).Format(layout))
+	case durationType:
+		if t.durationAsNanoseconds {
+			return
+		}
+		item.reflectValue = reflect.ValueOf(time.Duration(item.reflectValue.Int()).String())
+	default:
+		return
+	}
+	item.tokenType = token.TOKEN_STRING
+	item.address = 0
+	item.encoded = true
+}
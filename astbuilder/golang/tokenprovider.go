@@ -1,7 +1,9 @@
 package golang
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -22,6 +24,7 @@ type workingItem struct {
 	tagOptions    *util.JsonTagOptions
 	extendOptions *util.JsonExtendOptions
 	hasInterface  bool // whether the value is wrapped by interface{}, if yes the json string tag option should not apply
+	encoded       bool // the value comes from an encoder, the encoders are not applied again
 }
 
 // manage all the json tag options here using meta and plugin, instead of throwing them around the core logic
@@ -59,10 +62,25 @@ func (w *workingItem) SetMetaAndPlugins(node ast.JsonNode) {
 }
 
 type tokenProvider struct {
-	rootOut          reflect.Value
-	workingStack     *util.Stack[*workingItem]
-	visited          map[uintptr][]string // check visited when pop
-	enableJsonExtTag bool
+	rootOut               reflect.Value
+	workingStack          *util.Stack[*workingItem]
+	visited               map[uintptr][]string // check visited when pop
+	enableJsonExtTag      bool
+	encoders              map[reflect.Type]Encoder
+	durationAsNanoseconds bool
+}
+
+// encode the go value into json bytes, e.g. the codec of a type that cannot have a MarshalJSON method
+type Encoder func(v reflect.Value) ([]byte, error)
+
+// the values of the types are written as their encoder writes them, the encoders are looked up before reflection
+func WithEncoders(encoders map[reflect.Type]Encoder) astbuilder.TokenProviderOptions {
+	return func(provider astbuilder.TokenProvider) error {
+		if goProvider, ok := provider.(*tokenProvider); ok {
+			goProvider.encoders = encoders
+		}
+		return nil
+	}
 }
 
 func EnableJsonExtTag(provider astbuilder.TokenProvider) error {
@@ -245,6 +263,9 @@ func (t *tokenProvider) GetNextTokenType() (token.TokenType, error) {
 			item.reflectValue = item.reflectValue.Elem()
 		}
 	}
+	if err := t.encodeItem(item); err != nil {
+		return token.TOKEN_DUMMY, err
+	}
 	switch item.tokenType {
 	case token.TOKEN_LEFT_BRACKET:
 		if err := t.detectCyclicAccess(item); err != nil {
@@ -282,6 +303,38 @@ func (t *tokenProvider) GetNextTokenType() (token.TokenType, error) {
 	}
 
 }
+
+// replace the value of the item with the json value its encoder writes, the encoders come before the time types
+func (t *tokenProvider) encodeItem(item *workingItem) error {
+	if item.encoded || !item.reflectValue.IsValid() {
+		return nil
+	}
+	encode, ok := t.encoders[item.reflectValue.Type()]
+	if !ok {
+		t.encodeTime(item)
+		return nil
+	}
+	data, err := encode(item.reflectValue)
+	if err != nil {
+		return err
+	}
+	// the numbers keep their digits, e.g. of a decimal type
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return ErrorEncodedValueInvalid
+	}
+	item.reflectValue = reflect.ValueOf(value)
+	item.tokenType, _ = token.GetTokenTypeByReflection(item.reflectValue)
+	item.address = 0
+	item.encoded = true
+	return nil
+}
+
 func (t *tokenProvider) processArrayItem(item *workingItem) error {
 
 	len := item.reflectValue.Len()
@@ -297,6 +350,7 @@ func (t *tokenProvider) processArrayItem(item *workingItem) error {
 		if err != nil {
 			return err
 		}
+		newItem.encoded = item.encoded
 		t.workingStack.Push(newItem)
 	}
 	return nil
@@ -311,7 +365,10 @@ func (t *tokenProvider) flattenStruct(workItem *workingItem) error {
 			return ErrorInvalidTypeOnExportedField
 		}
 		if t.enableJsonExtTag && val.ExtendTag != nil {
-			return t.createWorkItemFromExtensionTag(val, workItem)
+			if err := t.createWorkItemFromExtensionTag(val, workItem); err != nil {
+				return err
+			}
+			continue
 		}
 		if valueTokenType == token.TOKEN_LEFT_BRACE || valueTokenType == token.TOKEN_LEFT_BRACKET {
 			// for none primitive type, we need to track the path
@@ -337,6 +394,8 @@ func (t *tokenProvider) createWorkItemFromExtensionTag(fieldInfo *util.JSONStruc
 	if len(fieldInfo.ExtendTag.FieldVariableValueName) != 0 {
 		// FOR tokena variable you do not need to encode as json string "\"${var}\"", but for string with variable you needs!
 		t.workingStack.Push(&workingItem{reflectValue: reflect.ValueOf(fmt.Sprintf("${%s}", fieldInfo.ExtendTag.FieldVariableValueName)), tokenType: token.TOKEN_VARIABLE})
+	} else if len(fieldInfo.ExtendTag.FieldStringTemplate) != 0 {
+		t.workingStack.Push(&workingItem{reflectValue: reflect.ValueOf(fieldInfo.ExtendTag.FieldStringTemplate), tokenType: token.TOKEN_STRING_WITH_VARIABLE})
 	} else {
 		newItem, err := newContainerWorkingItem(fieldInfo.FieldName, fieldInfo.FieldValue, workItem, fieldInfo.FieldJsonTag, fieldInfo.ExtendTag)
 		if err != nil {
@@ -359,7 +418,7 @@ func (t *tokenProvider) processMapItem(item *workingItem) error {
 		if valueTokenType == token.TOKEN_UNKNOWN {
 			return ErrorInvalidTypeOnExportedField
 		}
-		t.workingStack.Push(&workingItem{reflectValue: mapValue, tokenType: valueTokenType})
+		t.workingStack.Push(&workingItem{reflectValue: mapValue, tokenType: valueTokenType, encoded: item.encoded})
 		keyTokenType, _ := token.GetTokenTypeByReflection(key)
 		if keyTokenType == token.TOKEN_NUMBER {
 			keyValue, err := convertNumericToString(key)
@@ -14,6 +14,16 @@ type TokenProvider interface {
 	GetNextTokenType() (token.TokenType, error)
 }
 type TokenProviderOptions func(TokenProvider) error
+
+// implemented by the builders that read from a document, gives the position of the latest token
+type PositionProvider interface {
+	Position() token.Position
+}
+
+// implemented by the builders that check the rest of the document once the json value is complete
+type DocumentEndChecker interface {
+	CheckDocumentEnd() error
+}
 type NodeConstructor interface {
 	CreateNodeWithValue(valueType ast.AST_NODETYPE, nodeValue interface{}) (ast.JsonNode, error)
 }
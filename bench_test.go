@@ -0,0 +1,143 @@
+package jsonextend_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jaksonlin/go-jsonextend"
+)
+
+type benchContainer struct {
+	Name  string            `json:"name"`
+	Image string            `json:"image"`
+	Args  []string          `json:"args"`
+	Env   map[string]string `json:"env"`
+	Ports []int             `json:"ports"`
+}
+
+type benchConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas   int              `json:"replicas"`
+		Paused     bool             `json:"paused"`
+		Containers []benchContainer `json:"containers"`
+	} `json:"spec"`
+}
+
+type benchItem struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Active bool    `json:"active"`
+}
+
+type benchDocument struct {
+	name string
+	data []byte
+	out  func() interface{}
+}
+
+func benchDocuments() []benchDocument {
+	var config strings.Builder
+	config.WriteString(`{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "labels": {"app": "web", "tier": "frontend"}},`)
+	config.WriteString(`"spec": {"replicas": 3, "paused": false, "containers": [`)
+	for i := 0; i < 8; i++ {
+		if i > 0 {
+			config.WriteString(",")
+		}
+		fmt.Fprintf(&config, `{"name": "c%d", "image": "registry.example.com/app:%d", "args": ["--port", "80%02d", "--verbose"], "env": {"MODE": "prod", "INDEX": "%d"}, "ports": [80, 443]}`, i, i, i, i)
+	}
+	config.WriteString(`]}}`)
+
+	var items strings.Builder
+	items.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			items.WriteString(",")
+		}
+		fmt.Fprintf(&items, `{"id": %d, "name": "item-%d", "score": %d.5, "active": %t}`, i, i, i, i%2 == 0)
+	}
+	items.WriteString("]")
+
+	return []benchDocument{
+		{"small", []byte(`{"id": 1, "name": "item", "score": 0.5, "active": true}`), func() interface{} { return &benchItem{} }},
+		{"config", []byte(config.String()), func() interface{} { return &benchConfig{} }},
+		{"array", []byte(items.String()), func() interface{} { return &[]benchItem{} }},
+		{"string", []byte(`"` + strings.Repeat(`lorem ipsum \"dolor\" sit amet `, 4096) + `"`), func() interface{} { return new(string) }},
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, doc := range benchDocuments() {
+		doc := doc
+		b.Run(doc.name+"/encoding_json", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := json.Unmarshal(doc.data, doc.out()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(doc.name+"/reader", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := jsonextend.Unmarshal(bytes.NewReader(doc.data), nil, doc.out()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(doc.name+"/bytes", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := jsonextend.UnmarshalBytes(doc.data, nil, doc.out()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, doc := range benchDocuments() {
+		doc := doc
+		b.Run(doc.name+"/encoding_json", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var out bytes.Buffer
+				if err := json.Indent(&out, doc.data, "", "  "); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(doc.name+"/reader", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := jsonextend.Parse(bytes.NewReader(doc.data), nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(doc.name+"/bytes", func(b *testing.B) {
+			b.SetBytes(int64(len(doc.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := jsonextend.ParseBytes(doc.data, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	jsonextend "github.com/jaksonlin/go-jsonextend"
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+// render one template with the variables, the template fails when a variable it needs has no value
+func runRender(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	set := newFlagSet("render", stderr)
+	var read readFlags
+	read.register(set, true)
+	var vars variableFlags
+	vars.register(set)
+	output := set.String("o", "", "write the result to the file rather than the standard output")
+	compact := set.Bool("compact", false, "write the result in a single line")
+	allowMissing := set.Bool("allow-missing", false, "leave the variables without a value as ${name} rather than failing")
+	if err := parseFlags(set, args); err != nil {
+		return err
+	}
+	if err := read.check(stderr); err != nil {
+		return err
+	}
+	if set.NArg() > 1 {
+		return usageErrorf(stderr, "render takes one template, got %d", set.NArg())
+	}
+	variables, err := vars.load(stderr)
+	if err != nil {
+		return err
+	}
+	name := templateNames(set)[0]
+	data, err := readTemplate(name, stdin)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	options := read.options(name)
+	if !*allowMissing {
+		root, err := jsonextend.ParseAST(bytes.NewReader(data), options...)
+		if err != nil {
+			return report(stderr, name, err)
+		}
+		if missing := missingVariables(root, variables); len(missing) > 0 {
+			for _, err := range missing {
+				report(stderr, name, err)
+			}
+			return errInvalid
+		}
+	}
+	out, err := jsonextend.ParseBytes(data, variables, options...)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	if *compact {
+		var buffer bytes.Buffer
+		if err = json.Compact(&buffer, out); err != nil {
+			return report(stderr, name, err)
+		}
+		out = buffer.Bytes()
+	}
+	if !bytes.HasSuffix(out, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	if err = writeOutput(*output, out, stdout); err != nil {
+		return report(stderr, *output, err)
+	}
+	return nil
+}
+
+// check the syntax of the templates, with -schema also render them with the variables and check the result
+func runValidate(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	set := newFlagSet("validate", stderr)
+	var read readFlags
+	read.register(set, true)
+	var vars variableFlags
+	vars.register(set)
+	schemaFile := set.String("schema", "", "JSON Schema the rendered templates must satisfy")
+	if err := parseFlags(set, args); err != nil {
+		return err
+	}
+	if err := read.check(stderr); err != nil {
+		return err
+	}
+	var s *schema
+	var variables map[string]interface{}
+	if *schemaFile != "" {
+		data, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			return report(stderr, *schemaFile, err)
+		}
+		var root interface{}
+		if err = jsonextend.UnmarshalBytes(data, nil, &root); err != nil {
+			return report(stderr, *schemaFile, err)
+		}
+		s = newSchema(root)
+		if variables, err = vars.load(stderr); err != nil {
+			return err
+		}
+	}
+	var rs error
+	for _, name := range templateNames(set) {
+		if err := validateTemplate(name, stdin, stderr, read.options(name), s, variables); err != nil && rs == nil {
+			rs = err
+		}
+	}
+	return rs
+}
+
+func validateTemplate(name string, stdin io.Reader, stderr io.Writer, options []jsonextend.Option, s *schema, variables map[string]interface{}) error {
+	data, err := readTemplate(name, stdin)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	root, err := jsonextend.ParseAST(bytes.NewReader(data), options...)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	if s == nil {
+		return nil
+	}
+	if missing := missingVariables(root, variables); len(missing) > 0 {
+		for _, err := range missing {
+			report(stderr, name, err)
+		}
+		return errInvalid
+	}
+	out, err := jsonextend.ParseBytes(data, variables, options...)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	var document interface{}
+	if err = jsonextend.UnmarshalBytes(out, nil, &document); err != nil {
+		return report(stderr, name, err)
+	}
+	violations, err := s.validate(document)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	for _, v := range violations {
+		err := fmt.Errorf("%s: %s", v.path, v.message)
+		// the rendered document has no positions, the template node at the same path has when the path is in the template
+		if nodes, _ := ast.Query(root, v.path); len(nodes) == 1 {
+			if position, ok := nodes[0].GetMeta(ast.POSITION_META).(token.Position); ok {
+				err = &token.PositionError{Position: position, Err: err}
+			}
+		}
+		report(stderr, name, err)
+	}
+	if len(violations) > 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// list the variables the templates reference, one per line in alphabetical order
+func runVars(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	set := newFlagSet("vars", stderr)
+	var read readFlags
+	read.register(set, true)
+	required := set.Bool("required", false, "leave out the variables only read by conditions")
+	if err := parseFlags(set, args); err != nil {
+		return err
+	}
+	if err := read.check(stderr); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	var rs error
+	for _, name := range templateNames(set) {
+		refs, err := templateReferences(name, stdin, read.options(name))
+		if err != nil {
+			if rs == nil {
+				rs = report(stderr, name, err)
+			} else {
+				report(stderr, name, err)
+			}
+			continue
+		}
+		for _, ref := range refs {
+			if ref.required || !*required {
+				names[ref.name] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		fmt.Fprintln(stdout, name)
+	}
+	return rs
+}
+
+func templateReferences(name string, stdin io.Reader, options []jsonextend.Option) ([]*reference, error) {
+	data, err := readTemplate(name, stdin)
+	if err != nil {
+		return nil, err
+	}
+	root, err := jsonextend.ParseAST(bytes.NewReader(data), options...)
+	if err != nil {
+		return nil, err
+	}
+	return references(root), nil
+}
+
+// write the templates in the canonical layout of FormatTemplate, the includes stay as they are written
+func runFmt(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	set := newFlagSet("fmt", stderr)
+	var read readFlags
+	read.register(set, false)
+	write := set.Bool("w", false, "write the result to the template file rather than the standard output")
+	list := set.Bool("l", false, "list the templates whose layout differs and fail when there is any")
+	indent := set.String("indent", "    ", "indent of each nesting level, a single line when empty")
+	if err := parseFlags(set, args); err != nil {
+		return err
+	}
+	if err := read.check(stderr); err != nil {
+		return err
+	}
+	var rs error
+	for _, name := range templateNames(set) {
+		// only -w loses the source, the output on the standard output can be checked before it replaces the file
+		guard := *write && read.relaxed
+		if err := formatTemplate(name, stdin, stdout, stderr, read.options(name), *indent, *write, *list, guard); err != nil && rs == nil {
+			rs = err
+		}
+	}
+	return rs
+}
+
+func formatTemplate(name string, stdin io.Reader, stdout io.Writer, stderr io.Writer, options []jsonextend.Option, indent string, write bool, list bool, guard bool) error {
+	data, err := readTemplate(name, stdin)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	if guard {
+		lossless, err := jsonextend.ParseAST(bytes.NewReader(data), append(options, jsonextend.WithLosslessMode())...)
+		if err != nil {
+			return report(stderr, name, err)
+		}
+		if err = droppedContent(lossless); err != nil {
+			return report(stderr, name, err)
+		}
+	}
+	root, err := jsonextend.ParseAST(bytes.NewReader(data), options...)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	out, err := jsonextend.FormatTemplate(root, indent)
+	if err != nil {
+		return report(stderr, name, err)
+	}
+	out = append(out, '\n')
+	changed := !bytes.Equal(out, data)
+	switch {
+	case list:
+		if changed {
+			fmt.Fprintln(stdout, displayName(name))
+			return errInvalid
+		}
+	case write && name != "-":
+		if changed {
+			info, err := os.Stat(name)
+			if err != nil {
+				return report(stderr, name, err)
+			}
+			if err = os.WriteFile(name, out, info.Mode().Perm()); err != nil {
+				return report(stderr, name, err)
+			}
+		}
+	default:
+		if _, err = stdout.Write(out); err != nil {
+			return report(stderr, name, err)
+		}
+	}
+	return nil
+}
+
+var errDropsContent = errors.New("fmt -w would drop it, the canonical layout is plain json")
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// the first comment or number literal of a template read in relaxed and lossless mode that the canonical layout
+// cannot keep, e.g. `// note` or `0x10`. the quotes of the keys and strings change but their content stays.
+func droppedContent(root ast.JsonNode) error {
+	var rs error
+	// at is the node holding the position, the kv pair for its key
+	found := func(at ast.JsonNode, what string) {
+		err := fmt.Errorf("%s: %w", what, errDropsContent)
+		if position, ok := at.GetMeta(ast.POSITION_META).(token.Position); ok {
+			err = &token.PositionError{Position: position, Err: err}
+		}
+		rs = err
+	}
+	check := func(node ast.JsonNode, at ast.JsonNode) {
+		trivia := ast.TriviaOf(node)
+		if trivia == nil || rs != nil {
+			return
+		}
+		for _, text := range [][]byte{trivia.Leading, trivia.Trailing, trivia.Comma, trivia.Closing} {
+			if len(bytes.TrimSpace(text)) > 0 {
+				found(at, fmt.Sprintf("comment %q", bytes.TrimSpace(text)))
+				return
+			}
+		}
+		if _, ok := node.(*ast.JsonNumberNode); ok && trivia.Raw != nil && !jsonNumber.Match(trivia.Raw) {
+			found(at, fmt.Sprintf("number literal %s", trivia.Raw))
+		}
+	}
+	ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+		if ctx.Event == ast.WalkLeave {
+			return ast.WalkContinue
+		}
+		check(ctx.Node, ctx.Node)
+		if object, ok := ctx.Node.(*ast.JsonObjectNode); ok {
+			members := object.Value
+			if trivia := ast.TriviaOf(object); trivia != nil && trivia.Members != nil {
+				// the `$if`, `$for` members folded into the object are not walked
+				members = trivia.Members
+			}
+			for _, kv := range members {
+				check(kv.Key, kv)
+				check(kv.Value, kv.Value)
+			}
+		}
+		if rs != nil {
+			return ast.WalkStop
+		}
+		return ast.WalkContinue
+	})
+	return rs
+}
@@ -0,0 +1,226 @@
+// jsonext renders, validates, lists the variables of and formats jsonextend templates.
+//
+//	jsonext render [flags] [template]
+//	jsonext validate [flags] [template...]
+//	jsonext vars [flags] [template...]
+//	jsonext fmt [flags] [template...]
+//
+// a missing template or `-` reads the standard input. the exit code is 0 on success, 1 when a template is invalid,
+// 2 when the command line is wrong and 3 when a file cannot be read or written.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	jsonextend "github.com/jaksonlin/go-jsonextend"
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+const (
+	exitOK = iota
+	exitInvalid
+	exitUsage
+	exitIO
+)
+
+const usage = `usage: jsonext <command> [flags] [template...]
+
+commands:
+  render     render a template with variables
+  validate   check the syntax of templates, or the rendered template against a schema
+  vars       list the variables the templates reference
+  fmt        lay out templates in the canonical form
+
+run "jsonext <command> -h" for the flags of a command.
+`
+
+var (
+	errUsage = errors.New("usage")
+	// the errors are written already, the command only has to fail
+	errInvalid = errors.New("invalid")
+)
+
+type command func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+var commands = map[string]command{
+	"render":   runRender,
+	"validate": runValidate,
+	"vars":     runVars,
+	"fmt":      runFmt,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "jsonext: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+	return exitCode(cmd(args[1:], stdin, stdout, stderr))
+}
+
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.As(err, &pathErr):
+		return exitIO
+	default:
+		return exitInvalid
+	}
+}
+
+// the flag package writes the errors and the help of the flag set to stderr
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	set := flag.NewFlagSet("jsonext "+name, flag.ContinueOnError)
+	set.SetOutput(stderr)
+	return set
+}
+
+// a wrong flag fails with errUsage, -h with flag.ErrHelp
+func parseFlags(set *flag.FlagSet, args []string) error {
+	if err := set.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return flag.ErrHelp
+		}
+		return errUsage
+	}
+	return nil
+}
+
+func usageErrorf(stderr io.Writer, format string, args ...interface{}) error {
+	fmt.Fprintf(stderr, "jsonext: "+format+"\n", args...)
+	return errUsage
+}
+
+var duplicateKeyPolicies = map[string]ast.DuplicateKeyPolicy{
+	"error": ast.DUPLICATE_KEY_ERROR,
+	"first": ast.DUPLICATE_KEY_FIRST_WINS,
+	"last":  ast.DUPLICATE_KEY_LAST_WINS,
+}
+
+// how the templates are read, shared by the commands
+type readFlags struct {
+	relaxed    bool
+	strict     bool
+	includeDir string
+	duplicates string
+	// the includes are resolved, the other commands read the template as it is written
+	includes bool
+}
+
+func (r *readFlags) register(set *flag.FlagSet, includes bool) {
+	r.includes = includes
+	set.BoolVar(&r.relaxed, "relaxed", false, "accept JSON5 style input: comments, identifier keys, single quotes, trailing commas")
+	set.BoolVar(&r.strict, "strict", false, "accept RFC 8259 json only, plus the ${} extension")
+	set.StringVar(&r.duplicates, "duplicate-keys", "", "what to do with duplicate keys: error, first or last")
+	if includes {
+		set.StringVar(&r.includeDir, "include-dir", "", "directory of ${include:path}, the directory of the template by default")
+	}
+}
+
+func (r *readFlags) check(stderr io.Writer) error {
+	if r.relaxed && r.strict {
+		return usageErrorf(stderr, "-relaxed and -strict cannot be used together")
+	}
+	if _, ok := duplicateKeyPolicies[r.duplicates]; !ok && r.duplicates != "" {
+		return usageErrorf(stderr, "unknown -duplicate-keys %q, use error, first or last", r.duplicates)
+	}
+	return nil
+}
+
+// the positions are recorded for the errors
+func (r *readFlags) options(name string) []jsonextend.Option {
+	options := []jsonextend.Option{jsonextend.WithPositions()}
+	if r.relaxed {
+		options = append(options, jsonextend.WithRelaxedMode())
+	}
+	if r.strict {
+		options = append(options, jsonextend.WithStrictMode())
+	}
+	if policy, ok := duplicateKeyPolicies[r.duplicates]; ok {
+		options = append(options, jsonextend.WithDuplicateKeys(policy))
+	}
+	if !r.includes {
+		return options
+	}
+	dir := r.includeDir
+	if dir == "" {
+		dir = "."
+		if name != "-" {
+			dir = filepath.Dir(name)
+		}
+	}
+	return append(options, jsonextend.WithIncludeFS(os.DirFS(dir)))
+}
+
+// the templates named on the command line, the standard input when there is none
+func templateNames(set *flag.FlagSet) []string {
+	if set.NArg() == 0 {
+		return []string{"-"}
+	}
+	return set.Args()
+}
+
+func readTemplate(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, &fs.PathError{Op: "read", Path: "<stdin>", Err: err}
+		}
+		return data, nil
+	}
+	return os.ReadFile(name)
+}
+
+func displayName(name string) string {
+	if name == "-" {
+		return "<stdin>"
+	}
+	return name
+}
+
+// write the error as `file:line:col: message` when it has a position, the error is returned for the exit code
+func report(stderr io.Writer, name string, err error) error {
+	var pathErr *fs.PathError
+	if positionErr, ok := err.(*token.PositionError); ok && positionErr.Position.File == "" {
+		fmt.Fprintf(stderr, "%s:%s\n", displayName(name), err.Error())
+	} else if ok {
+		// in an included document, the file is relative to the include directory
+		fmt.Fprintf(stderr, "%s\n", err.Error())
+	} else if errors.As(err, &pathErr) {
+		fmt.Fprintf(stderr, "jsonext: %s\n", err.Error())
+	} else {
+		fmt.Fprintf(stderr, "%s: %s\n", displayName(name), err.Error())
+	}
+	return err
+}
+
+func writeOutput(output string, data []byte, stdout io.Writer) error {
+	if output == "" || output == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
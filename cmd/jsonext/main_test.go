@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+	return dir
+}
+
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRender(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.jsonx":  "{\"name\": \"${app}\",\n \"replicas\": ${spec.replicas}, \"tls\": ${include:tls.jsonx}}",
+		"tls.jsonx":  `{"enabled": ${tls}}`,
+		"vars.json":  `{"app": "web", "spec": {"replicas": 1}}`,
+		"other.json": `{"spec": {"replicas": 2}}`,
+	})
+	template := filepath.Join(dir, "app.jsonx")
+	t.Setenv("JSONEXT_TEST_tls", "on")
+	code, stdout, stderr := runCommand("", "render", "-compact", "-vars", filepath.Join(dir, "vars.json"), "-vars", filepath.Join(dir, "other.json"),
+		"-env-prefix", "JSONEXT_TEST_", template)
+	if code != exitOK || stdout != `{"name":"web","replicas":2,"tls":{"enabled":"on"}}`+"\n" {
+		t.Log(code, stdout, stderr)
+		t.FailNow()
+	}
+
+	// -set wins over the files, -set-string keeps the value a string
+	code, stdout, stderr = runCommand("", "render", "-compact", "-vars", filepath.Join(dir, "vars.json"), "-set", "spec.replicas=3", "-set", "tls=true",
+		"-set-string", "app=42", template)
+	if code != exitOK || stdout != `{"name":"42","replicas":3,"tls":{"enabled":true}}`+"\n" {
+		t.Log(code, stdout, stderr)
+		t.FailNow()
+	}
+
+	output := filepath.Join(dir, "out.json")
+	code, _, stderr = runCommand(`{"a": ${a}}`, "render", "-compact", "-set", "a=1", "-o", output)
+	if data, _ := os.ReadFile(output); code != exitOK || string(data) != `{"a":1}`+"\n" {
+		t.Log(code, string(data), stderr)
+		t.FailNow()
+	}
+
+	// the missing variables are told where they are used, in the included document too
+	code, _, stderr = runCommand("", "render", "-set", "app=web", template)
+	if code != exitInvalid || stderr != template+":2:14: no value for variable spec.replicas\ntls.jsonx:1:13: no value for variable tls\n" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	code, stdout, _ = runCommand(`{"a": ${a}}`, "render", "-allow-missing")
+	if code != exitOK || !strings.Contains(stdout, "${a}") {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+	code, _, stderr = runCommand("", "render", "-vars", filepath.Join(dir, "app.jsonx"), template)
+	if code != exitInvalid || !strings.HasPrefix(stderr, filepath.Join(dir, "app.jsonx")+":") {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"good.jsonx": `{"name": "${app}", "replicas": ${replicas}, "ports": [80, 443]}`,
+		"bad.jsonx":  "{\"name\": \"app\",\n \"replicas\" 1}",
+		"schema.json": `{
+			"type": "object",
+			"required": ["name", "replicas"],
+			"properties": {
+				"name": {"type": "string", "pattern": "^[a-z]+$"},
+				"replicas": {"$ref": "#/definitions/positive"},
+				"ports": {"type": "array", "items": {"type": "integer", "maximum": 1024}, "uniqueItems": true}
+			},
+			"additionalProperties": false,
+			"definitions": {"positive": {"type": "integer", "minimum": 1}}
+		}`,
+	})
+	good, bad, schema := filepath.Join(dir, "good.jsonx"), filepath.Join(dir, "bad.jsonx"), filepath.Join(dir, "schema.json")
+	if code, _, stderr := runCommand("", "validate", good); code != exitOK || stderr != "" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("", "validate", good, bad); code != exitInvalid || stderr != bad+":2:14: syntax element not separated by comma\n" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("", "validate", "-schema", schema, "-set", "app=web", "-set", "replicas=2", good); code != exitOK || stderr != "" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	code, _, stderr := runCommand("", "validate", "-schema", schema, "-set", "app=Web", "-set", "replicas=0", good)
+	if code != exitInvalid || stderr != good+`:1:10: $.name: "Web" does not match "^[a-z]+$"`+"\n"+good+":1:32: $.replicas: 0 is less than 1\n" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	code, _, stderr = runCommand(`{"replicas": 1.5, "ports": [80, 80], "extra": true}`, "validate", "-schema", schema)
+	expected := []string{
+		`<stdin>:1:1: $: missing required member "name"`,
+		`<stdin>:1:1: $: member "extra" is not allowed`,
+		`<stdin>:1:28: $.ports: element 1 is a duplicate`,
+		`<stdin>:1:14: $.replicas: number is not of type integer`,
+	}
+	if code != exitInvalid || stderr != strings.Join(expected, "\n")+"\n" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+}
+
+func TestSchema(t *testing.T) {
+	cases := []struct {
+		schema interface{}
+		value  interface{}
+		valid  bool
+	}{
+		{true, "anything", true},
+		{false, "anything", false},
+		{map[string]interface{}{"type": []interface{}{"string", "null"}}, nil, true},
+		{map[string]interface{}{"type": "number"}, float64(1), true},
+		{map[string]interface{}{"enum": []interface{}{"a", float64(1)}}, float64(1), true},
+		{map[string]interface{}{"const": "a"}, "b", false},
+		{map[string]interface{}{"minLength": float64(2)}, "é", false},
+		{map[string]interface{}{"exclusiveMaximum": float64(2)}, float64(2), false},
+		{map[string]interface{}{"maxItems": float64(1)}, []interface{}{1, 2}, false},
+		{map[string]interface{}{"minProperties": float64(1)}, map[string]interface{}{}, false},
+		{map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "string"}, map[string]interface{}{"type": "integer"}}}, float64(3), true},
+		{map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"type": "number"}, map[string]interface{}{"type": "integer"}}}, float64(3), false},
+		{map[string]interface{}{"allOf": []interface{}{map[string]interface{}{"minimum": float64(1)}, map[string]interface{}{"maximum": float64(2)}}}, float64(3), false},
+		{map[string]interface{}{"not": map[string]interface{}{"type": "null"}}, nil, false},
+		{map[string]interface{}{"additionalProperties": map[string]interface{}{"type": "string"}}, map[string]interface{}{"a": float64(1)}, false},
+	}
+	for i, c := range cases {
+		violations, err := newSchema(c.schema).validate(c.value)
+		if err != nil || (len(violations) == 0) != c.valid {
+			t.Log(i, violations, err)
+			t.FailNow()
+		}
+	}
+	if _, err := newSchema(map[string]interface{}{"$ref": "#/missing"}).validate(nil); err == nil {
+		t.Log("expect invalid schema")
+		t.FailNow()
+	}
+
+	// refs that come back to themselves without reading into the value fail rather than loop
+	loops := []interface{}{
+		map[string]interface{}{"$ref": "#"},
+		map[string]interface{}{"$ref": "#/definitions/a", "definitions": map[string]interface{}{
+			"a": map[string]interface{}{"$ref": "#/definitions/b"},
+			"b": map[string]interface{}{"allOf": []interface{}{map[string]interface{}{"$ref": "#/definitions/a"}}},
+		}},
+	}
+	for _, root := range loops {
+		if _, err := newSchema(root).validate(float64(1)); !errors.Is(err, errSchema) {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+	// a recursive schema is fine as long as each ref reads one level deeper
+	tree := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"child": map[string]interface{}{"$ref": "#"}}}
+	value := map[string]interface{}{"child": map[string]interface{}{"child": map[string]interface{}{}}}
+	if violations, err := newSchema(tree).validate(value); err != nil || len(violations) != 0 {
+		t.Log(violations, err)
+		t.FailNow()
+	}
+}
+
+func TestVars(t *testing.T) {
+	template := `{"name": "${app.name}", "${?debug}log": true, "${key}": [{"$for": "item in ${items}", "$do": "${item.name}-${suffix}"}], "...": ${...extra}}`
+	code, stdout, stderr := runCommand(template, "vars")
+	if code != exitOK || stdout != "app.name\ndebug\nextra\nitems\nkey\nsuffix\n" {
+		t.Log(code, stdout, stderr)
+		t.FailNow()
+	}
+	code, stdout, _ = runCommand(template, "vars", "-required")
+	if code != exitOK || strings.Contains(stdout, "debug") {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.jsonx": `{"a":[1,2],"b":${include:b.jsonx}}`,
+		"b.jsonx": "{\n    \"c\": \"${c}\"\n}\n",
+	})
+	a, b := filepath.Join(dir, "a.jsonx"), filepath.Join(dir, "b.jsonx")
+	code, stdout, _ := runCommand("", "fmt", "-l", a, b)
+	if code != exitInvalid || stdout != a+"\n" {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+	code, stdout, _ = runCommand("", "fmt", "-indent", "", a)
+	if code != exitOK || stdout != `{"a":[1,2],"b":${include:b.jsonx}}`+"\n" {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("", "fmt", "-w", a); code != exitOK {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	if code, stdout, _ = runCommand("", "fmt", "-l", a, b); code != exitOK || stdout != "" {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+	code, stdout, _ = runCommand("{// comment\n a: 'x',}", "fmt", "-relaxed")
+	if code != exitOK || stdout != "{\n    \"a\": \"x\"\n}\n" {
+		t.Log(code, stdout)
+		t.FailNow()
+	}
+}
+
+func TestFmtRelaxed(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"comment.json5": "{\n  // the port of the app\n  port: 80,\n}\n",
+		"hex.json5":     "{mask: 0x10}",
+		"plain.json5":   "{name: 'app', 'size': 1e3,}",
+	})
+	for name, expected := range map[string]string{
+		"comment.json5": `comment.json5:3:3: comment "// the port of the app": fmt -w would drop it, the canonical layout is plain json`,
+		"hex.json5":     `hex.json5:1:8: number literal 0x10: fmt -w would drop it, the canonical layout is plain json`,
+	} {
+		file := filepath.Join(dir, name)
+		code, _, stderr := runCommand("", "fmt", "-relaxed", "-w", file)
+		if code != exitInvalid || stderr != dir+string(filepath.Separator)+expected+"\n" {
+			t.Log(code, stderr)
+			t.FailNow()
+		}
+		// the file is left as it is, the output can still be seen without -w
+		data, _ := os.ReadFile(file)
+		if code, stdout, _ := runCommand("", "fmt", "-relaxed", file); code != exitOK || stdout == string(data) {
+			t.Log(code, stdout)
+			t.FailNow()
+		}
+	}
+	file := filepath.Join(dir, "plain.json5")
+	if code, _, stderr := runCommand("", "fmt", "-relaxed", "-w", file); code != exitOK {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), `"name": "app"`) {
+		t.Log(string(data))
+		t.FailNow()
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"render", "-unknown"}, exitUsage},
+		{[]string{"render", "-set", "novalue"}, exitUsage},
+		{[]string{"render", "a.jsonx", "b.jsonx"}, exitUsage},
+		{[]string{"fmt", "-relaxed", "-strict"}, exitUsage},
+		{[]string{"validate", "-duplicate-keys", "maybe"}, exitUsage},
+		{[]string{"render", "-h"}, exitOK},
+		{[]string{"help"}, exitOK},
+		{[]string{"vars", filepath.Join(t.TempDir(), "missing.jsonx")}, exitIO},
+		{[]string{"validate", "-schema", filepath.Join(t.TempDir(), "missing.json")}, exitIO},
+	}
+	for _, c := range cases {
+		if code, _, stderr := runCommand(`{}`, c.args...); code != c.code {
+			t.Log(c.args, code, stderr)
+			t.FailNow()
+		}
+	}
+	if code, _, stderr := runCommand(`{"a": 1, "a": 2}`, "validate", "-duplicate-keys", "error"); code != exitInvalid || stderr != "<stdin>: duplicate key \"a\" at 1:10, first defined at 1:2\n" {
+		t.Log(code, stderr)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+var errSchema = errors.New("invalid schema")
+
+// the value at the path does not satisfy the schema, the path is a JSONPath as accepted by ast.Query
+type violation struct {
+	path    string
+	message string
+}
+
+// a subset of JSON Schema: type, enum, const, properties, required, additionalProperties, minProperties,
+// maxProperties, items, minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// minLength, maxLength, pattern, allOf, anyOf, oneOf, not and `$ref` to `#/...` in the same schema.
+// the other keywords are ignored.
+type schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+type schemaItem struct {
+	schema interface{}
+	value  interface{}
+	path   string
+	// the `$ref`s followed for the value since its parent, a ref met twice loops without reading the value
+	refs []string
+}
+
+func newSchema(root interface{}) *schema {
+	return &schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+}
+
+// the violations of value, the members of an object are checked in the order of their names
+func (s *schema) validate(value interface{}) ([]violation, error) {
+	return s.validateAt(schemaItem{schema: s.root, value: value, path: "$"})
+}
+
+func (s *schema) validateAt(root schemaItem) ([]violation, error) {
+	rs := make([]violation, 0)
+	stack := util.NewStack[schemaItem]()
+	stack.Push(root)
+	for !stack.IsEmpty() {
+		item, _ := stack.Pop()
+		violations, children, err := s.check(item)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, violations...)
+		for i := len(children) - 1; i >= 0; i-- {
+			stack.Push(children[i])
+		}
+	}
+	return rs, nil
+}
+
+// the violations of the value itself, and the members or elements to check with their schemas
+func (s *schema) check(item schemaItem) ([]violation, []schemaItem, error) {
+	switch keywords := item.schema.(type) {
+	case bool:
+		if !keywords {
+			return []violation{{item.path, "no value is allowed"}}, nil, nil
+		}
+		return nil, nil, nil
+	case map[string]interface{}:
+		if ref, ok := keywords["$ref"]; ok {
+			for _, followed := range item.refs {
+				if followed == ref {
+					return nil, nil, fmt.Errorf("%w: $ref %v at %s refers back to itself", errSchema, ref, item.path)
+				}
+			}
+			target, err := s.resolve(ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			refs := append(append([]string{}, item.refs...), ref.(string))
+			return nil, []schemaItem{{schema: target, value: item.value, path: item.path, refs: refs}}, nil
+		}
+		rs := make([]violation, 0)
+		fail := func(format string, args ...interface{}) {
+			rs = append(rs, violation{item.path, fmt.Sprintf(format, args...)})
+		}
+		if t, ok := keywords["type"]; ok {
+			types, err := schemaTypes(t)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !hasType(item.value, types) {
+				fail("%s is not of type %s", typeName(item.value), strings.Join(types, " or "))
+				// the other keywords would only repeat the type mismatch
+				return rs, nil, nil
+			}
+		}
+		if enum, ok := keywords["enum"].([]interface{}); ok && !contains(enum, item.value) {
+			fail("%s is not one of %s", describe(item.value), describe(enum))
+		}
+		if c, ok := keywords["const"]; ok && !equal(c, item.value) {
+			fail("%s is not %s", describe(item.value), describe(c))
+		}
+		var children []schemaItem
+		var err error
+		switch v := item.value.(type) {
+		case map[string]interface{}:
+			children = checkObject(keywords, v, item.path, fail)
+		case []interface{}:
+			children = checkArray(keywords, v, item.path, fail)
+		case string:
+			err = s.checkString(keywords, v, fail)
+		default:
+			if number, ok := toNumber(item.value); ok {
+				checkNumber(keywords, number, fail)
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = s.checkCombinations(keywords, item, fail); err != nil {
+			return nil, nil, err
+		}
+		return rs, children, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: schema at %s is neither an object nor a boolean", errSchema, item.path)
+	}
+}
+
+func checkObject(keywords map[string]interface{}, value map[string]interface{}, path string, fail func(string, ...interface{})) []schemaItem {
+	if required, ok := keywords["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, ok := value[key]; !ok {
+					fail("missing required member %q", key)
+				}
+			}
+		}
+	}
+	if limit, ok := toNumber(keywords["minProperties"]); ok && float64(len(value)) < limit {
+		fail("has %d members, fewer than %v", len(value), limit)
+	}
+	if limit, ok := toNumber(keywords["maxProperties"]); ok && float64(len(value)) > limit {
+		fail("has %d members, more than %v", len(value), limit)
+	}
+	properties, _ := keywords["properties"].(map[string]interface{})
+	additional, hasAdditional := keywords["additionalProperties"]
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rs := make([]schemaItem, 0)
+	for _, key := range keys {
+		if property, ok := properties[key]; ok {
+			rs = append(rs, schemaItem{schema: property, value: value[key], path: path + pathName(key)})
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			fail("member %q is not allowed", key)
+			continue
+		}
+		rs = append(rs, schemaItem{schema: additional, value: value[key], path: path + pathName(key)})
+	}
+	return rs
+}
+
+func checkArray(keywords map[string]interface{}, value []interface{}, path string, fail func(string, ...interface{})) []schemaItem {
+	if limit, ok := toNumber(keywords["minItems"]); ok && float64(len(value)) < limit {
+		fail("has %d elements, fewer than %v", len(value), limit)
+	}
+	if limit, ok := toNumber(keywords["maxItems"]); ok && float64(len(value)) > limit {
+		fail("has %d elements, more than %v", len(value), limit)
+	}
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+		for i := range value {
+			if contains(value[:i], value[i]) {
+				fail("element %d is a duplicate", i)
+			}
+		}
+	}
+	items, ok := keywords["items"]
+	if !ok {
+		return nil
+	}
+	rs := make([]schemaItem, 0, len(value))
+	for i, element := range value {
+		rs = append(rs, schemaItem{schema: items, value: element, path: path + "[" + strconv.Itoa(i) + "]"})
+	}
+	return rs
+}
+
+func (s *schema) checkString(keywords map[string]interface{}, value string, fail func(string, ...interface{})) error {
+	length := utf8.RuneCountInString(value)
+	if limit, ok := toNumber(keywords["minLength"]); ok && float64(length) < limit {
+		fail("is %d characters long, shorter than %v", length, limit)
+	}
+	if limit, ok := toNumber(keywords["maxLength"]); ok && float64(length) > limit {
+		fail("is %d characters long, longer than %v", length, limit)
+	}
+	if pattern, ok := keywords["pattern"].(string); ok {
+		re, ok := s.patterns[pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%w: pattern %q: %s", errSchema, pattern, err.Error())
+			}
+			s.patterns[pattern] = re
+		}
+		if !re.MatchString(value) {
+			fail("%q does not match %q", value, pattern)
+		}
+	}
+	return nil
+}
+
+func checkNumber(keywords map[string]interface{}, value float64, fail func(string, ...interface{})) {
+	if limit, ok := toNumber(keywords["minimum"]); ok && value < limit {
+		fail("%v is less than %v", value, limit)
+	}
+	if limit, ok := toNumber(keywords["maximum"]); ok && value > limit {
+		fail("%v is greater than %v", value, limit)
+	}
+	if limit, ok := toNumber(keywords["exclusiveMinimum"]); ok && value <= limit {
+		fail("%v is not greater than %v", value, limit)
+	}
+	if limit, ok := toNumber(keywords["exclusiveMaximum"]); ok && value >= limit {
+		fail("%v is not less than %v", value, limit)
+	}
+}
+
+// allOf, anyOf, oneOf and not check the same value with other schemas
+func (s *schema) checkCombinations(keywords map[string]interface{}, item schemaItem, fail func(string, ...interface{})) error {
+	matches := func(schemas interface{}, keyword string) ([]int, error) {
+		list, ok := schemas.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %s at %s is not an array", errSchema, keyword, item.path)
+		}
+		rs := make([]int, 0)
+		for i, sub := range list {
+			violations, err := s.validateAt(schemaItem{schema: sub, value: item.value, path: item.path, refs: item.refs})
+			if err != nil {
+				return nil, err
+			}
+			if len(violations) == 0 {
+				rs = append(rs, i)
+			}
+		}
+		return rs, nil
+	}
+	if allOf, ok := keywords["allOf"]; ok {
+		matched, err := matches(allOf, "allOf")
+		if err != nil {
+			return err
+		}
+		if list, _ := allOf.([]interface{}); len(matched) != len(list) {
+			fail("does not match all the schemas of allOf")
+		}
+	}
+	if anyOf, ok := keywords["anyOf"]; ok {
+		matched, err := matches(anyOf, "anyOf")
+		if err != nil {
+			return err
+		}
+		if len(matched) == 0 {
+			fail("does not match any schema of anyOf")
+		}
+	}
+	if one, ok := keywords["oneOf"]; ok {
+		matched, err := matches(one, "oneOf")
+		if err != nil {
+			return err
+		}
+		if len(matched) != 1 {
+			fail("matches %d schemas of oneOf rather than one", len(matched))
+		}
+	}
+	if not, ok := keywords["not"]; ok {
+		violations, err := s.validateAt(schemaItem{schema: not, value: item.value, path: item.path, refs: item.refs})
+		if err != nil {
+			return err
+		}
+		if len(violations) == 0 {
+			fail("matches the schema of not")
+		}
+	}
+	return nil
+}
+
+// `#/definitions/name`, a JSON Pointer into the schema itself
+func (s *schema) resolve(ref interface{}) (interface{}, error) {
+	pointer, ok := ref.(string)
+	if !ok || !strings.HasPrefix(pointer, "#") {
+		return nil, fmt.Errorf("%w: only $ref into the same schema is supported, got %v", errSchema, ref)
+	}
+	current := s.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := current.(type) {
+		case map[string]interface{}:
+			if current, ok = v[token]; !ok {
+				return nil, fmt.Errorf("%w: $ref %s not found", errSchema, pointer)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%w: $ref %s not found", errSchema, pointer)
+			}
+			current = v[i]
+		default:
+			return nil, fmt.Errorf("%w: $ref %s not found", errSchema, pointer)
+		}
+	}
+	return current, nil
+}
+
+func schemaTypes(t interface{}) ([]string, error) {
+	switch v := t.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		rs := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: type %v", errSchema, t)
+			}
+			rs = append(rs, name)
+		}
+		return rs, nil
+	default:
+		return nil, fmt.Errorf("%w: type %v", errSchema, t)
+	}
+}
+
+func hasType(value interface{}, types []string) bool {
+	actual := typeName(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if number, ok := toNumber(value); ok {
+		if number == math.Trunc(number) {
+			return "integer"
+		}
+		return "number"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+// 1 and 1.0 are the same number
+func equal(a interface{}, b interface{}) bool {
+	x, isNumber := toNumber(a)
+	y, ok := toNumber(b)
+	if isNumber && ok {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, describe(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// `.name`, or `['name']` when the name does not read back as a dot segment, the same as the paths of ast.Walk
+func pathName(name string) string {
+	if name != "" && name != "*" && !strings.ContainsAny(name, ".[") {
+		return "." + name
+	}
+	if strings.ContainsRune(name, '\'') {
+		return `["` + name + `"]`
+	}
+	return "['" + name + "']"
+}
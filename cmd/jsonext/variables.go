@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	jsonextend "github.com/jaksonlin/go-jsonextend"
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/token"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+var errNoValue = errors.New("no value for variable")
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type setting struct {
+	name  string
+	value string
+	// -set-string, the value is not read as json
+	raw bool
+}
+
+// -set and -set-string share the settings so that the later one wins whichever flag it is
+type setFlag struct {
+	settings *[]setting
+	raw      bool
+}
+
+func (f setFlag) String() string {
+	return ""
+}
+
+func (f setFlag) Set(arg string) error {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("%q is not name=value", arg)
+	}
+	*f.settings = append(*f.settings, setting{name: name, value: value, raw: f.raw})
+	return nil
+}
+
+// where the variables come from, a later source overrides an earlier one: the files in order, the environment, the settings
+type variableFlags struct {
+	files     stringsFlag
+	env       bool
+	envPrefix string
+	settings  []setting
+}
+
+func (v *variableFlags) register(set *flag.FlagSet) {
+	set.Var(&v.files, "vars", "json file of variables, can be repeated")
+	set.BoolVar(&v.env, "env", false, "the environment variables are variables")
+	set.StringVar(&v.envPrefix, "env-prefix", "", "the environment variables starting with the prefix are variables, without the prefix")
+	set.Var(setFlag{settings: &v.settings}, "set", "name=value, the value is read as json when it is json and as a string otherwise, can be repeated")
+	set.Var(setFlag{settings: &v.settings, raw: true}, "set-string", "name=value, the value is a string, can be repeated")
+}
+
+// a dotted name such as `spec.image` sets the member of a nested object
+func (v *variableFlags) load(stderr io.Writer) (map[string]interface{}, error) {
+	rs := make(map[string]interface{})
+	for _, name := range v.files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, report(stderr, name, err)
+		}
+		var variables map[string]interface{}
+		if err = jsonextend.UnmarshalBytes(data, nil, &variables); err != nil {
+			return nil, report(stderr, name, err)
+		}
+		merge(rs, variables)
+	}
+	if v.env || v.envPrefix != "" {
+		for _, item := range os.Environ() {
+			name, value, _ := strings.Cut(item, "=")
+			if strings.HasPrefix(name, v.envPrefix) && len(name) > len(v.envPrefix) {
+				rs[strings.TrimPrefix(name, v.envPrefix)] = value
+			}
+		}
+	}
+	for _, s := range v.settings {
+		var value interface{} = s.value
+		if !s.raw {
+			var decoded interface{}
+			if json.Unmarshal([]byte(s.value), &decoded) == nil {
+				value = decoded
+			}
+		}
+		setPath(rs, strings.Split(s.name, "."), value)
+	}
+	return rs, nil
+}
+
+// the members of the objects in both are merged, the other values of src replace the ones of dst
+func merge(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		to, isMap := dst[key].(map[string]interface{})
+		from, ok := value.(map[string]interface{})
+		if isMap && ok {
+			merge(to, from)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+func setPath(variables map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := variables[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			variables[name] = next
+		}
+		variables = next
+	}
+	variables[path[len(path)-1]] = value
+}
+
+// a variable referenced by a template
+type reference struct {
+	name string
+	// false when only conditions read the variable, a condition without a value is false
+	required bool
+	// of the first reference
+	position token.Position
+}
+
+// the variables referenced by the template in the order they first appear, including the ones of the included
+// documents when the includes are resolved. the items of the `$for` loops are not variables of the template.
+func references(root ast.JsonNode) []*reference {
+	rs := make([]*reference, 0)
+	found := make(map[string]*reference)
+	items := make([]string, 0)
+	add := func(name string, required bool, node ast.JsonNode) {
+		head, _, _ := strings.Cut(name, ".")
+		for _, item := range items {
+			if item == head {
+				return
+			}
+		}
+		if ref, ok := found[name]; ok {
+			ref.required = ref.required || required
+			return
+		}
+		ref := &reference{name: name, required: required}
+		if position, ok := node.GetMeta(ast.POSITION_META).(token.Position); ok {
+			ref.position = position
+		}
+		found[name] = ref
+		rs = append(rs, ref)
+	}
+	ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+		object, isObject := ctx.Node.(*ast.JsonObjectNode)
+		if ctx.Event == ast.WalkLeave {
+			if isObject && object.Loop != nil {
+				items = items[:len(items)-1]
+			}
+			return ast.WalkContinue
+		}
+		for _, c := range ctx.Node.GetConditions() {
+			add(c.Variable, false, ctx.Node)
+		}
+		switch n := ctx.Node.(type) {
+		case *ast.JsonExtendedVariableNode:
+			if n.Include == "" {
+				add(n.Variable, true, n)
+			}
+		case *ast.JsonExtendedStringWIthVariableNode:
+			for _, name := range sortedNames(n.Variables) {
+				add(name, true, n)
+			}
+		}
+		if !isObject {
+			return ast.WalkContinue
+		}
+		for _, kv := range object.Value {
+			for _, c := range kv.GetConditions() {
+				add(c.Variable, false, kv)
+			}
+			if name, ok := kv.SpreadVariable(); ok {
+				add(name, true, kv)
+			}
+			if key, ok := kv.Key.(*ast.JsonExtendedStringWIthVariableNode); ok {
+				for _, name := range sortedNames(key.Variables) {
+					add(name, true, kv)
+				}
+			}
+		}
+		if object.Loop != nil {
+			add(object.Loop.Source, true, object)
+			items = append(items, object.Loop.Item)
+		}
+		return ast.WalkContinue
+	})
+	return rs
+}
+
+func sortedNames(variables map[string][]byte) []string {
+	rs := make([]string, 0, len(variables))
+	for name := range variables {
+		rs = append(rs, name)
+	}
+	sort.Strings(rs)
+	return rs
+}
+
+// the required variables of the template without a value, each error tells where the variable is first used
+func missingVariables(root ast.JsonNode, variables map[string]interface{}) []error {
+	rs := make([]error, 0)
+	for _, ref := range references(root) {
+		if !ref.required || hasValue(variables, ref.name) {
+			continue
+		}
+		err := fmt.Errorf("%w %s", errNoValue, ref.name)
+		if ref.position.Line == 0 {
+			rs = append(rs, err)
+			continue
+		}
+		rs = append(rs, &token.PositionError{Position: ref.position, Err: err})
+	}
+	return rs
+}
+
+// the same lookup as the interpreter: the full name, then the dotted path into the value of the first name
+func hasValue(variables map[string]interface{}, name string) bool {
+	if _, ok := variables[name]; ok {
+		return true
+	}
+	path := strings.Split(name, ".")
+	if value, ok := variables[path[0]]; ok && len(path) > 1 {
+		_, ok = util.LookupPath(value, path[1:])
+		return ok
+	}
+	return false
+}
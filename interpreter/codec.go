@@ -0,0 +1,93 @@
+package interpreter
+
+import (
+	"reflect"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/astbuilder/golang"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// how the values of a type are written and read, for the types that cannot have MarshalJSON/UnmarshalJSON methods
+type codec struct {
+	encode golang.Encoder
+	decode func(data []byte) (reflect.Value, error)
+}
+
+// write the values of T with encode and read them with decode, e.g. time.Duration as "5s". either function can be
+// nil to use the default for that direction. the codec of T is looked up before reflection when Marshal writes a
+// value and before Unmarshal picks how to read one, for T only: a *T is still written as a pointer to T.
+// decode gets `null` when it is read into a T and can fail on it, a null read into a *T leaves the pointer nil
+// without calling decode. the codecs belong to the options they are passed with, there is no global registry.
+func RegisterCodec[T any](encode func(value T) ([]byte, error), decode func(data []byte) (T, error)) Option {
+	return func(o *Options) error {
+		if encode == nil && decode == nil {
+			return ErrorCodecNil
+		}
+		if o.codecs == nil {
+			o.codecs = make(map[reflect.Type]*codec)
+		}
+		c := &codec{}
+		if encode != nil {
+			c.encode = func(v reflect.Value) ([]byte, error) {
+				return encode(v.Interface().(T))
+			}
+		}
+		if decode != nil {
+			c.decode = func(data []byte) (reflect.Value, error) {
+				value, err := decode(data)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				return reflect.ValueOf(&value).Elem(), nil
+			}
+		}
+		o.codecs[reflect.TypeOf((*T)(nil)).Elem()] = c
+		return nil
+	}
+}
+
+// the token provider options that write the values with the encoders of the codecs and the time settings
+func (o *Options) marshalOptions(options ...astbuilder.TokenProviderOptions) []astbuilder.TokenProviderOptions {
+	encoders := make(map[reflect.Type]golang.Encoder)
+	for t, c := range o.codecs {
+		if c.encode != nil {
+			encoders[t] = c.encode
+		}
+	}
+	if len(encoders) > 0 {
+		options = append(options, golang.WithEncoders(encoders))
+	}
+	if o.durationAsNanoseconds {
+		options = append(options, golang.EnableDurationAsNanoseconds)
+	}
+	return options
+}
+
+// the marshaler of the variable values, it writes the values with the codecs of the options
+func (o *Options) marshaler() func(v interface{}) ([]byte, error) {
+	options := o.marshalOptions()
+	if len(options) == 0 {
+		return Marshal
+	}
+	return func(v interface{}) ([]byte, error) {
+		return marshal(v, 1, nil, options)
+	}
+}
+
+// the decoder of the type, the codec comes before the time types, nil when there is none
+func (o *unmarshallOptions) decoderOf(t reflect.Type, extendOption *util.JsonExtendOptions) func(data []byte) (reflect.Value, error) {
+	if c, ok := o.codecs[t]; ok && c.decode != nil {
+		return c.decode
+	}
+	return timeDecoder(t, extendOption)
+}
+
+// the values of the named types, e.g. time.Duration, go through the marshaler so that their codecs apply
+func isBuiltinPrimitive(varVal interface{}) bool {
+	value := reflect.ValueOf(varVal)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	return util.IsPrimitiveType(value) && value.Type().PkgPath() == ""
+}
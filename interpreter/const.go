@@ -1 +1,6 @@
 package interpreter
+
+const (
+	// variables bound to a synthetic node created when expanding template extensions (e.g. the entries of a spread)
+	SCOPE_META = "scope"
+)
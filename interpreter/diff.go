@@ -0,0 +1,36 @@
+package interpreter
+
+import (
+	"bytes"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// write the changes from ast.Diff as RFC 6902 JSON Patch. the values are written as template text, a `${name}`
+// stays a variable, the patch of two templates is itself a template to render with the variables.
+func FormatPatch(changes []ast.Change) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, change := range changes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"op":"`)
+		buf.WriteString(change.Type.String())
+		buf.WriteString(`","path":`)
+		buf.Write(util.EncodeToJsonString(change.Path))
+		if change.Type != ast.CHANGE_REMOVE {
+			// the spaces of a lossless AST are not written into the patch
+			value, err := FormatTemplate(ast.Clone(change.To, ast.CloneWithoutMeta()), "")
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(`,"value":`)
+			buf.Write(bytes.TrimSuffix(value, []byte{'\n'}))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
@@ -3,6 +3,7 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -72,6 +73,7 @@ const (
 	VariableNotFound          = "variable value for %s not found"
 	FieldNotValid             = "field not exist %s"
 	KVKindNotMatch            = "expect %s as key but value is not :%#v"
+	IncludeCycle              = "include cycle: %s"
 )
 
 var (
@@ -87,6 +89,22 @@ var (
 	ErrorUnsupportedDataKind                           = errors.New("unsupported variable data kind")
 	ErrorInvalidJson                                   = errors.New("invalid json")
 	ErrorSelfCallTooDeep                               = errors.New("recursion depth exceeded")
+	ErrorSpreadNotObject                               = errors.New("object spread variable should be a map with string keys")
+	ErrorSpreadNotArray                                = errors.New("array spread variable should be a slice or array")
+	ErrorSpreadOutsideCollection                       = errors.New("spread variable can only be used as an array element or as the value of the `...` key")
+	ErrorLoopNotArray                                  = errors.New("`$for` variable should be a slice or array")
+	ErrorIncludeWithoutFS                              = errors.New("`${include:path}` requires a file system to include from, see WithIncludeFS")
+	ErrorIncludeFSNil                                  = errors.New("include file system is nil")
+	ErrorIncludeTooDeep                                = errors.New("include depth exceeded")
+	ErrorNumberNotFinite                               = errors.New("Infinity and NaN cannot be written as json")
+	ErrorPluginNil                                     = errors.New("plugin is nil")
+	ErrorCodecNil                                      = errors.New("codec has neither encode nor decode")
+	ErrorClockNil                                      = errors.New("clock is nil")
+	ErrorBoundVariablesNil                             = errors.New("bound variables map is nil")
+	ErrorAutoVariablesNil                              = errors.New("auto variables map is nil")
+	ErrorExtractMismatch                               = errors.New("document does not match the template")
+	ErrorExtractConflict                               = errors.New("variable has different values in the document")
+	ErrorExtractAmbiguous                              = errors.New("template cannot be aligned with the document")
 )
 
 type ErrorFieldNotExist struct {
@@ -109,3 +127,6 @@ func NewVariableNotFound(variable string) error {
 func NewErrorInternalMapKeyValueKindNotMatch(kind string, value interface{}) error {
 	return fmt.Errorf(KVKindNotMatch, kind, value)
 }
+func NewErrorIncludeCycle(chain []string) error {
+	return fmt.Errorf(IncludeCycle, strings.Join(chain, " -> "))
+}
@@ -0,0 +1,425 @@
+package interpreter
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// template extensions that change the shape of a collection (e.g. spread, conditions, loops) are expanded right before a visitor
+// walks into the collection, the expanded members are handed to the visitor instead of the node's own Value.
+// the Value of the collections and the body of the loops stay unmodified, the loop elements are copies of the body
+// that carry their scope. the rest of the AST is not the template as written: the builder already folds the
+// `${?name}` keys, `$if` and `$for` into the conditions and the loop of the nodes, resolveIncludes puts the included
+// documents in place of their variables and attachPlugins adds the plugins to the matched nodes.
+
+// find the value of a variable referenced by node, variables bound on the node by an expansion take precedence
+func lookupVariable(variables map[string]interface{}, node ast.JsonNode, name string) (interface{}, bool) {
+	if scope, ok := node.GetMeta(SCOPE_META).(map[string]interface{}); ok {
+		if value, ok := lookupName(scope, name); ok {
+			return value, true
+		}
+	}
+	return lookupName(variables, name)
+}
+
+// `name.field.0` reaches into the value of `name` when there is no variable under the full name
+func lookupName(variables map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := variables[name]; ok {
+		return value, true
+	}
+	path := strings.Split(name, ".")
+	if len(path) == 1 {
+		return nil, false
+	}
+	value, ok := variables[path[0]]
+	if !ok {
+		return nil, false
+	}
+	return util.LookupPath(value, path[1:])
+}
+
+// bind the scope to the node and all its children
+func bindScope(node ast.JsonNode, scope map[string]interface{}) {
+	s := util.NewStack[ast.JsonNode]()
+	s.Push(node)
+	for {
+		item, err := s.Pop()
+		if err != nil {
+			break
+		}
+		item.SetMeta(SCOPE_META, scope)
+		switch n := item.(type) {
+		case *ast.JsonArrayNode:
+			for _, element := range n.Value {
+				s.Push(element)
+			}
+		case *ast.JsonObjectNode:
+			for _, kv := range n.Value {
+				s.Push(kv)
+			}
+			if n.Loop != nil {
+				s.Push(n.Loop.Body)
+			}
+		case *ast.JsonKeyValuePairNode:
+			s.Push(n.Key)
+			s.Push(n.Value)
+		}
+	}
+}
+
+// one copy of the loop body for each element of the loop variable, the element is bound to the item variable
+func expandLoop(node *ast.JsonObjectNode, variables map[string]interface{}) ([]ast.JsonNode, error) {
+	value, ok := lookupVariable(variables, node, node.Loop.Source)
+	if !ok {
+		return nil, NewVariableNotFound(node.Loop.Source)
+	}
+	v := removePointers(value)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrorLoopNotArray
+	}
+	parent, _ := node.GetMeta(SCOPE_META).(map[string]interface{})
+	elements := make([]ast.JsonNode, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		scope := maps.Clone(parent)
+		if scope == nil {
+			scope = make(map[string]interface{})
+		}
+		scope[node.Loop.Item] = v.Index(i).Interface()
+		element := ast.Clone(node.Loop.Body)
+		bindScope(element, scope)
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// a variable node bound to value, it is used as the value of an entry that comes from a spread
+func newScopedVariableNode(variable string, value interface{}) (ast.JsonNode, error) {
+	node, err := ast.NodeFactory(ast.AST_VARIABLE, []byte(fmt.Sprintf("${%s}", variable)))
+	if err != nil {
+		return nil, err
+	}
+	node.SetMeta(SCOPE_META, map[string]interface{}{variable: value})
+	return node, nil
+}
+
+func removePointers(value interface{}) reflect.Value {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func spreadObjectEntries(variable string, value interface{}) ([]*ast.JsonKeyValuePairNode, error) {
+	v := removePointers(value)
+	if !v.IsValid() {
+		// spreading nil adds nothing
+		return nil, nil
+	}
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, ErrorSpreadNotObject
+	}
+	keys := v.MapKeys()
+	// go map has no order, keep the output stable
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	entries := make([]*ast.JsonKeyValuePairNode, 0, len(keys))
+	for _, key := range keys {
+		keyNode, err := ast.NodeFactory(ast.AST_STRING, util.EncodeToJsonString(key.String()))
+		if err != nil {
+			return nil, err
+		}
+		kvNode, err := ast.NodeFactory(ast.AST_KVPAIR, keyNode)
+		if err != nil {
+			return nil, err
+		}
+		valueNode, err := newScopedVariableNode(variable, v.MapIndex(key).Interface())
+		if err != nil {
+			return nil, err
+		}
+		kv := kvNode.(*ast.JsonKeyValuePairNode)
+		kv.Value = valueNode
+		entries = append(entries, kv)
+	}
+	return entries, nil
+}
+
+func spreadArrayElements(variable string, value interface{}) ([]ast.JsonNode, error) {
+	v := removePointers(value)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrorSpreadNotArray
+	}
+	elements := make([]ast.JsonNode, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		element, err := newScopedVariableNode(variable, v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// the key of an object member after variable substitution, only used to settle duplicated keys
+func renderedMemberKey(kv *ast.JsonKeyValuePairNode, variables map[string]interface{}) string {
+	key, err := kv.Key.GetValue()
+	if err != nil {
+		return kv.Key.String()
+	}
+	if stringVariable, ok := kv.Key.(*ast.JsonExtendedStringWIthVariableNode); ok {
+		for name, placeholder := range stringVariable.Variables {
+			if value, ok := lookupVariable(variables, stringVariable, name); ok {
+				key = strings.ReplaceAll(key, string(placeholder), fmt.Sprint(value))
+			}
+		}
+	}
+	return key
+}
+
+// nil, false, zero numbers, empty strings and empty collections are falsy, so is a variable that is not provided
+func isTruthy(value interface{}) bool {
+	v := removePointers(value)
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return v.Len() > 0
+	case reflect.Struct:
+		return true
+	default:
+		return !v.IsZero()
+	}
+}
+
+func conditionsHold(node ast.JsonNode, variables map[string]interface{}) bool {
+	for _, c := range node.GetConditions() {
+		value, ok := lookupVariable(variables, node, c.Variable)
+		if (ok && isTruthy(value)) == c.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func memberIncluded(kv *ast.JsonKeyValuePairNode, variables map[string]interface{}) bool {
+	return conditionsHold(kv, variables) && conditionsHold(kv.Value, variables)
+}
+
+func hasExtendedMember(node *ast.JsonObjectNode) bool {
+	for _, kv := range node.Value {
+		if _, ok := kv.SpreadVariable(); ok {
+			return true
+		}
+		if len(kv.GetConditions()) > 0 || len(kv.Value.GetConditions()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// with a duplicate key policy, the keys with variables are rendered to find the duplicates
+func objectNeedsExpansion(node *ast.JsonObjectNode, duplicateKeys ast.DuplicateKeyPolicy) bool {
+	if hasExtendedMember(node) {
+		return true
+	}
+	if duplicateKeys == ast.DUPLICATE_KEY_ALLOW {
+		return false
+	}
+	for _, kv := range node.Value {
+		if kv.Key.GetNodeType() == ast.AST_STRING_VARIABLE {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtendedElement(node *ast.JsonArrayNode) bool {
+	for _, element := range node.Value {
+		if variableNode, ok := element.(*ast.JsonExtendedVariableNode); ok && variableNode.Spread {
+			return true
+		}
+		if len(element.GetConditions()) > 0 {
+			return true
+		}
+		if objectNode, ok := element.(*ast.JsonObjectNode); ok && objectNode.Loop != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// drop the members whose conditions do not hold and expand the spread members of an object.
+// without a duplicate key policy a spread entry overrides the member with the same key and stays at the position
+// of the first one (`{"a": 1, "...": ${m}}` lets m override a), the other duplicates are all kept.
+// with a policy the keys from a spread follow it the same as the keys written in the document.
+// a spread whose variable is missing is kept as it is, so that it can be interpreted later.
+func expandObjectMembers(node *ast.JsonObjectNode, variables map[string]interface{}, duplicateKeys ast.DuplicateKeyPolicy) ([]*ast.JsonKeyValuePairNode, error) {
+	if !objectNeedsExpansion(node, duplicateKeys) {
+		return node.Value, nil
+	}
+	type memberSlot struct {
+		index  int
+		spread bool
+		// where the key is written, the spread member for the entries of a spread
+		at ast.JsonNode
+	}
+	members := make([]*ast.JsonKeyValuePairNode, 0, len(node.Value))
+	slots := make(map[string]memberSlot)
+	addMember := func(key string, kv *ast.JsonKeyValuePairNode, spread bool, at ast.JsonNode) error {
+		slot, ok := slots[key]
+		if !ok {
+			slots[key] = memberSlot{index: len(members), spread: spread, at: at}
+			members = append(members, kv)
+			return nil
+		}
+		switch duplicateKeys {
+		case ast.DUPLICATE_KEY_ALLOW:
+			if !spread && !slot.spread {
+				members = append(members, kv)
+				return nil
+			}
+		case ast.DUPLICATE_KEY_FIRST_WINS:
+			return nil
+		case ast.DUPLICATE_KEY_ERROR:
+			return ast.NewDuplicateKeyError(key, slot.at, at)
+		}
+		slots[key] = memberSlot{index: slot.index, spread: spread, at: at}
+		members[slot.index] = kv
+		return nil
+	}
+	for _, kv := range node.Value {
+		if !memberIncluded(kv, variables) {
+			continue
+		}
+		variable, isSpread := kv.SpreadVariable()
+		if !isSpread {
+			err := addMember(renderedMemberKey(kv, variables), kv, false, kv)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		value, ok := lookupVariable(variables, kv.Value, variable)
+		if !ok {
+			members = append(members, kv)
+			continue
+		}
+		entries, err := spreadObjectEntries(variable, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			err = addMember(renderedMemberKey(entry, variables), entry, true, kv)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return members, nil
+}
+
+// drop the elements whose conditions do not hold, expand the `${...name}` elements and the `$for` loops of an array
+func expandArrayElements(node *ast.JsonArrayNode, variables map[string]interface{}) ([]ast.JsonNode, error) {
+	if !hasExtendedElement(node) {
+		return node.Value, nil
+	}
+	elements := make([]ast.JsonNode, 0, len(node.Value))
+	for _, element := range node.Value {
+		if !conditionsHold(element, variables) {
+			continue
+		}
+		if objectNode, ok := element.(*ast.JsonObjectNode); ok && objectNode.Loop != nil {
+			loopElements, err := expandLoop(objectNode, variables)
+			if err != nil {
+				return nil, err
+			}
+			for _, loopElement := range loopElements {
+				if conditionsHold(loopElement, variables) {
+					elements = append(elements, loopElement)
+				}
+			}
+			continue
+		}
+		variableNode, ok := element.(*ast.JsonExtendedVariableNode)
+		if !ok || !variableNode.Spread {
+			elements = append(elements, element)
+			continue
+		}
+		value, ok := lookupVariable(variables, variableNode, variableNode.Variable)
+		if !ok {
+			elements = append(elements, element)
+			continue
+		}
+		spread, err := spreadArrayElements(variableNode.Variable, value)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, spread...)
+	}
+	return elements, nil
+}
+
+// for the visitors that need to know the size of a collection before walking into it (unmarshal),
+// return a collection node holding the expanded members, or the node itself when nothing is expanded.
+func expandCollectionNode(node ast.JsonNode, variables map[string]interface{}, duplicateKeys ast.DuplicateKeyPolicy) (ast.JsonNode, error) {
+	switch collection := node.(type) {
+	case *ast.JsonObjectNode:
+		if collection.Loop != nil {
+			return expandCollectionNode(loopArrayNode(collection), variables, duplicateKeys)
+		}
+		if !objectNeedsExpansion(collection, duplicateKeys) {
+			return node, nil
+		}
+		members, err := expandObjectMembers(collection, variables, duplicateKeys)
+		if err != nil {
+			return nil, err
+		}
+		rs := &ast.JsonObjectNode{Value: members}
+		copyPluginsAndMeta(collection, rs)
+		return rs, nil
+	case *ast.JsonArrayNode:
+		if !hasExtendedElement(collection) {
+			return node, nil
+		}
+		elements, err := expandArrayElements(collection, variables)
+		if err != nil {
+			return nil, err
+		}
+		rs := &ast.JsonArrayNode{Value: elements}
+		copyPluginsAndMeta(collection, rs)
+		return rs, nil
+	default:
+		return node, nil
+	}
+}
+
+// the expanded collection takes the place of the collection, so do the plugins and the meta attached to it
+func copyPluginsAndMeta(from ast.JsonNode, to ast.JsonNode) {
+	for _, plugin := range from.GetPlugins() {
+		to.AddPlugin(plugin)
+	}
+	for key, value := range from.GetMetas() {
+		to.SetMeta(key, value)
+	}
+}
+
+// out of an array, a loop is rendered as an array holding the loop
+func loopArrayNode(node *ast.JsonObjectNode) *ast.JsonArrayNode {
+	return &ast.JsonArrayNode{Value: []ast.JsonNode{node}}
+}
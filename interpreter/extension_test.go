@@ -0,0 +1,268 @@
+package interpreter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/interpreter"
+	"github.com/jaksonlin/go-jsonextend/tokenizer"
+)
+
+func parse(t *testing.T, template string) ast.JsonNode {
+	sm := tokenizer.NewTokenizerStateMachineFromIOReader(strings.NewReader(template))
+	err := sm.ProcessData()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	return sm.GetAST()
+}
+
+func TestSpreadObjectAndArray(t *testing.T) {
+	const template = `{"name": "base", "...": ${labels}, "items": [0, ${...items}, 3]}`
+	variables := map[string]interface{}{
+		"labels": map[string]interface{}{"name": "override", "env": "prod"},
+		"items":  []int{1, 2},
+	}
+	type result struct {
+		Name  string `json:"name"`
+		Env   string `json:"env"`
+		Items []int  `json:"items"`
+	}
+	var out result
+	err := interpreter.Unmarshal(strings.NewReader(template), variables, &out)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.Name != "override" || out.Env != "prod" || len(out.Items) != 4 || out.Items[1] != 1 || out.Items[2] != 2 {
+		t.FailNow()
+	}
+
+	rs, err := interpreter.InterpretAST(parse(t, template), variables, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	// later keys win and keep the position of the first occurrence, map entries are sorted
+	if string(rs) != `{"name":"override","env":"prod","items":[0,1,2,3]}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+}
+
+func TestSpreadKeepsPluginsAndMeta(t *testing.T) {
+	seen := make([]interface{}, 0)
+	plugin := ast.NewASTNodePlugin("owner", func(visitor ast.JsonVisitor, node ast.JsonNode) error {
+		seen = append(seen, node.GetMeta("owner"))
+		return nil
+	}, nil)
+	root := parse(t, `{"object": {"...": ${labels}}, "array": [${...items}]}`).(*ast.JsonObjectNode)
+	for _, kv := range root.Value {
+		kv.Value.SetMeta("owner", kv.Key.String())
+		kv.Value.AddPlugin(plugin)
+	}
+	variables := map[string]interface{}{"labels": map[string]interface{}{"env": "prod"}, "items": []int{1}}
+	var out map[string]interface{}
+	if err := interpreter.UnmarshallAST(root, variables, nil, nil, &out); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(seen) != 2 || seen[0] != root.Value[0].Key.String() || seen[1] != root.Value[1].Key.String() {
+		t.Log(seen)
+		t.FailNow()
+	}
+}
+
+func TestSpreadKeyForm(t *testing.T) {
+	variables := map[string]interface{}{"labels": map[string]string{"env": "prod"}}
+	rs, err := interpreter.InterpretAST(parse(t, `{"env": "dev", "${...labels}": null, "app": "demo"}`), variables, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `{"env":"prod","app":"demo"}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+}
+
+func TestSpreadMissingVariableKeptAsIs(t *testing.T) {
+	rs, err := interpreter.InterpretAST(parse(t, `{"...": ${labels}, "items": [${...items}]}`), map[string]interface{}{}, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `{"...":${labels},"items":[${...items}]}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+}
+
+func TestSpreadErrors(t *testing.T) {
+	variables := map[string]interface{}{
+		"labels": map[string]interface{}{"a": 1},
+		"items":  []int{1, 2},
+	}
+	cases := map[string]error{
+		`{"...": ${items}}`:  interpreter.ErrorSpreadNotObject,
+		`[${...labels}]`:     interpreter.ErrorSpreadNotArray,
+		`{"a": ${...items}}`: interpreter.ErrorSpreadOutsideCollection,
+	}
+	for template, expected := range cases {
+		_, err := interpreter.InterpretAST(parse(t, template), variables, interpreter.Marshal)
+		if err != expected {
+			t.Log(template, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestConditionalKeys(t *testing.T) {
+	const template = `{"${?tls}tls": {"port": 443}, "${?debug}debug": true, "${?!debug}quiet": true, "${?tls}${name}": 1, "${?missing}m": 1}`
+	variables := map[string]interface{}{"tls": true, "debug": 0, "name": "app"}
+	rs, err := interpreter.InterpretAST(parse(t, template), variables, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `{"tls":{"port":443},"quiet":true,"app":1}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+}
+
+func TestConditionalObjects(t *testing.T) {
+	const template = `{"items": [1, {"$if": ${tls}, "$value": "tls"}, {"$unless": ${tls}, "$value": "plain"}, {"$if": ${list}, "k": 1}, {"$if": ${name}, "k": 2}], "cert": {"$if": ${debug}, "path": "/tmp"}}`
+	variables := map[string]interface{}{"tls": true, "debug": false, "name": "app", "list": []int{}}
+	rs, err := interpreter.InterpretAST(parse(t, template), variables, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `{"items":[1,"tls",{"k":2}]}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+
+	var out struct {
+		Items []interface{}     `json:"items"`
+		Cert  map[string]string `json:"cert"`
+	}
+	err = interpreter.Unmarshal(strings.NewReader(template), variables, &out)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(out.Items) != 3 || out.Items[1] != "tls" || out.Cert != nil {
+		t.Log(out)
+		t.FailNow()
+	}
+}
+
+func TestLoop(t *testing.T) {
+	type service struct {
+		Name string   `json:"name"`
+		Port int      `json:"port"`
+		Tags []string `json:"tags"`
+	}
+	const template = `{"services": [0, {"$for": "svc in ${services}", "$do": {"name": "${svc.name}-${env}", "port": ${svc.port}, "${?svc.port}public": true, "tags": [{"$for": "tag in ${svc.tags}", "$do": "${svc.name}:${tag}"}]}}], "names": {"$for": "svc in ${services}", "$do": ${svc.name}}}`
+	variables := map[string]interface{}{
+		"env":      "prod",
+		"services": []service{{Name: "web", Port: 80, Tags: []string{"a"}}, {Name: "worker"}},
+	}
+	rs, err := interpreter.InterpretAST(parse(t, template), variables, interpreter.Marshal)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `{"services":[0,{"name":"web-prod","port":80,"public":true,"tags":["web:a"]},{"name":"worker-prod","port":0,"tags":[]}],"names":["web","worker"]}` {
+		t.Log(string(rs))
+		t.FailNow()
+	}
+
+	var out struct {
+		Names []string `json:"names"`
+	}
+	err = interpreter.Unmarshal(strings.NewReader(template), variables, &out)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(out.Names) != 2 || out.Names[1] != "worker" {
+		t.FailNow()
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	_, err := interpreter.InterpretAST(parse(t, `[{"$for": "svc in ${services}", "$do": 1}]`), map[string]interface{}{"services": 1}, interpreter.Marshal)
+	if err != interpreter.ErrorLoopNotArray {
+		t.Log(err)
+		t.FailNow()
+	}
+	sm := tokenizer.NewTokenizerStateMachineFromIOReader(strings.NewReader(`[{"$for": "svc of ${services}", "$do": 1}]`))
+	if !errors.Is(sm.ProcessData(), ast.ErrorASTLoopClauseFormat) {
+		t.FailNow()
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	variables := map[string]interface{}{"key": "a", "defaults": map[string]interface{}{"a": 9}, "extra": map[string]interface{}{"b": 9}}
+	testCases := map[ast.DuplicateKeyPolicy]map[string]string{
+		ast.DUPLICATE_KEY_ALLOW: {
+			`{"a": 1, "b": 2, "a": 3}`: `{"a":1,"b":2,"a":3}`,
+			`{"a": 1, "${key}": 2}`:    `{"a":1,"a":2}`,
+		},
+		ast.DUPLICATE_KEY_FIRST_WINS: {
+			`{"a": 1, "b": 2, "a": 3}`:     `{"a":1,"b":2}`,
+			`{"a": 1, "${key}": 2}`:        `{"a":1}`,
+			`{"a": 1, "...": ${defaults}}`: `{"a":1}`,
+		},
+		ast.DUPLICATE_KEY_LAST_WINS: {
+			`{"a": 1, "b": 2, "a": 3}`:     `{"a":3,"b":2}`,
+			`{"a": 1, "${key}": 2}`:        `{"a":2}`,
+			`{"a": 1, "...": ${defaults}}`: `{"a":9}`,
+		},
+	}
+	for policy, cases := range testCases {
+		for template, expected := range cases {
+			result, err := interpreter.ParseJsonExtendDocument(strings.NewReader(template), variables, interpreter.WithDuplicateKeys(policy))
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+			if strings.Join(strings.Fields(string(result)), "") != expected {
+				t.Log(policy, template, string(result))
+				t.FailNow()
+			}
+		}
+	}
+
+	errorCases := map[string]string{
+		"{\"a\": 1,\n \"a\": 2}":       `duplicate key "a" at 2:2, first defined at 1:2`,
+		`{"a": 1, "${key}": 2}`:        `duplicate key "a" at 1:10, first defined at 1:2`,
+		`{"b": {"a": 1, "a": 2}}`:      `duplicate key "a" at 1:16, first defined at 1:8`,
+		`{"a": 1, "...": ${defaults}}`: `duplicate key "a" at 1:10, first defined at 1:2`,
+	}
+	for template, expected := range errorCases {
+		var out map[string]interface{}
+		err := interpreter.Unmarshal(strings.NewReader(template), variables, &out, interpreter.WithDuplicateKeys(ast.DUPLICATE_KEY_ERROR))
+		if !errors.Is(err, ast.ErrorASTDuplicateKey) || err.Error() != expected {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+
+	// the keys of exclusive conditions are not duplicates
+	result, err := interpreter.ParseJsonExtendDocument(strings.NewReader(`{"${?key}a": 1, "${?!key}a": 2, "...": ${extra}}`), variables, interpreter.WithDuplicateKeys(ast.DUPLICATE_KEY_ERROR))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if strings.Join(strings.Fields(string(result)), "") != `{"a":1,"b":9}` {
+		t.Log(string(result))
+		t.FailNow()
+	}
+}
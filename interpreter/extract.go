@@ -0,0 +1,501 @@
+package interpreter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// a variable taken out of the document with two different values
+type ExtractConflictError struct {
+	Variable string
+	// the JSON Pointers (RFC 6901) in the document where the values are
+	FirstPath  string
+	SecondPath string
+	First      interface{}
+	Second     interface{}
+}
+
+func (e *ExtractConflictError) Error() string {
+	return fmt.Sprintf("variable %q is %v at %q and %v at %q", e.Variable, e.First, e.FirstPath, e.Second, e.SecondPath)
+}
+
+func (e *ExtractConflictError) Unwrap() error {
+	return ErrorExtractConflict
+}
+
+func newExtractMismatch(path string, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at %q", ErrorExtractMismatch, fmt.Sprintf(format, args...), path)
+}
+
+type extractBinding struct {
+	value interface{}
+	path  string
+	// from a condition, the value is only known to be truthy or falsy
+	weak bool
+}
+
+type extractItem struct {
+	template ast.JsonNode
+	document ast.JsonNode
+	path     string
+}
+
+type extraction struct {
+	bindings map[string]*extractBinding
+}
+
+func newExtraction() *extraction {
+	return &extraction{bindings: make(map[string]*extractBinding)}
+}
+
+// the variables that render the template into the document, e.g. to find the drift between a deployed config and
+// its template. `${name}` takes the value at its place, a string with variables takes the text between its literal
+// parts, a spread takes the entries or elements left over, `$for` takes one item per element and a condition is
+// true when its member or element is there. the dotted variables are returned as nested maps.
+// a variable taken with two different values fails with *ExtractConflictError, a document without the shape of
+// the template fails with ErrorExtractMismatch. neither of the nodes is changed.
+func Extract(template ast.JsonNode, document ast.JsonNode) (map[string]interface{}, error) {
+	e := newExtraction()
+	if err := e.extract(template, ast.Clone(document), ""); err != nil {
+		return nil, err
+	}
+	return e.variables()
+}
+
+func (e *extraction) extract(template ast.JsonNode, document ast.JsonNode, path string) error {
+	s := util.NewStack[extractItem]()
+	s.Push(extractItem{template, document, path})
+	for !s.IsEmpty() {
+		item, _ := s.Pop()
+		next, err := e.align(item)
+		if err != nil {
+			return err
+		}
+		for i := len(next) - 1; i >= 0; i-- {
+			s.Push(next[i])
+		}
+	}
+	return nil
+}
+
+// bind the variables of the template node, return the children to align
+func (e *extraction) align(item extractItem) ([]extractItem, error) {
+	if item.template == nil || item.document == nil {
+		return nil, newExtractMismatch(item.path, "nothing to align")
+	}
+	switch t := item.template.(type) {
+	case *ast.JsonExtendedVariableNode:
+		if t.Spread || t.Include != "" {
+			return nil, fmt.Errorf("%w: %s at %q", ErrorExtractAmbiguous, t.Value, item.path)
+		}
+		value, err := documentValue(item.document)
+		if err != nil {
+			return nil, err
+		}
+		return nil, e.bind(t.Variable, value, item.path, false)
+	case *ast.JsonExtendedStringWIthVariableNode:
+		return nil, e.alignString(t, item.document, item.path)
+	case *ast.JsonObjectNode:
+		if t.Loop != nil {
+			// out of an array, the loop is rendered as an array
+			d, ok := item.document.(*ast.JsonArrayNode)
+			if !ok {
+				return nil, newExtractMismatch(item.path, "expect an array")
+			}
+			return nil, e.alignLoop(t.Loop, d.Value, item.path, 0)
+		}
+		d, ok := item.document.(*ast.JsonObjectNode)
+		if !ok || d.Loop != nil {
+			return nil, newExtractMismatch(item.path, "expect an object")
+		}
+		return e.alignObject(t, d, item.path)
+	case *ast.JsonArrayNode:
+		d, ok := item.document.(*ast.JsonArrayNode)
+		if !ok {
+			return nil, newExtractMismatch(item.path, "expect an array")
+		}
+		return e.alignArray(t, d, item.path)
+	default:
+		expected, err := documentValue(ast.Clone(item.template))
+		if err != nil {
+			return nil, err
+		}
+		value, err := documentValue(item.document)
+		if err != nil {
+			return nil, err
+		}
+		if item.template.GetNodeType() != item.document.GetNodeType() || !reflect.DeepEqual(expected, value) {
+			return nil, newExtractMismatch(item.path, "expect %v, find %v", expected, value)
+		}
+		return nil, nil
+	}
+}
+
+// the literal text around the variables are the anchors, the variables take the text between them
+func (e *extraction) alignString(template *ast.JsonExtendedStringWIthVariableNode, document ast.JsonNode, path string) error {
+	d, ok := document.(*ast.JsonStringNode)
+	if !ok {
+		return newExtractMismatch(path, "expect a string")
+	}
+	text, err := template.GetValue()
+	if err != nil {
+		return err
+	}
+	value, err := d.GetValue()
+	if err != nil {
+		return err
+	}
+	return e.bindStringTemplate(text, value, path)
+}
+
+func (e *extraction) bindStringTemplate(template string, value string, path string) error {
+	variables, ok := util.MatchStringTemplate(template, value)
+	if !ok {
+		return newExtractMismatch(path, "%q does not match %q", value, template)
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.bind(name, variables[name], path, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extraction) alignObject(template *ast.JsonObjectNode, document *ast.JsonObjectNode, path string) ([]extractItem, error) {
+	// the members of the document by key, the last one wins
+	order := make([]string, 0, len(document.Value))
+	members := make(map[string]*ast.JsonKeyValuePairNode, len(document.Value))
+	for _, kv := range document.Value {
+		if kv.Key == nil || kv.Value == nil {
+			continue
+		}
+		key, err := kv.Key.GetValue()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := members[key]; !ok {
+			order = append(order, key)
+		}
+		members[key] = kv
+	}
+	claimed := make(map[string]bool)
+	next := make([]extractItem, 0)
+	present := func(kv *ast.JsonKeyValuePairNode, key string) error {
+		claimed[key] = true
+		next = append(next, extractItem{kv.Value, members[key].Value, path + "/" + pointerToken(key)})
+		return e.bindConditions(memberConditions(kv), true, path)
+	}
+	absent := func(kv *ast.JsonKeyValuePairNode, key string) error {
+		conditions := memberConditions(kv)
+		if len(conditions) == 0 {
+			return newExtractMismatch(path, "member %q is missing", key)
+		}
+		return e.bindConditions(conditions, false, path)
+	}
+
+	spread := ""
+	variableKeys := make([]*ast.JsonKeyValuePairNode, 0)
+	for _, kv := range template.Value {
+		if kv.Key == nil || kv.Value == nil {
+			continue
+		}
+		if variable, ok := kv.SpreadVariable(); ok {
+			if spread != "" {
+				return nil, fmt.Errorf("%w: more than one spread at %q", ErrorExtractAmbiguous, path)
+			}
+			spread = variable
+			continue
+		}
+		if kv.Key.GetNodeType() == ast.AST_STRING_VARIABLE {
+			variableKeys = append(variableKeys, kv)
+			continue
+		}
+		key, err := kv.Key.GetValue()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := members[key]; ok && !claimed[key] {
+			err = present(kv, key)
+		} else {
+			err = absent(kv, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the keys with variables take the first member left that matches them
+	for _, kv := range variableKeys {
+		template, err := kv.Key.GetValue()
+		if err != nil {
+			return nil, err
+		}
+		keyTemplate := util.GetStringTemplate(template)
+		matched := ""
+		for _, key := range order {
+			if _, ok := keyTemplate.Match(key); ok && !claimed[key] {
+				matched = key
+				break
+			}
+		}
+		if matched == "" {
+			err = absent(kv, template)
+		} else if err = e.bindStringTemplate(template, matched, path+"/"+pointerToken(matched)); err == nil {
+			err = present(kv, matched)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make(map[string]interface{})
+	for _, key := range order {
+		if claimed[key] {
+			continue
+		}
+		if spread == "" {
+			return nil, newExtractMismatch(path, "member %q is not in the template", key)
+		}
+		value, err := documentValue(members[key].Value)
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = value
+	}
+	if spread != "" {
+		if err := e.bind(spread, entries, path, false); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// the elements around the one spread, loop or conditional element are aligned by position, it takes the rest
+func (e *extraction) alignArray(template *ast.JsonArrayNode, document *ast.JsonArrayNode, path string) ([]extractItem, error) {
+	flexible := -1
+	for i, element := range template.Value {
+		if isFlexibleElement(element) {
+			if flexible >= 0 {
+				return nil, fmt.Errorf("%w: more than one spread, loop or conditional element at %q", ErrorExtractAmbiguous, path)
+			}
+			flexible = i
+		}
+	}
+	elementPath := func(i int) string {
+		return path + "/" + strconv.Itoa(i)
+	}
+	next := make([]extractItem, 0, len(document.Value))
+	if flexible < 0 {
+		if len(template.Value) != len(document.Value) {
+			return nil, newExtractMismatch(path, "expect %d elements, find %d", len(template.Value), len(document.Value))
+		}
+		for i := range template.Value {
+			next = append(next, extractItem{template.Value[i], document.Value[i], elementPath(i)})
+		}
+		return next, nil
+	}
+	prefix, suffix := flexible, len(template.Value)-flexible-1
+	if len(document.Value) < prefix+suffix {
+		return nil, newExtractMismatch(path, "expect at least %d elements, find %d", prefix+suffix, len(document.Value))
+	}
+	for i := 0; i < prefix; i++ {
+		next = append(next, extractItem{template.Value[i], document.Value[i], elementPath(i)})
+	}
+	middle := document.Value[prefix : len(document.Value)-suffix]
+	element := template.Value[flexible]
+	if variable, ok := element.(*ast.JsonExtendedVariableNode); ok && variable.Spread {
+		values := make([]interface{}, 0, len(middle))
+		for _, node := range middle {
+			value, err := documentValue(node)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if err := e.bind(variable.Variable, values, path, false); err != nil {
+			return nil, err
+		}
+	} else if object, ok := element.(*ast.JsonObjectNode); ok && object.Loop != nil {
+		if err := e.alignLoop(object.Loop, middle, path, prefix); err != nil {
+			return nil, err
+		}
+	} else {
+		switch len(middle) {
+		case 0:
+			if err := e.bindConditions(element.GetConditions(), false, elementPath(prefix)); err != nil {
+				return nil, err
+			}
+		case 1:
+			if err := e.bindConditions(element.GetConditions(), true, elementPath(prefix)); err != nil {
+				return nil, err
+			}
+			next = append(next, extractItem{element, middle[0], elementPath(prefix)})
+		default:
+			return nil, newExtractMismatch(path, "expect %d or %d elements, find %d", prefix+suffix, prefix+suffix+1, len(document.Value))
+		}
+	}
+	for i := 0; i < suffix; i++ {
+		index := len(document.Value) - suffix + i
+		next = append(next, extractItem{template.Value[prefix+1+i], document.Value[index], elementPath(index)})
+	}
+	return next, nil
+}
+
+// each element is aligned with the body on its own, the item variable of the elements makes the source variable
+func (e *extraction) alignLoop(loop *ast.Loop, elements []ast.JsonNode, path string, offset int) error {
+	items := make([]interface{}, 0, len(elements))
+	for i, element := range elements {
+		inner := newExtraction()
+		if err := inner.extract(loop.Body, element, path+"/"+strconv.Itoa(offset+i)); err != nil {
+			return err
+		}
+		variables, err := inner.variables()
+		if err != nil {
+			return err
+		}
+		items = append(items, variables[loop.Item])
+		// the other variables of the body are the ones outside the loop
+		names := make([]string, 0, len(inner.bindings))
+		for name := range inner.bindings {
+			if name != loop.Item && !strings.HasPrefix(name, loop.Item+".") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			binding := inner.bindings[name]
+			if err := e.bind(name, binding.value, binding.path, binding.weak); err != nil {
+				return err
+			}
+		}
+	}
+	return e.bind(loop.Source, items, path, false)
+}
+
+func (e *extraction) bindConditions(conditions []ast.Condition, present bool, path string) error {
+	for _, c := range conditions {
+		if err := e.bind(c.Variable, present != c.Negate, path, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// a value from the document replaces a value from a condition when their truthiness agrees
+func (e *extraction) bind(name string, value interface{}, path string, weak bool) error {
+	existing, ok := e.bindings[name]
+	if !ok {
+		e.bindings[name] = &extractBinding{value: value, path: path, weak: weak}
+		return nil
+	}
+	conflict := &ExtractConflictError{Variable: name, FirstPath: existing.path, SecondPath: path, First: existing.value, Second: value}
+	switch {
+	case existing.weak && !weak:
+		if isTruthy(value) != existing.value.(bool) {
+			return conflict
+		}
+		e.bindings[name] = &extractBinding{value: value, path: path}
+	case !existing.weak && weak:
+		if isTruthy(existing.value) != value.(bool) {
+			return conflict
+		}
+	case !extractedValuesEqual(existing.value, value):
+		return conflict
+	default:
+		// the value of `${port}` is kept rather than the text of `"port ${port}"`
+		if _, ok := existing.value.(string); ok {
+			existing.value = value
+		}
+	}
+	return nil
+}
+
+// the text taken out of a string is equal to a value that is written as the same text
+func extractedValuesEqual(a interface{}, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	as, aIsString := a.(string)
+	bs, bIsString := b.(string)
+	switch {
+	case aIsString && !bIsString && util.IsPrimitiveType(reflect.ValueOf(b)):
+		return as == fmt.Sprint(b)
+	case bIsString && !aIsString && util.IsPrimitiveType(reflect.ValueOf(a)):
+		return bs == fmt.Sprint(a)
+	}
+	return false
+}
+
+// the dotted variables are put into nested maps, `${db.host}` is returned as {"db": {"host": ...}}
+func (e *extraction) variables() (map[string]interface{}, error) {
+	names := make([]string, 0, len(e.bindings))
+	for name := range e.bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rs := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		binding := e.bindings[name]
+		parts := strings.Split(name, ".")
+		current := rs
+		for i, part := range parts[:len(parts)-1] {
+			child, ok := current[part]
+			if !ok {
+				child = make(map[string]interface{})
+				current[part] = child
+			}
+			m, ok := child.(map[string]interface{})
+			if !ok {
+				parent := strings.Join(parts[:i+1], ".")
+				return nil, &ExtractConflictError{Variable: parent, FirstPath: e.bindings[parent].path, SecondPath: binding.path, First: child, Second: binding.value}
+			}
+			current = m
+		}
+		last := parts[len(parts)-1]
+		if existing, ok := current[last]; ok && !extractedValuesEqual(existing, binding.value) {
+			return nil, &ExtractConflictError{Variable: name, SecondPath: binding.path, First: existing, Second: binding.value}
+		}
+		current[last] = binding.value
+	}
+	return rs, nil
+}
+
+// a spread, a `$for` loop or an element with conditions, the number of elements it renders is not known
+func isFlexibleElement(element ast.JsonNode) bool {
+	if variable, ok := element.(*ast.JsonExtendedVariableNode); ok && variable.Spread {
+		return true
+	}
+	if object, ok := element.(*ast.JsonObjectNode); ok && object.Loop != nil {
+		return true
+	}
+	return len(element.GetConditions()) > 0
+}
+
+func memberConditions(kv *ast.JsonKeyValuePairNode) []ast.Condition {
+	rs := append([]ast.Condition{}, kv.GetConditions()...)
+	return append(rs, kv.Value.GetConditions()...)
+}
+
+// RFC 6901: `~` is written as `~0` and `/` as `~1`
+func pointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// the go value of a node of the document, as Unmarshal reads it into an interface{}
+func documentValue(node ast.JsonNode) (interface{}, error) {
+	var rs interface{}
+	if err := unmarshallAST(node, NewUnMarshallOptions(nil, Marshal, nil), &rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
@@ -0,0 +1,229 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/astbuilder/bytebase"
+	"github.com/jaksonlin/go-jsonextend/token"
+	"github.com/jaksonlin/go-jsonextend/tokenizer"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// tokenize the document into AST, the included documents are grafted in place of their include nodes
+func parseDocument(reader io.Reader, options *Options) (ast.JsonNode, error) {
+	counter := &readCounter{reader: reader}
+	sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(counter, options.tokenizerOptions)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(sm, &counter.read, options)
+}
+
+// the document is read in place, the ast shares the bytes of data
+func parseDocumentBytes(data []byte, options *Options) (ast.JsonNode, error) {
+	sm, err := tokenizer.NewTokenizerStateMachineFromBytes(data, options.tokenizerOptions)
+	if err != nil {
+		return nil, err
+	}
+	read := len(data)
+	return parseTokens(sm, &read, options)
+}
+
+// read is the number of bytes of the document, the included documents add theirs
+func parseTokens(sm *tokenizer.TokenizerStateMachine, read *int, options *Options) (ast.JsonNode, error) {
+	node, err := tokenizeDocument(sm)
+	if err != nil {
+		return nil, err
+	}
+	return resolveIncludes(node, read, options)
+}
+
+// counts the bytes read, for the size limit of the included documents
+type readCounter struct {
+	reader io.Reader
+	read   int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func tokenizeDocument(sm *tokenizer.TokenizerStateMachine) (ast.JsonNode, error) {
+	err := sm.ProcessData()
+	if err != nil {
+		return nil, err
+	}
+	if sm.GetASTBuilder().HasOpenElements() {
+		return nil, ErrorInvalidJson
+	}
+	return sm.GetAST(), nil
+}
+
+type includeWork struct {
+	node ast.JsonNode
+	// the includes that lead to the document holding the node, the last one is the document itself
+	chain []string
+	// the arrays and objects around the node, an included document starts its depth limit from there
+	depth int
+}
+
+// the limits hold for the document with its included documents: the depth of an included document counts from its
+// include node, and read counts the bytes of all the documents for the size limit
+func resolveIncludes(root ast.JsonNode, read *int, options *Options) (ast.JsonNode, error) {
+	root, chain, err := graftInclude(root, nil, 0, read, options)
+	if err != nil {
+		return nil, err
+	}
+	s := util.NewStack[includeWork]()
+	s.Push(includeWork{root, chain, 0})
+	for {
+		item, err := s.Pop()
+		if err != nil {
+			break
+		}
+		switch n := item.node.(type) {
+		case *ast.JsonArrayNode:
+			for i, element := range n.Value {
+				grafted, chain, err := graftInclude(element, item.chain, item.depth+1, read, options)
+				if err != nil {
+					return nil, err
+				}
+				n.Value[i] = grafted
+				s.Push(includeWork{grafted, chain, item.depth + 1})
+			}
+		case *ast.JsonObjectNode:
+			for _, kv := range n.Value {
+				grafted, chain, err := graftInclude(kv.Value, item.chain, item.depth+1, read, options)
+				if err != nil {
+					return nil, err
+				}
+				kv.Value = grafted
+				s.Push(includeWork{grafted, chain, item.depth + 1})
+			}
+			if n.Loop != nil {
+				grafted, chain, err := graftInclude(n.Loop.Body, item.chain, item.depth+1, read, options)
+				if err != nil {
+					return nil, err
+				}
+				n.Loop.Body = grafted
+				s.Push(includeWork{grafted, chain, item.depth + 1})
+			}
+		}
+	}
+	return root, nil
+}
+
+// replace an include node by the document it refers to, until the node is not an include node
+func graftInclude(node ast.JsonNode, chain []string, depth int, read *int, options *Options) (ast.JsonNode, []string, error) {
+	for {
+		variableNode, ok := node.(*ast.JsonExtendedVariableNode)
+		if !ok || variableNode.Include == "" {
+			return node, chain, nil
+		}
+		if options == nil || options.includeFS == nil {
+			return nil, nil, ErrorIncludeWithoutFS
+		}
+		name := includePath(chain, variableNode.Include)
+		next := make([]string, len(chain), len(chain)+1)
+		copy(next, chain)
+		next = append(next, name)
+		for _, included := range chain {
+			if included == name {
+				return nil, nil, NewErrorIncludeCycle(next)
+			}
+		}
+		if len(next) > maxDepth {
+			return nil, nil, ErrorIncludeTooDeep
+		}
+		included, err := loadIncludedDocument(name, depth, read, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range node.GetConditions() {
+			included.AddCondition(c)
+		}
+		node = included
+		chain = next
+	}
+}
+
+// relative to the directory of the including document, `/` starts from the root of the file system
+func includePath(chain []string, include string) string {
+	if strings.HasPrefix(include, "/") {
+		return path.Clean(strings.TrimLeft(include, "/"))
+	}
+	dir := "."
+	if len(chain) > 0 {
+		dir = path.Dir(chain[len(chain)-1])
+	}
+	return path.Join(dir, include)
+}
+
+// the document is read from the file as it is tokenized, so that the size limit holds before it is all in memory.
+// the limits count from depth and the bytes read before, the bytes of the document are added to read.
+func loadIncludedDocument(name string, depth int, read *int, options *Options) (ast.JsonNode, error) {
+	file, err := options.includeFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	counter := &readCounter{reader: file}
+	tokenizerOptions := append(options.tokenizerOptions[:len(options.tokenizerOptions):len(options.tokenizerOptions)], bytebase.WithLimitsUsed(depth, *read))
+	sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(counter, tokenizerOptions)
+	if err != nil {
+		return nil, err
+	}
+	node, err := tokenizeDocument(sm)
+	*read += counter.read
+	if err != nil {
+		var positionError *token.PositionError
+		if errors.As(err, &positionError) {
+			positionError.Position.File = name
+			return nil, err
+		}
+		var duplicateKeyError *ast.DuplicateKeyError
+		if errors.As(err, &duplicateKeyError) {
+			duplicateKeyError.First.File = name
+			duplicateKeyError.Second.File = name
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	setPositionFile(node, name)
+	return node, nil
+}
+
+// the positions recorded in the included document are in the file of the document
+func setPositionFile(root ast.JsonNode, name string) {
+	s := util.NewStack[ast.JsonNode]()
+	s.Push(root)
+	for !s.IsEmpty() {
+		node, _ := s.Pop()
+		if position, ok := node.GetMeta(ast.POSITION_META).(token.Position); ok {
+			position.File = name
+			node.SetMeta(ast.POSITION_META, position)
+		}
+		switch n := node.(type) {
+		case *ast.JsonArrayNode:
+			for _, element := range n.Value {
+				s.Push(element)
+			}
+		case *ast.JsonObjectNode:
+			for _, kv := range n.Value {
+				s.Push(kv)
+			}
+			if n.Loop != nil {
+				s.Push(n.Loop.Body)
+			}
+		case *ast.JsonKeyValuePairNode:
+			s.Push(n.Value)
+		}
+	}
+}
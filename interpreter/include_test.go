@@ -0,0 +1,136 @@
+package interpreter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jaksonlin/go-jsonextend/astbuilder/bytebase"
+	"github.com/jaksonlin/go-jsonextend/interpreter"
+	"github.com/jaksonlin/go-jsonextend/token"
+)
+
+var includeFS = fstest.MapFS{
+	"base.jsonx":              {Data: []byte(`{"name": "app", "logging": ${include:fragments/logging.jsonx}}`)},
+	"fragments/logging.jsonx": {Data: []byte(`{"level": "${level}", "sinks": [${include:sink.jsonx}]}`)},
+	"fragments/sink.jsonx":    {Data: []byte(`"stdout"`)},
+	"fragments/broken.jsonx":  {Data: []byte("{\n  \"cert\": \"a\",\n  \"key\": tru\n}")},
+	"cycle/a.jsonx":           {Data: []byte(`[${include:b.jsonx}]`)},
+	"cycle/b.jsonx":           {Data: []byte(`{"a": ${include:/cycle/a.jsonx}}`)},
+	"large.jsonx":             {Data: []byte(`["` + strings.Repeat("a", 1<<12) + `"]`)},
+}
+
+func TestInclude(t *testing.T) {
+	type logging struct {
+		Level string   `json:"level"`
+		Sinks []string `json:"sinks"`
+	}
+	var out struct {
+		Name    string  `json:"name"`
+		Logging logging `json:"logging"`
+	}
+	err := interpreter.Unmarshal(strings.NewReader(`${include:base.jsonx}`), map[string]interface{}{"level": "info"}, &out, interpreter.WithIncludeFS(includeFS))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.Name != "app" || out.Logging.Level != "info" || len(out.Logging.Sinks) != 1 || out.Logging.Sinks[0] != "stdout" {
+		t.Log(out)
+		t.FailNow()
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	_, err := interpreter.ParseJsonExtendDocument(strings.NewReader(`[${include:cycle/a.jsonx}]`), nil, interpreter.WithIncludeFS(includeFS))
+	if err == nil || err.Error() != "include cycle: cycle/a.jsonx -> cycle/b.jsonx -> cycle/a.jsonx" {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	_, err = interpreter.ParseJsonExtendDocument(strings.NewReader(`{"tls": ${include:fragments/broken.jsonx}}`), nil, interpreter.WithIncludeFS(includeFS))
+	var positionError *token.PositionError
+	if !errors.As(err, &positionError) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if positionError.Position.File != "fragments/broken.jsonx" || positionError.Position.Line != 3 {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	_, err = interpreter.ParseJsonExtendDocument(strings.NewReader(`[${include:large.jsonx}]`), nil, interpreter.WithIncludeFS(includeFS), interpreter.WithLimits(bytebase.Limits{MaxDocumentSize: 64}))
+	if !errors.Is(err, bytebase.ErrorLimitDocumentSize) {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	_, err = interpreter.ParseJsonExtendDocument(strings.NewReader(`[${include:base.jsonx}]`), nil)
+	if err != interpreter.ErrorIncludeWithoutFS {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestIncludeLimits(t *testing.T) {
+	fsys := fstest.MapFS{
+		"deep.json":  {Data: []byte(`[[[1]]]`)},
+		"long.json":  {Data: []byte(`[1, 2, 3, 4, 5]`)},
+		"large.json": {Data: []byte(`"` + strings.Repeat("a", 40) + `"`)},
+		"chain.json": {Data: []byte(`[${include:large.json}]`)},
+	}
+	// each document is within the limits on its own
+	testCases := map[string]bytebase.Limits{
+		`[[[${include:deep.json}]]]`:                               {MaxDepth: 3},
+		`{"a": {"b": ${include:chain.json}}}`:                      {MaxDepth: 2},
+		`[${include:long.json}]`:                                   {MaxArrayLength: 4},
+		`[${include:large.json}, ${include:large.json}]`:           {MaxDocumentSize: 80},
+		`{"a": ${include:chain.json}, "b": ${include:chain.json}}`: {MaxDocumentSize: 100},
+	}
+	for template, limits := range testCases {
+		_, err := interpreter.ParseJsonExtendDocument(strings.NewReader(template), nil, interpreter.WithIncludeFS(fsys), interpreter.WithLimits(limits))
+		var limitError *bytebase.LimitError
+		if !errors.As(err, &limitError) {
+			t.Log(template, err)
+			t.FailNow()
+		}
+	}
+	_, err := interpreter.ParseJsonExtendDocument(strings.NewReader(`[[${include:deep.json}]]`), nil, interpreter.WithIncludeFS(fsys), interpreter.WithLimits(bytebase.Limits{MaxDepth: 5, MaxDocumentSize: 64}))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestRelaxedModeInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db.json5": {Data: []byte("{\n  // the primary only\n  host: '${host}',\n  port: 0x1538,\n}")},
+	}
+	result, err := interpreter.ParseJsonExtendDocument(strings.NewReader(`{db: ${include:db.json5}, retry: [1, 2,],}`), map[string]interface{}{"host": "localhost"}, interpreter.WithRelaxedMode(), interpreter.WithIncludeFS(fsys))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var out struct {
+		DB struct {
+			Host string `json:"host"`
+			Port int    `json:"port"`
+		} `json:"db"`
+		Retry []int `json:"retry"`
+	}
+	err = interpreter.Unmarshal(strings.NewReader(string(result)), nil, &out)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.DB.Host != "localhost" || out.DB.Port != 5432 || len(out.Retry) != 2 {
+		t.Log(string(result))
+		t.FailNow()
+	}
+
+	_, err = interpreter.ParseJsonExtendDocument(strings.NewReader(`{n: -Infinity}`), nil, interpreter.WithRelaxedMode())
+	if !errors.Is(err, interpreter.ErrorNumberNotFinite) {
+		t.Log(err)
+		t.FailNow()
+	}
+}
@@ -2,8 +2,9 @@ package interpreter
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
-	"reflect"
+	"math"
 	"strconv"
 	"strings"
 
@@ -20,6 +21,8 @@ type PrettyPrintVisitor struct {
 	stackNode    *util.Stack[ast.JsonNode]
 	stackFormat  *util.Stack[byte]
 	marshaler    ast.MarshalerFunc
+	// render time policy for the keys with variables
+	duplicateKeys ast.DuplicateKeyPolicy
 }
 
 var _ ast.NodeVisitor = &PrettyPrintVisitor{}
@@ -46,7 +49,8 @@ func (s *PrettyPrintVisitor) getSymbolLength() int {
 func (s *PrettyPrintVisitor) WriteSymbol() error {
 	symbol, e := s.stackFormat.Pop()
 	if e != nil {
-		return e
+		// the document is complete, the visit of the last node goes on to its post visit plugins
+		return nil
 	}
 	// the caller is the last element in an object/array
 	if symbol == ']' || symbol == '}' {
@@ -62,7 +66,7 @@ func (s *PrettyPrintVisitor) WriteSymbol() error {
 		for symbol != ',' {
 			symbol, e = s.stackFormat.Pop()
 			if e != nil {
-				return e
+				return nil
 			}
 			if symbol != ',' {
 				s.indent--
@@ -92,12 +96,27 @@ func (s *PrettyPrintVisitor) VisitStringNode(node *ast.JsonStringNode) error {
 	return s.WriteSymbol()
 }
 
+// the text of a number value, a json.Number is written as it is so that the digits of a codec are kept
+func formatNumber(value interface{}) (string, error) {
+	if number, ok := value.(json.Number); ok {
+		return number.String(), nil
+	}
+	f64, err := util.ConvertInterfaceNumberToFloat64(value)
+	if err != nil {
+		return "", err
+	}
+	if math.IsInf(f64, 0) || math.IsNaN(f64) {
+		return "", ErrorNumberNotFinite
+	}
+	return strconv.FormatFloat(f64, 'f', -1, 64), nil
+}
+
 func (s *PrettyPrintVisitor) VisitNumberNode(node *ast.JsonNumberNode) error {
-	f64, err := util.ConvertInterfaceNumberToFloat64(node.Value)
+	number, err := formatNumber(node.Value)
 	if err != nil {
 		return err
 	}
-	s.sb.WriteString(strconv.FormatFloat(f64, 'f', -1, 64))
+	s.sb.WriteString(number)
 	return s.WriteSymbol()
 }
 
@@ -119,7 +138,7 @@ func (s *PrettyPrintVisitor) VisitStringWithVariableNode(node *ast.JsonExtendedS
 	var result []byte = make([]byte, len(node.Value))
 	copy(result, node.Value)
 	for varName, varDollarName := range node.Variables {
-		varVal, ok := s.variables[varName]
+		varVal, ok := lookupVariable(s.variables, node, varName)
 		if ok {
 			content, err := s.marshalAndStripQuotes(varVal)
 			if err != nil {
@@ -148,7 +167,7 @@ func (s *PrettyPrintVisitor) marshalAndStripQuotes(varVal interface{}) ([]byte,
 
 func (s *PrettyPrintVisitor) marshalVariableValue(varVal interface{}) ([]byte, error) {
 	var content []byte
-	if util.IsPrimitiveType(reflect.ValueOf(varVal)) {
+	if isBuiltinPrimitive(varVal) {
 		c, err := util.EncodePrimitiveValue(varVal)
 		if err != nil {
 			return nil, err
@@ -170,10 +189,13 @@ func (s *PrettyPrintVisitor) VisitVariableNode(node *ast.JsonExtendedVariableNod
 		s.sb.Write(node.Value)
 		return s.WriteSymbol()
 	}
-	varVal, ok := s.variables[node.Variable] // allow partial rendered
+	varVal, ok := lookupVariable(s.variables, node, node.Variable) // allow partial rendered
 	if !ok {
 		s.sb.Write(node.Value)
 		return s.WriteSymbol()
+	}
+	if node.Spread {
+		return ErrorSpreadOutsideCollection
 	} else {
 		content, err := s.marshalVariableValue(varVal)
 		if err != nil {
@@ -186,16 +208,20 @@ func (s *PrettyPrintVisitor) VisitVariableNode(node *ast.JsonExtendedVariableNod
 }
 
 func (s *PrettyPrintVisitor) VisitArrayNode(node *ast.JsonArrayNode) error {
+	elements, err := s.collectionElements(node)
+	if err != nil {
+		return err
+	}
 	s.sb.WriteString("[\n")
 	s.indent++
 	s.sb.WriteString(strings.Repeat(s.indentString, s.indent))
-	if len(node.Value) == 0 {
+	if len(elements) == 0 {
 		s.stackFormat.Push(']')
 		return s.WriteSymbol()
 	}
-	for i := len(node.Value) - 1; i >= 0; i-- {
-		s.stackNode.Push(node.Value[i])
-		if i == len(node.Value)-1 {
+	for i := len(elements) - 1; i >= 0; i-- {
+		s.stackNode.Push(elements[i])
+		if i == len(elements)-1 {
 			s.stackFormat.Push(']')
 		} else {
 			s.stackFormat.Push(',')
@@ -217,16 +243,23 @@ func (s *PrettyPrintVisitor) GetOutput() []byte {
 }
 
 func (s *PrettyPrintVisitor) VisitObjectNode(node *ast.JsonObjectNode) error {
+	if node.Loop != nil && s.marshaler != nil {
+		return s.VisitArrayNode(loopArrayNode(node))
+	}
+	members, err := s.collectionMembers(node)
+	if err != nil {
+		return err
+	}
 	s.sb.WriteString("{\n")
 	s.indent++
 	s.sb.WriteString(strings.Repeat(s.indentString, s.indent))
-	if len(node.Value) == 0 {
+	if len(members) == 0 {
 		s.stackFormat.Push('}')
 		return s.WriteSymbol()
 	}
-	for i := len(node.Value) - 1; i >= 0; i-- {
-		s.stackNode.Push(node.Value[i])
-		if i == len(node.Value)-1 { // stack, first in last out
+	for i := len(members) - 1; i >= 0; i-- {
+		s.stackNode.Push(members[i])
+		if i == len(members)-1 { // stack, first in last out
 			s.stackFormat.Push('}')
 			s.stackFormat.Push(':')
 		} else {
@@ -238,9 +271,11 @@ func (s *PrettyPrintVisitor) VisitObjectNode(node *ast.JsonObjectNode) error {
 }
 
 func PrettyInterpret(node ast.JsonNode, variables map[string]interface{}, marshaler ast.MarshalerFunc) ([]byte, error) {
-	// deep first traverse the AST
+	return prettyInterpret(NewPPInterpreter(variables, marshaler), node)
+}
 
-	visitor := NewPPInterpreter(variables, marshaler)
+func prettyInterpret(visitor *PrettyPrintVisitor, node ast.JsonNode) ([]byte, error) {
+	// deep first traverse the AST
 	visitor.stackNode.Push(node)
 
 	for {
@@ -266,15 +301,67 @@ func PrettyInterpret(node ast.JsonNode, variables map[string]interface{}, marsha
 	return rs, nil
 }
 
-func ParseJsonExtendDocument(reader io.Reader, variables map[string]interface{}) ([]byte, error) {
-	sm := tokenizer.NewTokenizerStateMachineFromIOReader(reader)
-	err := sm.ProcessData()
+func ParseJsonExtendDocument(reader io.Reader, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	parseOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := parseDocument(reader, parseOptions)
+	if err != nil {
+		return nil, err
+	}
+	return interpretDocument(ast, variables, parseOptions)
+}
+
+// parse a document in memory, it is scanned in place instead of through a buffered reader
+func ParseJsonExtendDocumentBytes(data []byte, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	parseOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := parseDocumentBytes(data, parseOptions)
+	if err != nil {
+		return nil, err
+	}
+	return interpretDocument(ast, variables, parseOptions)
+}
+
+// the AST of the document without rendering it, the includes are resolved when there is an include fs,
+// otherwise they are left as variable nodes
+func ParseAST(reader io.Reader, options ...Option) (ast.JsonNode, error) {
+	parseOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	if parseOptions.includeFS != nil {
+		return parseDocument(reader, parseOptions)
+	}
+	sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(reader, parseOptions.tokenizerOptions)
 	if err != nil {
 		return nil, err
 	}
-	if sm.GetASTBuilder().HasOpenElements() {
-		return nil, ErrorInvalidJson
+	return tokenizeDocument(sm)
+}
+
+func interpretDocument(node ast.JsonNode, variables map[string]interface{}, options *Options) ([]byte, error) {
+	if err := attachPlugins(node, options.plugins); err != nil {
+		return nil, err
+	}
+	visitor := NewPPInterpreter(options.clockVariables(variables), options.marshaler())
+	visitor.duplicateKeys = options.duplicateKeys
+	return prettyInterpret(visitor, node)
+}
+
+func (s *PrettyPrintVisitor) collectionMembers(node *ast.JsonObjectNode) ([]*ast.JsonKeyValuePairNode, error) {
+	if s.marshaler == nil {
+		return node.Value, nil
+	}
+	return expandObjectMembers(node, s.variables, s.duplicateKeys)
+}
+
+func (s *PrettyPrintVisitor) collectionElements(node *ast.JsonArrayNode) ([]ast.JsonNode, error) {
+	if s.marshaler == nil {
+		return node.Value, nil
 	}
-	ast := sm.GetAST()
-	return PrettyInterpret(ast, variables, Marshal)
+	return expandArrayElements(node, s.variables)
 }
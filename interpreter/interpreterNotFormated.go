@@ -2,8 +2,6 @@ package interpreter
 
 import (
 	"bytes"
-	"reflect"
-	"strconv"
 
 	"github.com/jaksonlin/go-jsonextend/ast"
 	"github.com/jaksonlin/go-jsonextend/token"
@@ -23,6 +21,8 @@ type standardVisitor struct {
 	stackNode   *util.Stack[ast.JsonNode]
 	stackFormat *util.Stack[byte]
 	marshaler   ast.MarshalerFunc
+	// render time policy for the keys with variables
+	duplicateKeys ast.DuplicateKeyPolicy
 }
 
 var _ ast.NodeVisitor = &standardVisitor{}
@@ -45,7 +45,8 @@ func (s *standardVisitor) getSymbolLength() int {
 func (s *standardVisitor) WriteSymbol() error {
 	symbol, e := s.stackFormat.Pop()
 	if e != nil {
-		return e
+		// the document is complete, the visit of the last node goes on to its post visit plugins
+		return nil
 	}
 	s.sb.WriteByte(symbol)
 	// the caller is the last element in an object/array
@@ -55,7 +56,7 @@ func (s *standardVisitor) WriteSymbol() error {
 		for symbol != ',' {
 			symbol, e = s.stackFormat.Pop()
 			if e != nil {
-				return e
+				return nil
 			}
 			s.sb.WriteByte(symbol)
 		}
@@ -70,12 +71,11 @@ func (s *standardVisitor) VisitStringNode(node *ast.JsonStringNode) error {
 }
 
 func (s *standardVisitor) VisitNumberNode(node *ast.JsonNumberNode) error {
-	f64, err := util.ConvertInterfaceNumberToFloat64(node.Value)
+	number, err := formatNumber(node.Value)
 	if err != nil {
 		return err
 	}
-
-	s.sb.WriteString(strconv.FormatFloat(f64, 'f', -1, 64))
+	s.sb.WriteString(number)
 	return s.WriteSymbol()
 }
 
@@ -97,7 +97,7 @@ func (s *standardVisitor) VisitStringWithVariableNode(node *ast.JsonExtendedStri
 	var result []byte = make([]byte, len(node.Value))
 	copy(result, node.Value)
 	for varName, varDollarName := range node.Variables {
-		varVal, ok := s.variables[varName]
+		varVal, ok := lookupVariable(s.variables, node, varName)
 		if ok {
 			content, err := s.marshalAndStripQuotes(varVal)
 			if err != nil {
@@ -125,7 +125,7 @@ func (s *standardVisitor) marshalAndStripQuotes(varVal interface{}) ([]byte, err
 
 func (s *standardVisitor) marshalVariableValue(varVal interface{}) ([]byte, error) {
 	var content []byte
-	if util.IsPrimitiveType(reflect.ValueOf(varVal)) {
+	if isBuiltinPrimitive(varVal) {
 		c, err := util.EncodePrimitiveValue(varVal)
 		if err != nil {
 			return nil, err
@@ -144,11 +144,14 @@ func (s *standardVisitor) marshalVariableValue(varVal interface{}) ([]byte, erro
 
 func (s *standardVisitor) VisitVariableNode(node *ast.JsonExtendedVariableNode) error {
 
-	varVal, ok := s.variables[node.Variable] // allow partial rendered
+	varVal, ok := lookupVariable(s.variables, node, node.Variable) // allow partial rendered
 	if !ok {
 		s.sb.Write(node.Value)
 		return s.WriteSymbol()
 	}
+	if node.Spread {
+		return ErrorSpreadOutsideCollection
+	}
 	content, err := s.marshalVariableValue(varVal)
 	if err != nil {
 		return ErrorInterpretVariable
@@ -159,15 +162,19 @@ func (s *standardVisitor) VisitVariableNode(node *ast.JsonExtendedVariableNode)
 }
 
 func (s *standardVisitor) VisitArrayNode(node *ast.JsonArrayNode) error {
+	elements, err := s.collectionElements(node)
+	if err != nil {
+		return err
+	}
 	s.sb.WriteByte('[')
-	if len(node.Value) == 0 {
+	if len(elements) == 0 {
 		s.stackFormat.Push(']')
 		return s.WriteSymbol()
 	}
 
-	for i := len(node.Value) - 1; i >= 0; i-- {
-		s.stackNode.Push(node.Value[i])
-		if i == len(node.Value)-1 {
+	for i := len(elements) - 1; i >= 0; i-- {
+		s.stackNode.Push(elements[i])
+		if i == len(elements)-1 {
 			s.stackFormat.Push(']')
 		} else {
 			s.stackFormat.Push(',')
@@ -189,14 +196,21 @@ func (s *standardVisitor) GetOutput() []byte {
 }
 
 func (s *standardVisitor) VisitObjectNode(node *ast.JsonObjectNode) error {
+	if node.Loop != nil && s.marshaler != nil {
+		return s.VisitArrayNode(loopArrayNode(node))
+	}
+	members, err := s.collectionMembers(node)
+	if err != nil {
+		return err
+	}
 	s.sb.WriteByte('{')
-	if len(node.Value) == 0 {
+	if len(members) == 0 {
 		s.stackFormat.Push('}')
 		return s.WriteSymbol()
 	}
-	for i := len(node.Value) - 1; i >= 0; i-- {
-		s.stackNode.Push(node.Value[i])
-		if i == len(node.Value)-1 { // stack, first in last out
+	for i := len(members) - 1; i >= 0; i-- {
+		s.stackNode.Push(members[i])
+		if i == len(members)-1 { // stack, first in last out
 			s.stackFormat.Push('}')
 			s.stackFormat.Push(':')
 		} else {
@@ -235,3 +249,19 @@ func InterpretAST(node ast.JsonNode, variables map[string]interface{}, marshaler
 	rs := visitor.GetOutput()
 	return rs, nil
 }
+
+// the members of the object after the template extensions are expanded,
+// without a marshaler the template is written out as it is.
+func (s *standardVisitor) collectionMembers(node *ast.JsonObjectNode) ([]*ast.JsonKeyValuePairNode, error) {
+	if s.marshaler == nil {
+		return node.Value, nil
+	}
+	return expandObjectMembers(node, s.variables, s.duplicateKeys)
+}
+
+func (s *standardVisitor) collectionElements(node *ast.JsonArrayNode) ([]ast.JsonNode, error) {
+	if s.marshaler == nil {
+		return node.Value, nil
+	}
+	return expandArrayElements(node, s.variables)
+}
@@ -1,6 +1,7 @@
 package interpreter
 
 import (
+	"github.com/jaksonlin/go-jsonextend/ast"
 	"github.com/jaksonlin/go-jsonextend/astbuilder"
 	"github.com/jaksonlin/go-jsonextend/astbuilder/golang"
 	"github.com/jaksonlin/go-jsonextend/tokenizer"
@@ -10,6 +11,17 @@ func marshal(v interface{}, depth int, variables map[string]interface{}, options
 	if depth > maxDepth {
 		return nil, ErrorSelfCallTooDeep
 	}
+	ast, err := marshalAST(v, options)
+	if err != nil {
+		return nil, err
+	}
+	return InterpretAST(ast, variables, func(v interface{}) ([]byte, error) {
+		return marshal(v, depth+1, variables, options)
+	})
+}
+
+// the AST of the go value before it is interpreted
+func marshalAST(v interface{}, options []astbuilder.TokenProviderOptions) (ast.JsonNode, error) {
 	sm, err := tokenizer.NewTokenizerStateMachineFromGoData(v, options)
 	if err != nil {
 		return nil, err
@@ -21,20 +33,51 @@ func marshal(v interface{}, depth int, variables map[string]interface{}, options
 	if sm.GetASTBuilder().HasOpenElements() {
 		return nil, ErrorInvalidJson
 	}
-	ast := sm.GetAST()
-	return InterpretAST(ast, variables, func(v interface{}) ([]byte, error) {
-		return marshal(v, depth+1, variables, options)
-	})
+	return sm.GetAST(), nil
 }
 
 func Marshal(v interface{}) ([]byte, error) {
 	return marshal(v, 1, nil, nil)
 }
 
-func MarshalWithVariables(v interface{}, variables map[string]interface{}) ([]byte, error) {
-	return marshal(v, 1, variables, []astbuilder.TokenProviderOptions{golang.EnableJsonExtTag})
+// marshal with the codecs of the options, see RegisterCodec
+func MarshalWithOptions(v interface{}, options ...Option) ([]byte, error) {
+	marshalOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(v, 1, nil, marshalOptions.marshalOptions())
+}
+
+func MarshalWithVariables(v interface{}, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	marshalOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(v, 1, variables, marshalOptions.marshalOptions(golang.EnableJsonExtTag))
 }
 
-func MarshalIntoTemplate(v interface{}) ([]byte, error) {
-	return marshal(v, 1, nil, []astbuilder.TokenProviderOptions{golang.EnableJsonExtTag})
+// the template of the go value, the fields tagged with jsonext are written as variables, so are the values
+// chosen by WithAutoVariables
+func MarshalIntoTemplate(v interface{}, options ...Option) ([]byte, error) {
+	marshalOptions, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	tokenOptions := marshalOptions.marshalOptions(golang.EnableJsonExtTag)
+	if marshalOptions.autoVariables == nil {
+		return marshal(v, 1, nil, tokenOptions)
+	}
+	node, err := marshalAST(v, tokenOptions)
+	if err != nil {
+		return nil, err
+	}
+	marshaler := func(v interface{}) ([]byte, error) {
+		return marshal(v, 2, nil, tokenOptions)
+	}
+	node, err = marshalOptions.autoVariables.parameterize(node, marshaler)
+	if err != nil {
+		return nil, err
+	}
+	return InterpretAST(node, nil, marshaler)
 }
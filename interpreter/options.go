@@ -0,0 +1,135 @@
+package interpreter
+
+import (
+	"io/fs"
+	"reflect"
+	"time"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/astbuilder/bytebase"
+)
+
+// settings of parsing/unmarshalling a document, use the Option functions to change them
+type Options struct {
+	includeFS             fs.FS
+	tokenizerOptions      []astbuilder.TokenProviderOptions
+	duplicateKeys         ast.DuplicateKeyPolicy
+	plugins               []registeredPlugin
+	codecs                map[reflect.Type]*codec
+	durationAsNanoseconds bool
+	clock                 func() time.Time
+	bound                 map[string]interface{}
+	autoVariables         *autoVariables
+}
+
+type Option func(*Options) error
+
+func NewOptions(options ...Option) (*Options, error) {
+	rs := &Options{}
+	for _, option := range options {
+		err := option(rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// resolve `${include:path}` from fsys, the path of a nested include is relative to the including document
+func WithIncludeFS(fsys fs.FS) Option {
+	return func(o *Options) error {
+		if fsys == nil {
+			return ErrorIncludeFSNil
+		}
+		o.includeFS = fsys
+		return nil
+	}
+}
+
+// accept JSON5 style input: comments, identifier keys, single-quoted strings, hex numbers,
+// Infinity/NaN and trailing commas. the included documents are read in the same mode.
+func WithRelaxedMode() Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.EnableRelaxedMode)
+		return nil
+	}
+}
+
+// accept RFC 8259 json only (plus the `${}` extension), e.g. to check that a template without variables is valid json.
+// the errors tell the position of the offending byte. strict mode and relaxed mode cannot be used together.
+func WithStrictMode() Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.EnableStrictMode)
+		return nil
+	}
+}
+
+// keep the spaces and comments of the document in the AST, so that FormatTemplate writes an unchanged AST
+// from ParseAST back byte for byte, and an edited one with the changes only.
+func WithLosslessMode() Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.EnableLosslessMode)
+		return nil
+	}
+}
+
+// record where each value of the document starts, ast.POSITION_META of the nodes from ParseAST holds a token.Position
+func WithPositions() Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.EnablePositions)
+		return nil
+	}
+}
+
+// limit the depth, size, string length and array length of the documents. an included document counts as a part of
+// the document that includes it: its depth continues from the include and its bytes add to the size.
+// exceeding a limit fails with a *bytebase.LimitError.
+func WithLimits(limits bytebase.Limits) Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.WithLimits(limits))
+		return nil
+	}
+}
+
+// what to do when an object has the same key more than once: the literal keys are checked when the document is read,
+// the keys with variables when they are rendered. the *ast.DuplicateKeyError tells the positions of both keys.
+// the entries of a spread follow the policy the same as the other keys.
+func WithDuplicateKeys(policy ast.DuplicateKeyPolicy) Option {
+	return func(o *Options) error {
+		o.tokenizerOptions = append(o.tokenizerOptions, bytebase.WithDuplicateKeyPolicy(policy))
+		o.duplicateKeys = policy
+		return nil
+	}
+}
+
+// attach the plugin to the nodes the matcher matches, the plugin runs when Parse renders the node or Unmarshal
+// decodes it, e.g. to redact, normalize or trace values. see ast.NewASTNodePlugin.
+func WithPlugin(match NodeMatcher, plugin ast.ASTNodePlugin) Option {
+	return func(o *Options) error {
+		if plugin == nil {
+			return ErrorPluginNil
+		}
+		if match.path != "" {
+			// the path is checked here rather than when the document is read
+			if _, err := ast.Query(&ast.JsonNullNode{}, match.path); err != nil {
+				return err
+			}
+		}
+		o.plugins = append(o.plugins, registeredPlugin{match, plugin})
+		return nil
+	}
+}
+
+// Unmarshal puts the variables of the fields tagged `jsonext:"s=..."` into bound, e.g. the field tagged
+// `s=https://${host}/api` holding "https://example.com/api" binds host to "example.com". the values that do not
+// match the template bind nothing.
+func WithBoundVariables(bound map[string]interface{}) Option {
+	return func(o *Options) error {
+		if bound == nil {
+			return ErrorBoundVariablesNil
+		}
+		o.bound = bound
+		return nil
+	}
+}
@@ -0,0 +1,198 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+type autoVariables struct {
+	variables map[string]interface{}
+	paths     []string
+}
+
+// MarshalIntoTemplate writes the values under the paths as variables named after their JSON path, e.g. the
+// replicas of spec as `${spec_replicas}`, and puts the current values into variables, so that Parse renders the
+// template with the variables back into what Marshal writes. the paths are JSONPath as accepted by ast.Query, every
+// value is a variable when there are no paths. the fields tagged `jsonext:"v=..."` keep their own variables, a name
+// that the template or variables has already gets `_2`, `_3`... added.
+func WithAutoVariables(variables map[string]interface{}, paths ...string) Option {
+	return func(o *Options) error {
+		if variables == nil {
+			return ErrorAutoVariablesNil
+		}
+		for _, path := range paths {
+			// the paths are checked here rather than when the value is marshalled
+			if _, err := ast.Query(&ast.JsonNullNode{}, path); err != nil {
+				return err
+			}
+		}
+		o.autoVariables = &autoVariables{variables: variables, paths: paths}
+		return nil
+	}
+}
+
+type parameterizeFrame struct {
+	node     ast.JsonNode
+	names    []string
+	selected bool
+	// put the variable node in the place of the node
+	replace func(ast.JsonNode)
+}
+
+// replace the primitive values under the paths with variables, return the root which is replaced when it is a value
+func (a *autoVariables) parameterize(root ast.JsonNode, marshaler ast.MarshalerFunc) (ast.JsonNode, error) {
+	selected := make(map[ast.JsonNode]bool)
+	if len(a.paths) == 0 {
+		selected[root] = true
+	}
+	for _, path := range a.paths {
+		nodes, err := ast.Query(root, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			selected[node] = true
+		}
+	}
+	used := usedVariableNames(root, a.variables)
+	s := util.NewStack[*parameterizeFrame]()
+	s.Push(&parameterizeFrame{node: root, replace: func(node ast.JsonNode) { root = node }})
+	for !s.IsEmpty() {
+		frame, _ := s.Pop()
+		isSelected := frame.selected || selected[frame.node]
+		children := make([]*parameterizeFrame, 0)
+		child := func(node ast.JsonNode, name string, replace func(ast.JsonNode)) {
+			names := append(append([]string{}, frame.names...), name)
+			children = append(children, &parameterizeFrame{node: node, names: names, selected: isSelected, replace: replace})
+		}
+		switch n := frame.node.(type) {
+		case *ast.JsonObjectNode:
+			for _, kv := range n.Value {
+				key, err := kv.Key.GetValue()
+				if err != nil || kv.Value == nil {
+					continue
+				}
+				kv := kv
+				child(kv.Value, key, func(node ast.JsonNode) { kv.Value = node })
+			}
+		case *ast.JsonArrayNode:
+			for i, element := range n.Value {
+				i := i
+				child(element, strconv.Itoa(i), func(node ast.JsonNode) { n.Value[i] = node })
+			}
+		case *ast.JsonStringNode, *ast.JsonNumberNode, *ast.JsonBooleanNode, *ast.JsonNullNode:
+			if !isSelected {
+				continue
+			}
+			value, err := primitiveValue(frame.node, marshaler)
+			if err != nil {
+				return nil, err
+			}
+			name := variableName(frame.names, used)
+			node, err := ast.NodeFactory(ast.AST_VARIABLE, []byte(fmt.Sprintf("${%s}", name)))
+			if err != nil {
+				return nil, err
+			}
+			frame.replace(node)
+			a.variables[name] = value
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			s.Push(children[i])
+		}
+	}
+	return root, nil
+}
+
+// the names of the variables in the template, e.g. of the fields tagged `jsonext:"v=..."`, and of the variables the
+// caller has already, the names made for the values do not take them
+func usedVariableNames(root ast.JsonNode, variables map[string]interface{}) map[string]bool {
+	rs := make(map[string]bool, len(variables))
+	for name := range variables {
+		rs[name] = true
+	}
+	add := func(node ast.JsonNode) {
+		switch n := node.(type) {
+		case *ast.JsonExtendedVariableNode:
+			rs[n.Variable] = true
+		case *ast.JsonExtendedStringWIthVariableNode:
+			for name := range n.Variables {
+				rs[name] = true
+			}
+		}
+	}
+	ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+		if ctx.Event == ast.WalkLeave {
+			return ast.WalkContinue
+		}
+		add(ctx.Node)
+		if object, ok := ctx.Node.(*ast.JsonObjectNode); ok {
+			for _, kv := range object.Value {
+				if kv.Key != nil {
+					add(kv.Key)
+				}
+			}
+		}
+		return ast.WalkContinue
+	})
+	return rs
+}
+
+// the value of a primitive node, a node with plugins, e.g. of the `string` json tag option, is the value it writes
+func primitiveValue(node ast.JsonNode, marshaler ast.MarshalerFunc) (interface{}, error) {
+	if len(node.GetPlugins()) > 0 {
+		data, err := InterpretAST(node, nil, marshaler)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	switch n := node.(type) {
+	case *ast.JsonStringNode:
+		return n.GetValue()
+	case *ast.JsonNumberNode:
+		return n.Value, nil
+	case *ast.JsonBooleanNode:
+		return n.Value, nil
+	default:
+		return nil, nil
+	}
+}
+
+// the names of the path joined by `_`, the characters that cannot be in a variable name are written as `_`.
+// `_2`, `_3`... are added to the names already used.
+func variableName(names []string, used map[string]bool) string {
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte('_')
+		}
+		for _, r := range name {
+			if r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteByte('_')
+			}
+		}
+	}
+	base := sb.String()
+	if base == "" {
+		base = "value"
+	} else if base[0] >= '0' && base[0] <= '9' {
+		base = "_" + base
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	used[name] = true
+	return name
+}
@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"reflect"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+)
+
+// the nodes a plugin of WithPlugin is attached to, see MatchPath, MatchNodeType and MatchGoType
+type NodeMatcher struct {
+	path     string
+	nodeType ast.AST_NODETYPE
+	goType   reflect.Type
+}
+
+// the nodes of the template matching the JSONPath, as accepted by ast.Query, e.g. `$..password`
+func MatchPath(path string) NodeMatcher {
+	return NodeMatcher{path: path}
+}
+
+// the values of the node type, e.g. ast.AST_VARIABLE; the kv pairs are not matched
+func MatchNodeType(nodeType ast.AST_NODETYPE) NodeMatcher {
+	return NodeMatcher{nodeType: nodeType}
+}
+
+// the nodes unmarshalled into the go type, e.g. reflect.TypeOf(time.Time{}); Unmarshal only
+func MatchGoType(goType reflect.Type) NodeMatcher {
+	return NodeMatcher{goType: goType}
+}
+
+type registeredPlugin struct {
+	match  NodeMatcher
+	plugin ast.ASTNodePlugin
+}
+
+// attach the plugins matched by path or node type to the document before it is rendered or unmarshalled
+func attachPlugins(root ast.JsonNode, plugins []registeredPlugin) error {
+	for _, item := range plugins {
+		switch {
+		case item.match.path != "":
+			nodes, err := ast.Query(root, item.match.path)
+			if err != nil {
+				return err
+			}
+			for _, node := range nodes {
+				node.AddPlugin(item.plugin)
+			}
+		case item.match.nodeType != 0:
+			ast.Walk(root, func(ctx *ast.WalkContext) ast.WalkAction {
+				if ctx.Node.GetNodeType() == item.match.nodeType {
+					ctx.Node.AddPlugin(item.plugin)
+				}
+				return ast.WalkContinue
+			})
+		}
+	}
+	return nil
+}
+
+// attach the plugins matched by go type to the node to unmarshal into outType
+func attachGoTypePlugins(node ast.JsonNode, outType reflect.Type, plugins []registeredPlugin) {
+	for _, item := range plugins {
+		if item.match.goType != nil && item.match.goType == outType {
+			node.AddPlugin(item.plugin)
+		}
+	}
+}
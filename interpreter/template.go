@@ -0,0 +1,427 @@
+package interpreter
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/token"
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+// a piece of the template output, either a node to write or text to write as it is
+type templatePiece struct {
+	node  ast.JsonNode
+	text  string
+	depth int
+	// the conditions of the node have been written by its owner
+	bare bool
+}
+
+type templateMember struct {
+	// nil for the members made up by the writer, e.g. `$if` for a condition added to the AST
+	kv *ast.JsonKeyValuePairNode
+	// the key as written, when it is not the key of kv
+	key   string
+	value templatePiece
+}
+
+// the spaces a member is written with when it has no trivia, taken from a member that has
+type memberStyle struct {
+	leading      []byte
+	keyTrailing  []byte
+	valueLeading []byte
+}
+
+type templateWriter struct {
+	sb     *bytes.Buffer
+	indent string
+	stack  *util.Stack[templatePiece]
+}
+
+// write the AST back out as template text, the `${}` nodes are written verbatim and the `$if`, `$for`
+// and `${?name}` extensions folded into the AST are written back in their template form.
+// the nodes read in lossless mode are written with their spaces and comments, and the values as written
+// while they are unchanged. the other nodes are written with indent for each nesting level, in a single
+// line when indent is empty.
+func FormatTemplate(node ast.JsonNode, indent string) ([]byte, error) {
+	w := &templateWriter{
+		sb:     bytes.NewBuffer(make([]byte, 0)),
+		indent: indent,
+		stack:  util.NewStack[templatePiece](),
+	}
+	w.stack.Push(templatePiece{node: node})
+	for !w.stack.IsEmpty() {
+		piece, _ := w.stack.Pop()
+		if piece.node == nil {
+			w.sb.WriteString(piece.text)
+			continue
+		}
+		err := w.writeNode(piece)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w.sb.Bytes(), nil
+}
+
+func (w *templateWriter) writeNode(piece templatePiece) error {
+	trivia := ast.TriviaOf(piece.node)
+	conditions := piece.node.GetConditions()
+	if len(conditions) > 0 && !piece.bare {
+		// `{"$if": ${name}, "$value": ...}` as it is read
+		if trivia != nil && trivia.Owner != nil && len(trivia.Owner.Value) == 1 && trivia.Owner.Value[0].Value == piece.node {
+			w.writeObject(trivia.Owner, conditions, piece.node, piece.depth)
+			return nil
+		}
+		if object, ok := piece.node.(*ast.JsonObjectNode); ok {
+			w.writeObject(object, conditions, nil, piece.depth)
+			return nil
+		}
+		members := conditionMembers(conditions)
+		members = append(members, templateMember{
+			key:   strconv.Quote(ast.VALUE_KEY),
+			value: templatePiece{node: piece.node, depth: piece.depth + 1, bare: true},
+		})
+		w.pushCollection('{', '}', members, nil, piece.depth)
+		return nil
+	}
+	switch n := piece.node.(type) {
+	case *ast.JsonObjectNode:
+		w.writeObject(n, nil, nil, piece.depth)
+		return nil
+	case *ast.JsonArrayNode:
+		elements := make([]templateMember, 0, len(n.Value))
+		for _, element := range n.Value {
+			elements = append(elements, templateMember{value: templatePiece{node: element, depth: piece.depth + 1}})
+		}
+		w.pushCollection('[', ']', elements, trivia, piece.depth)
+		return nil
+	}
+
+	if trivia != nil {
+		w.sb.Write(trivia.Leading)
+	}
+	if raw := trivia.RawText(piece.node); raw != nil {
+		w.sb.Write(raw)
+	} else {
+		err := w.writeValue(piece.node)
+		if err != nil {
+			return err
+		}
+	}
+	if trivia != nil {
+		w.sb.Write(trivia.Trailing)
+	}
+	return nil
+}
+
+func (w *templateWriter) writeValue(node ast.JsonNode) error {
+	switch n := node.(type) {
+	case *ast.JsonExtendedStringWIthVariableNode:
+		w.sb.Write(n.Value)
+	case *ast.JsonStringNode:
+		w.sb.Write(n.Value)
+	case *ast.JsonExtendedVariableNode:
+		w.sb.Write(n.Value)
+	case *ast.JsonNumberNode:
+		number, err := formatNumber(n.Value)
+		if err != nil {
+			return err
+		}
+		w.sb.WriteString(number)
+	case *ast.JsonBooleanNode:
+		if n.Value {
+			w.sb.Write(token.TrueBytes)
+		} else {
+			w.sb.Write(token.FalseBytes)
+		}
+	case *ast.JsonNullNode:
+		w.sb.Write(token.NullBytes)
+	default:
+		return ast.ErrorASTIncorrectNodeType
+	}
+	return nil
+}
+
+// write the object with the conditions as `$if`/`$unless` members, bareValue is the node
+// that takes the place of the object when the object is the owner of a `$value`
+func (w *templateWriter) writeObject(node *ast.JsonObjectNode, conditions []ast.Condition, bareValue ast.JsonNode, depth int) {
+	trivia := ast.TriviaOf(node)
+	var members []templateMember
+	if trivia != nil && trivia.Members != nil {
+		members = readMembers(node, trivia.Members, conditions, depth)
+	} else {
+		members = conditionMembers(conditions)
+		if node.Loop != nil {
+			members = append(members,
+				templateMember{key: strconv.Quote(ast.FOR_KEY), value: templatePiece{text: strconv.Quote(loopClause(node.Loop))}},
+				templateMember{key: strconv.Quote(ast.DO_KEY), value: templatePiece{node: node.Loop.Body, depth: depth + 1}},
+			)
+		}
+		for _, kv := range node.Value {
+			members = append(members, templateMember{kv: kv, value: templatePiece{node: kv.Value, depth: depth + 1}})
+		}
+	}
+	for i := range members {
+		if members[i].value.node != nil && members[i].value.node == bareValue {
+			members[i].value.bare = true
+		}
+	}
+	w.pushCollection('{', '}', members, trivia, depth)
+}
+
+// the members of an object read in lossless mode, in the order they are read: the members folded into
+// the object are put back where they are read, the members added after the last one read go to the end.
+func readMembers(node *ast.JsonObjectNode, read []*ast.JsonKeyValuePairNode, conditions []ast.Condition, depth int) []templateMember {
+	index := make(map[*ast.JsonKeyValuePairNode]int, len(node.Value))
+	for i, kv := range node.Value {
+		index[kv] = i
+	}
+	members := make([]templateMember, 0, len(read)+len(conditions))
+	next, nextCondition := 0, 0
+	for _, kv := range read {
+		if i, ok := index[kv]; ok {
+			for ; next <= i; next++ {
+				members = append(members, templateMember{kv: node.Value[next], value: templatePiece{node: node.Value[next].Value, depth: depth + 1}})
+			}
+			continue
+		}
+		key, err := kv.Key.GetValue()
+		if err != nil {
+			continue
+		}
+		switch key {
+		case ast.FOR_KEY:
+			if node.Loop == nil {
+				continue
+			}
+			member := templateMember{kv: kv, value: templatePiece{node: kv.Value}}
+			if value, ok := kv.Value.(ast.JsonStringValueNode); !ok || !isLoopClause(value, node.Loop) {
+				member.value = templatePiece{text: strconv.Quote(loopClause(node.Loop))}
+			}
+			members = append(members, member)
+		case ast.DO_KEY:
+			if node.Loop != nil {
+				members = append(members, templateMember{kv: kv, value: templatePiece{node: node.Loop.Body, depth: depth + 1}})
+			}
+		case ast.IF_KEY, ast.UNLESS_KEY:
+			if nextCondition >= len(conditions) {
+				continue
+			}
+			c := conditions[nextCondition]
+			nextCondition++
+			variableNode, ok := kv.Value.(*ast.JsonExtendedVariableNode)
+			if ok && variableNode.Variable == c.Variable && c.Negate == (key == ast.UNLESS_KEY) {
+				members = append(members, templateMember{kv: kv, value: templatePiece{node: kv.Value}})
+				continue
+			}
+			member := conditionMembers([]ast.Condition{c})[0]
+			member.kv = kv
+			members = append(members, member)
+		}
+	}
+	for ; next < len(node.Value); next++ {
+		members = append(members, templateMember{kv: node.Value[next], value: templatePiece{node: node.Value[next].Value, depth: depth + 1}})
+	}
+	// the conditions added later go first
+	return append(conditionMembers(conditions[nextCondition:]), members...)
+}
+
+func loopClause(loop *ast.Loop) string {
+	return loop.Item + " in ${" + loop.Source + "}"
+}
+
+func isLoopClause(node ast.JsonStringValueNode, loop *ast.Loop) bool {
+	value, err := node.GetValue()
+	if err != nil {
+		return false
+	}
+	rs := util.RegLoopClause.FindStringSubmatch(value)
+	return rs != nil && rs[1] == loop.Item && rs[2] == loop.Source
+}
+
+func conditionMembers(conditions []ast.Condition) []templateMember {
+	members := make([]templateMember, 0, len(conditions)+1)
+	for _, c := range conditions {
+		key := ast.IF_KEY
+		if c.Negate {
+			key = ast.UNLESS_KEY
+		}
+		members = append(members, templateMember{
+			key:   strconv.Quote(key),
+			value: templatePiece{text: "${" + c.Variable + "}"},
+		})
+	}
+	return members
+}
+
+// the key as written in the template, the conditions of the member are written as `${?name}` prefixes
+func (m *templateMember) keyText() string {
+	if m.key != "" {
+		return m.key
+	}
+	kv := m.kv
+	if raw := ast.TriviaOf(kv.Key).RawText(kv.Key); raw != nil && rawKeyHasConditions(raw, kv.GetConditions()) {
+		return string(raw)
+	}
+	var key []byte
+	switch n := kv.Key.(type) {
+	case *ast.JsonStringNode:
+		key = n.Value
+	case *ast.JsonExtendedStringWIthVariableNode:
+		key = n.Value
+	}
+	conditions := kv.GetConditions()
+	if len(conditions) == 0 || len(key) < 2 {
+		return string(key)
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range conditions {
+		sb.WriteString("${?")
+		if c.Negate {
+			sb.WriteByte('!')
+		}
+		sb.WriteString(c.Variable)
+		sb.WriteByte('}')
+	}
+	sb.Write(key[1:])
+	return sb.String()
+}
+
+// the `${?name}` prefix of the key as read is the same as the conditions of the member
+func rawKeyHasConditions(raw []byte, conditions []ast.Condition) bool {
+	if len(raw) > 0 && (raw[0] == '"' || raw[0] == '\'') {
+		raw = raw[1:]
+	}
+	rs := util.RegConditionPrefix.FindSubmatch(raw)
+	if rs == nil {
+		return len(conditions) == 0
+	}
+	return len(conditions) == 1 && conditions[0].Variable == string(rs[2]) && conditions[0].Negate == (len(rs[1]) > 0)
+}
+
+// push the pieces of the collection in reverse, so that they are popped in order. a collection read
+// in lossless mode is written with its trivia, otherwise with the indent.
+func (w *templateWriter) pushCollection(open, close byte, members []templateMember, trivia *ast.Trivia, depth int) {
+	pieces := make([]templatePiece, 0, len(members)*4+3)
+	if trivia != nil {
+		pieces = append(pieces, templatePiece{text: string(trivia.Leading)})
+	}
+	pieces = append(pieces, templatePiece{text: string(open)})
+	styles := memberStyles(members)
+	// a collection taking the place of a node read in lossless mode only has the trivia around it
+	lossless := trivia != nil && (len(members) == 0 || trivia.Closing != nil || trivia.TrailingComma || styles[0] != nil)
+	for i, member := range members {
+		if i > 0 {
+			pieces = append(pieces, templatePiece{text: "," + string(commaOf(members[i-1].value.node))})
+		}
+		if !lossless {
+			pieces = append(pieces, templatePiece{text: w.lineBreak(depth + 1)})
+			if open == '{' {
+				colon := ":"
+				if w.indent != "" {
+					colon = ": "
+				}
+				pieces = append(pieces, templatePiece{text: member.keyText() + colon})
+			}
+			pieces = append(pieces, member.value)
+			continue
+		}
+		// the members without trivia take the spaces of the members around them
+		style := styles[i]
+		if style == nil {
+			style = &memberStyle{leading: []byte(w.lineBreak(depth + 1))}
+		}
+		if open == '{' {
+			leading, keyTrailing := style.leading, style.keyTrailing
+			if member.kv != nil && ast.TriviaOf(member.kv.Key) != nil {
+				keyTrivia := ast.TriviaOf(member.kv.Key)
+				leading, keyTrailing = keyTrivia.Leading, keyTrivia.Trailing
+			}
+			pieces = append(pieces, templatePiece{text: string(leading) + member.keyText() + string(keyTrailing) + ":"})
+			if ast.TriviaOf(member.value.node) == nil {
+				pieces = append(pieces, templatePiece{text: string(style.valueLeading)})
+			}
+		} else if ast.TriviaOf(member.value.node) == nil {
+			pieces = append(pieces, templatePiece{text: string(style.leading)})
+		}
+		pieces = append(pieces, member.value)
+	}
+	closing := string(close)
+	switch {
+	case lossless:
+		if trivia.TrailingComma && len(members) > 0 {
+			pieces = append(pieces, templatePiece{text: "," + string(commaOf(members[len(members)-1].value.node))})
+		}
+		closing = string(trivia.Closing) + closing
+	case len(members) > 0:
+		closing = w.lineBreak(depth) + closing
+	}
+	if trivia != nil {
+		closing += string(trivia.Trailing)
+	}
+	pieces = append(pieces, templatePiece{text: closing})
+	for i := len(pieces) - 1; i >= 0; i-- {
+		w.stack.Push(pieces[i])
+	}
+}
+
+// the spaces and comments after the comma that follows the node, a node taking the place of
+// its `$value` owner is written as the owner
+func commaOf(node ast.JsonNode) []byte {
+	trivia := ast.TriviaOf(node)
+	if trivia == nil {
+		return nil
+	}
+	if trivia.Owner != nil {
+		return ast.TriviaOf(trivia.Owner).Comma
+	}
+	return trivia.Comma
+}
+
+// for each member, the style of the nearest member before it that has trivia, or the first one after it
+func memberStyles(members []templateMember) []*memberStyle {
+	styles := make([]*memberStyle, len(members))
+	var last *memberStyle
+	for i, member := range members {
+		if style := styleOf(member); style != nil {
+			last = style
+		}
+		styles[i] = last
+	}
+	for i := len(members) - 1; i >= 0; i-- {
+		if styles[i] == nil && i+1 < len(members) {
+			styles[i] = styles[i+1]
+		}
+	}
+	return styles
+}
+
+func styleOf(member templateMember) *memberStyle {
+	valueTrivia := ast.TriviaOf(member.value.node)
+	if member.kv == nil {
+		if valueTrivia == nil {
+			return nil
+		}
+		return &memberStyle{leading: valueTrivia.Leading}
+	}
+	keyTrivia := ast.TriviaOf(member.kv.Key)
+	if keyTrivia == nil {
+		return nil
+	}
+	style := &memberStyle{leading: keyTrivia.Leading, keyTrailing: keyTrivia.Trailing}
+	if valueTrivia != nil {
+		style.valueLeading = valueTrivia.Leading
+	}
+	return style
+}
+
+func (w *templateWriter) lineBreak(depth int) string {
+	if w.indent == "" {
+		return ""
+	}
+	return "\n" + strings.Repeat(w.indent, depth)
+}
@@ -0,0 +1,111 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/jaksonlin/go-jsonextend/util"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// write time.Duration as its nanoseconds, e.g. 1500000000 rather than "1.5s". Unmarshal reads both.
+func WithDurationAsNanoseconds() Option {
+	return func(o *Options) error {
+		o.durationAsNanoseconds = true
+		return nil
+	}
+}
+
+// add the variables `now` (time.Time), `today` ("2006-01-02") and `unix` (seconds) read from clock, e.g. time.Now.
+// without the option they are not variables, so that `${now}` is left for a later render. the clock is read once
+// per document, the variables passed in take precedence.
+func WithClock(clock func() time.Time) Option {
+	return func(o *Options) error {
+		if clock == nil {
+			return ErrorClockNil
+		}
+		o.clock = clock
+		return nil
+	}
+}
+
+// the variables with the clock variables added when there is a clock
+func (o *Options) clockVariables(variables map[string]interface{}) map[string]interface{} {
+	if o.clock == nil {
+		return variables
+	}
+	now := o.clock()
+	rs := map[string]interface{}{
+		"now":   now,
+		"today": now.Format(time.DateOnly),
+		"unix":  now.Unix(),
+	}
+	for k, v := range variables {
+		rs[k] = v
+	}
+	return rs
+}
+
+// read time.Time as RFC 3339, or the layout of its `jsonext:"time=..."` tag, and time.Duration as a duration
+// string or nanoseconds. null leaves the zero value.
+func timeDecoder(t reflect.Type, extendOption *util.JsonExtendOptions) func(data []byte) (reflect.Value, error) {
+	switch t {
+	case timeType:
+		layout := time.RFC3339
+		if extendOption != nil && extendOption.TimeLayout != "" {
+			layout = extendOption.TimeLayout
+		}
+		return func(data []byte) (reflect.Value, error) {
+			var value time.Time
+			if !bytes.Equal(data, []byte("null")) {
+				var s string
+				if err := json.Unmarshal(data, &s); err != nil {
+					return reflect.Value{}, err
+				}
+				parsed, err := time.Parse(layout, s)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				value = parsed
+			}
+			return reflect.ValueOf(value), nil
+		}
+	case durationType:
+		return func(data []byte) (reflect.Value, error) {
+			var value time.Duration
+			switch {
+			case bytes.Equal(data, []byte("null")):
+			case len(data) > 0 && data[0] == '"':
+				var s string
+				if err := json.Unmarshal(data, &s); err != nil {
+					return reflect.Value{}, err
+				}
+				parsed, err := time.ParseDuration(s)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				value = parsed
+			default:
+				var nanoseconds json.Number
+				if err := json.Unmarshal(data, &nanoseconds); err != nil {
+					return reflect.Value{}, err
+				}
+				if n, err := nanoseconds.Int64(); err == nil {
+					value = time.Duration(n)
+				} else if f, err := nanoseconds.Float64(); err == nil {
+					value = time.Duration(f)
+				} else {
+					return reflect.Value{}, err
+				}
+			}
+			return reflect.ValueOf(value), nil
+		}
+	}
+	return nil
+}
@@ -16,6 +16,10 @@ type unmarshallOptions struct {
 	variables     map[string]interface{}
 	marshaler     ast.MarshalerFunc
 	unmarshaler   ast.UnmarshalerFunc
+	duplicateKeys ast.DuplicateKeyPolicy
+	plugins       []registeredPlugin
+	codecs        map[reflect.Type]*codec
+	bound         map[string]interface{}
 }
 
 func NewUnMarshallOptions(variables map[string]interface{}, marshaler ast.MarshalerFunc, unmarshaler ast.UnmarshalerFunc) *unmarshallOptions {
@@ -31,10 +35,13 @@ func NewUnMarshallOptions(variables map[string]interface{}, marshaler ast.Marsha
 
 func resolveVariable(variableNode *ast.JsonExtendedVariableNode, resolver *unmarshallOptions) (interface{}, error) {
 
-	variableValue, ok := resolver.variables[variableNode.Variable]
+	variableValue, ok := lookupVariable(resolver.variables, variableNode, variableNode.Variable)
 	if !ok {
 		return nil, NewVariableNotFound(variableNode.Variable)
 	}
+	if variableNode.Spread {
+		return nil, ErrorSpreadOutsideCollection
+	}
 	return variableValue, nil
 }
 
@@ -43,7 +50,7 @@ func resolveStringVariable(stringVariable *ast.JsonExtendedStringWIthVariableNod
 	var resultBytes []byte = make([]byte, len(stringVariable.Value))
 	copy(resultBytes, stringVariable.Value)
 	for variableName, replacer := range stringVariable.Variables {
-		variableValue, ok := resolver.variables[variableName]
+		variableValue, ok := lookupVariable(resolver.variables, stringVariable, variableName)
 		if !ok {
 			continue
 		}
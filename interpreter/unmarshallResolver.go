@@ -29,6 +29,7 @@ type unmarshallResolver struct {
 	ptrToActualValue     reflect.Value // single ptr to no matter what actual value is (for *****int, keeps only *int to the actual value)
 	fields               map[string]*util.JSONStructField
 	hasUnmarshaller      bool
+	decode               func(data []byte) (reflect.Value, error) // the decoder of the codec registered for the type
 	tagOption            *util.JsonTagOptions
 	extendOption         *util.JsonExtendOptions
 }
@@ -245,7 +246,11 @@ func newUnmarshallResolver(
 	options *unmarshallOptions,
 	tagOption *util.JsonTagOptions,
 	extendOption *util.JsonExtendOptions) (*unmarshallResolver, error) {
-	var nodeToWork ast.JsonNode = node
+	// the members of a collection must be known before its value is created
+	nodeToWork, err := expandCollectionNode(node, options.variables, options.duplicateKeys)
+	if err != nil {
+		return nil, err
+	}
 	someOutType := outType
 	numberOfPointer := 0
 	var elementKind reflect.Kind
@@ -256,48 +261,56 @@ func newUnmarshallResolver(
 		numberOfPointer += 1
 	}
 	var ptrToActualValue reflect.Value
-	// use a pointer to hold no matter what it is inside
-	switch someOutType.Kind() {
-	case reflect.Slice:
-		ptr, convertedNode, err := createPtrToSliceValue(nodeToWork, someOutType)
-		if err != nil {
-			return nil, err
-		}
-		if convertedNode != nil {
-			nodeToWork = convertedNode
-		}
-		ptrToActualValue = ptr
-		elementKind = reflect.Slice
-	case reflect.Array:
-		ptr, err := createPtrToArrayValue(nodeToWork, someOutType)
-		if err != nil {
-			return nil, err
-		}
-		ptrToActualValue = ptr
-		elementKind = reflect.Array
-	case reflect.Map:
-		newMap := reflect.MakeMap(someOutType)
-		ptrToActualValue = reflect.New(newMap.Type())
-		ptrToActualValue.Elem().Set(newMap)
-		elementKind = reflect.Map
-	case reflect.Struct:
-		ptrToActualValue = reflect.New(someOutType) //*Struct
-		elementKind = reflect.Struct
-	case reflect.Interface:
-		// someField: interface{}
-		ptr, err := createPtrToInterfaceValue(nodeToWork, someOutType)
-		if err != nil {
-			return nil, err
-		}
-		ptrToActualValue = ptr
-		elementKind = reflect.Interface
-	default: // primitives
+	// the codec or the time decoder reads the value whatever its kind is
+	decode := options.decoderOf(someOutType, extendOption)
+	if decode != nil {
 		ptrToActualValue = reflect.New(someOutType)
-		ptrToActualValue.Elem().Set(reflect.Zero(someOutType))
 		elementKind = someOutType.Kind()
+	} else {
+		// use a pointer to hold no matter what it is inside
+		switch someOutType.Kind() {
+		case reflect.Slice:
+			ptr, convertedNode, err := createPtrToSliceValue(nodeToWork, someOutType)
+			if err != nil {
+				return nil, err
+			}
+			if convertedNode != nil {
+				nodeToWork = convertedNode
+			}
+			ptrToActualValue = ptr
+			elementKind = reflect.Slice
+		case reflect.Array:
+			ptr, err := createPtrToArrayValue(nodeToWork, someOutType)
+			if err != nil {
+				return nil, err
+			}
+			ptrToActualValue = ptr
+			elementKind = reflect.Array
+		case reflect.Map:
+			newMap := reflect.MakeMap(someOutType)
+			ptrToActualValue = reflect.New(newMap.Type())
+			ptrToActualValue.Elem().Set(newMap)
+			elementKind = reflect.Map
+		case reflect.Struct:
+			ptrToActualValue = reflect.New(someOutType) //*Struct
+			elementKind = reflect.Struct
+		case reflect.Interface:
+			// someField: interface{}
+			ptr, err := createPtrToInterfaceValue(nodeToWork, someOutType)
+			if err != nil {
+				return nil, err
+			}
+			ptrToActualValue = ptr
+			elementKind = reflect.Interface
+		default: // primitives
+			ptrToActualValue = reflect.New(someOutType)
+			ptrToActualValue.Elem().Set(reflect.Zero(someOutType))
+			elementKind = someOutType.Kind()
+		}
 	}
+	attachGoTypePlugins(nodeToWork, outType, options.plugins)
 	// we only support pointer receiver unmarshaler, therefore pass in the Pointer not the pointer to element
-	hasUnmarshaller := implementsUnmarshaler(ptrToActualValue.Type())
+	hasUnmarshaller := decode == nil && implementsUnmarshaler(ptrToActualValue.Type())
 
 	base := &unmarshallResolver{
 		options:              options,
@@ -312,6 +325,7 @@ func newUnmarshallResolver(
 		outElementKind:       elementKind,
 		IsNil:                nodeToWork.GetNodeType() == ast.AST_NULL,
 		hasUnmarshaller:      hasUnmarshaller,
+		decode:               decode,
 		tagOption:            tagOption,
 		extendOption:         extendOption,
 	}
@@ -359,7 +373,24 @@ func (resolver *unmarshallResolver) resolveByCustomizeObjectUnmarshal(node ast.J
 	}
 }
 
+// render the node and read it with the decoder of the codec
+func (resolver *unmarshallResolver) resolveByCodec(node ast.JsonNode) error {
+	payload, err := InterpretAST(node, resolver.options.variables, resolver.options.marshaler)
+	if err != nil {
+		return err
+	}
+	value, err := resolver.decode(payload)
+	if err != nil {
+		return err
+	}
+	resolver.ptrToActualValue.Elem().Set(value)
+	return resolver.resolve()
+}
+
 func (resolver *unmarshallResolver) VisitArrayNode(node *ast.JsonArrayNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	// fill the values in the reflection.Value
 	if resolver.hasUnmarshaller {
 		return resolver.resolveByCustomizeObjectUnmarshal(node)
@@ -405,6 +436,9 @@ func (resolver *unmarshallResolver) VisitKeyValuePairNode(node *ast.JsonKeyValue
 }
 
 func (resolver *unmarshallResolver) VisitObjectNode(node *ast.JsonObjectNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		return resolver.resolveByCustomizeObjectUnmarshal(node)
 	}
@@ -419,6 +453,9 @@ func (resolver *unmarshallResolver) VisitObjectNode(node *ast.JsonObjectNode) er
 }
 
 func (resolver *unmarshallResolver) VisitBooleanNode(node *ast.JsonBooleanNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		if node.Value {
 			return resolver.resolveByCustomizePrimitiveUnmarshal(token.TrueBytes)
@@ -431,6 +468,10 @@ func (resolver *unmarshallResolver) VisitBooleanNode(node *ast.JsonBooleanNode)
 }
 
 func (resolver *unmarshallResolver) VisitNullNode(node *ast.JsonNullNode) error {
+	// a null pointer is nil, the decoder only reads null into a value
+	if resolver.decode != nil && !resolver.isPointerValue {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		// fast unmarshal instead of using interpreter for primitive values
 		return resolver.resolveByCustomizePrimitiveUnmarshal(token.NullBytes)
@@ -440,6 +481,9 @@ func (resolver *unmarshallResolver) VisitNullNode(node *ast.JsonNullNode) error
 }
 
 func (resolver *unmarshallResolver) VisitNumberNode(node *ast.JsonNumberNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		// fast unmarshal instead of using interpreter for primitive values
 		numStr, err := util.EncodePrimitiveValue(node.Value)
@@ -470,6 +514,9 @@ func (resolver *unmarshallResolver) resolveByCustomizePrimitiveUnmarshal(payload
 }
 
 func (resolver *unmarshallResolver) VisitStringNode(node *ast.JsonStringNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		return resolver.resolveByCustomizePrimitiveUnmarshal(node.Value)
 	}
@@ -479,6 +526,7 @@ func (resolver *unmarshallResolver) VisitStringNode(node *ast.JsonStringNode) er
 	}
 	valueToUnmarshal = util.RepairUTF8(valueToUnmarshal)
 	if resolver.tagOption == nil || !resolver.tagOption.StringEncode {
+		resolver.bindStringTemplate(valueToUnmarshal)
 		resolver.setValue(valueToUnmarshal)
 		return resolver.resolve()
 	}
@@ -524,7 +572,22 @@ func (resolver *unmarshallResolver) VisitStringNode(node *ast.JsonStringNode) er
 	return resolver.resolve()
 }
 
+// bind the variables of the `jsonext:"s=..."` template of the field from the string read
+func (resolver *unmarshallResolver) bindStringTemplate(value string) {
+	if resolver.options.bound == nil || resolver.extendOption == nil || resolver.extendOption.FieldStringTemplate == "" {
+		return
+	}
+	if variables, ok := util.MatchStringTemplate(resolver.extendOption.FieldStringTemplate, value); ok {
+		for name, variable := range variables {
+			resolver.options.bound[name] = variable
+		}
+	}
+}
+
 func (resolver *unmarshallResolver) VisitStringWithVariableNode(node *ast.JsonExtendedStringWIthVariableNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		return resolver.resolveByCustomizePrimitiveUnmarshal([]byte(node.Value))
 	}
@@ -533,11 +596,15 @@ func (resolver *unmarshallResolver) VisitStringWithVariableNode(node *ast.JsonEx
 		return err
 	}
 	valueToSet := util.RepairUTF8(string(result))
+	resolver.bindStringTemplate(valueToSet)
 	resolver.setValue(valueToSet)
 	return resolver.resolve()
 }
 
 func (resolver *unmarshallResolver) VisitVariableNode(node *ast.JsonExtendedVariableNode) error {
+	if resolver.decode != nil {
+		return resolver.resolveByCodec(node)
+	}
 	if resolver.hasUnmarshaller {
 		return resolver.resolveByCustomizePrimitiveUnmarshal(node.Value)
 	}
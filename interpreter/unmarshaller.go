@@ -1,12 +1,10 @@
 package interpreter
 
 import (
-	"bytes"
 	"io"
 	"reflect"
 
 	"github.com/jaksonlin/go-jsonextend/ast"
-	"github.com/jaksonlin/go-jsonextend/tokenizer"
 	"github.com/jaksonlin/go-jsonextend/util"
 )
 
@@ -118,13 +116,15 @@ func (resolver *unmarshallResolver) process() error {
 
 // use marshaler to deal with the string variable/variable, use unmarshaler to deal with the json tag `string` option
 func UnmarshallAST(node ast.JsonNode, variables map[string]interface{}, marshaler ast.MarshalerFunc, unmarshaler ast.UnmarshalerFunc, out interface{}) error {
+	return unmarshallAST(node, NewUnMarshallOptions(variables, marshaler, unmarshaler), out)
+}
+
+func unmarshallAST(node ast.JsonNode, options *unmarshallOptions, out interface{}) error {
 	// deep first traverse the AST
 	valueItem := reflect.ValueOf(out)
 	if valueItem.Kind() != reflect.Pointer || valueItem.IsNil() {
 		return ErrOutNotPointer
 	}
-
-	options := NewUnMarshallOptions(variables, marshaler, unmarshaler)
 	traverseStack := options.resolverStack
 	resolver, err := newUnmarshallResolver(node, valueItem.Type(), options, nil, nil)
 	if err != nil {
@@ -171,23 +171,55 @@ func UnmarshallAST(node ast.JsonNode, variables map[string]interface{}, marshale
 
 const maxDepth = 100
 
-func unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}, depth int) error {
+func unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}, depth int, options *Options) error {
 	if depth > maxDepth {
 		return ErrorSelfCallTooDeep
 	}
-	sm := tokenizer.NewTokenizerStateMachineFromIOReader(reader)
-	err := sm.ProcessData()
+	ast, err := parseDocument(reader, options)
 	if err != nil {
 		return err
 	}
-	if sm.GetASTBuilder().HasOpenElements() {
-		return ErrorInvalidJson
+	return unmarshalDocument(ast, variables, out, depth, options)
+}
+
+func unmarshalBytes(data []byte, variables map[string]interface{}, out interface{}, depth int, options *Options) error {
+	if depth > maxDepth {
+		return ErrorSelfCallTooDeep
+	}
+	ast, err := parseDocumentBytes(data, options)
+	if err != nil {
+		return err
 	}
-	ast := sm.GetAST()
-	return UnmarshallAST(ast, variables, Marshal, func(v []byte, out interface{}) error {
-		return unmarshal(bytes.NewReader(v), variables, out, depth+1)
-	}, out)
+	return unmarshalDocument(ast, variables, out, depth, options)
 }
-func Unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}) error {
-	return unmarshal(reader, variables, out, 1)
+
+func unmarshalDocument(node ast.JsonNode, variables map[string]interface{}, out interface{}, depth int, options *Options) error {
+	if err := attachPlugins(node, options.plugins); err != nil {
+		return err
+	}
+	resolverOptions := NewUnMarshallOptions(options.clockVariables(variables), options.marshaler(), func(v []byte, out interface{}) error {
+		return unmarshalBytes(v, variables, out, depth+1, options)
+	})
+	resolverOptions.duplicateKeys = options.duplicateKeys
+	resolverOptions.plugins = options.plugins
+	resolverOptions.codecs = options.codecs
+	resolverOptions.bound = options.bound
+	return unmarshallAST(node, resolverOptions, out)
+}
+
+func Unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}, options ...Option) error {
+	unmarshalOptions, err := NewOptions(options...)
+	if err != nil {
+		return err
+	}
+	return unmarshal(reader, variables, out, 1, unmarshalOptions)
+}
+
+// unmarshal a document in memory, it is scanned in place instead of through a buffered reader
+func UnmarshalBytes(data []byte, variables map[string]interface{}, out interface{}, options ...Option) error {
+	unmarshalOptions, err := NewOptions(options...)
+	if err != nil {
+		return err
+	}
+	return unmarshalBytes(data, variables, out, 1, unmarshalOptions)
 }
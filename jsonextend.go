@@ -2,29 +2,187 @@ package jsonextend
 
 import (
 	"io"
+	"io/fs"
+	"reflect"
+	"time"
 
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/astbuilder/bytebase"
 	"github.com/jaksonlin/go-jsonextend/interpreter"
 )
 
+// option of Parse/Unmarshal
+type Option = interpreter.Option
+
+// limits of the documents read by Parse/Unmarshal, zero means no limit
+type Limits = bytebase.Limits
+
+// a difference found by Diff
+type Change = ast.Change
+
+// a template for Merge and the name recorded on its nodes
+type MergeSource = ast.MergeSource
+
+// the nodes a plugin of WithPlugin is attached to
+type NodeMatcher = interpreter.NodeMatcher
+
+// a variable found by Extract with two different values
+type ExtractConflictError = interpreter.ExtractConflictError
+
 // parse a jsonextend document with the variables into json bytes.
-func Parse(reader io.Reader, variables map[string]interface{}) ([]byte, error) {
-	return interpreter.ParseJsonExtendDocument(reader, variables)
+func Parse(reader io.Reader, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	return interpreter.ParseJsonExtendDocument(reader, variables, options...)
+}
+
+// same as Parse, the document is scanned in place instead of through a buffered reader, the nodes are still allocated
+func ParseBytes(data []byte, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	return interpreter.ParseJsonExtendDocumentBytes(data, variables, options...)
+}
+
+// the AST of a jsonextend document without rendering it, to be inspected with ast.Query
+func ParseAST(reader io.Reader, options ...Option) (ast.JsonNode, error) {
+	return interpreter.ParseAST(reader, options...)
+}
+
+// write the AST back out as template text, e.g. after editing the AST from ParseAST.
+// the template is written in a single line when indent is empty.
+func FormatTemplate(node ast.JsonNode, indent string) ([]byte, error) {
+	return interpreter.FormatTemplate(node, indent)
+}
+
+// the added, removed and replaced paths that turn the template a into b, see ast.Diff
+func Diff(a ast.JsonNode, b ast.JsonNode) []Change {
+	return ast.Diff(a, b)
+}
+
+// write the changes from Diff as RFC 6902 JSON Patch
+func FormatPatch(changes []Change) ([]byte, error) {
+	return interpreter.FormatPatch(changes)
+}
+
+// the variables that render the template into the document, see interpreter.Extract
+func Extract(template ast.JsonNode, document ast.JsonNode) (map[string]interface{}, error) {
+	return interpreter.Extract(template, document)
+}
+
+// apply the RFC 6902 JSON Patch from ParseAST to the template, see ast.ApplyPatch
+func ApplyPatch(template ast.JsonNode, patch ast.JsonNode) (ast.JsonNode, error) {
+	return ast.ApplyPatch(template, patch)
+}
+
+// apply the RFC 7396 JSON Merge Patch from ParseAST to the template, see ast.ApplyMergePatch
+func ApplyMergePatch(template ast.JsonNode, patch ast.JsonNode) ast.JsonNode {
+	return ast.ApplyMergePatch(template, patch)
+}
+
+// deep merge the templates, e.g. base, region and environment; the later ones take precedence, see ast.Merge
+func Merge(sources []MergeSource, options ...ast.MergeOption) (ast.JsonNode, error) {
+	return ast.Merge(sources, options...)
 }
 
 // unmarshal a jsonextend document with the variables into a struct. should alied with json.Unmarshal
-func Unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}) error {
-	return interpreter.Unmarshal(reader, variables, out)
+func Unmarshal(reader io.Reader, variables map[string]interface{}, out interface{}, options ...Option) error {
+	return interpreter.Unmarshal(reader, variables, out, options...)
+}
+
+// same as Unmarshal, the document is scanned in place instead of through a buffered reader, the nodes are still allocated
+func UnmarshalBytes(data []byte, variables map[string]interface{}, out interface{}, options ...Option) error {
+	return interpreter.UnmarshalBytes(data, variables, out, options...)
+}
+
+// resolve `${include:path}` from fsys, e.g. os.DirFS("templates")
+func WithIncludeFS(fsys fs.FS) Option {
+	return interpreter.WithIncludeFS(fsys)
+}
+
+// accept JSON5 style input: comments, identifier keys, single-quoted strings, hex numbers and trailing commas
+func WithRelaxedMode() Option {
+	return interpreter.WithRelaxedMode()
+}
+
+// keep the spaces and comments of the document in the AST from ParseAST, FormatTemplate then writes it back as it is
+func WithLosslessMode() Option {
+	return interpreter.WithLosslessMode()
+}
+
+// accept RFC 8259 json only (plus the `${}` extension): no trailing commas, leading zeros, invalid escapes,
+// lone surrogates, unescaped control characters or content after the json value
+func WithStrictMode() Option {
+	return interpreter.WithStrictMode()
+}
+
+// record where each value of the template starts, see ast.POSITION_META
+func WithPositions() Option {
+	return interpreter.WithPositions()
+}
+
+// limit the documents from untrusted readers, exceeding a limit fails with a *bytebase.LimitError
+func WithLimits(limits Limits) Option {
+	return interpreter.WithLimits(limits)
+}
+
+// what to do when an object has the same key more than once, e.g. ast.DUPLICATE_KEY_ERROR
+func WithDuplicateKeys(policy ast.DuplicateKeyPolicy) Option {
+	return interpreter.WithDuplicateKeys(policy)
+}
+
+// run the plugin on the nodes matched when Parse renders them or Unmarshal decodes them
+func WithPlugin(match NodeMatcher, plugin ast.ASTNodePlugin) Option {
+	return interpreter.WithPlugin(match, plugin)
+}
+
+// the nodes matching the JSONPath, e.g. `$..password`
+func MatchPath(path string) NodeMatcher {
+	return interpreter.MatchPath(path)
+}
+
+// the values of the node type, e.g. ast.AST_VARIABLE
+func MatchNodeType(nodeType ast.AST_NODETYPE) NodeMatcher {
+	return interpreter.MatchNodeType(nodeType)
+}
+
+// the nodes unmarshalled into the go type, Unmarshal only
+func MatchGoType(goType reflect.Type) NodeMatcher {
+	return interpreter.MatchGoType(goType)
+}
+
+// Unmarshal puts the variables of the fields tagged `jsonext:"s=..."` into bound
+func WithBoundVariables(bound map[string]interface{}) Option {
+	return interpreter.WithBoundVariables(bound)
+}
+
+// MarshalIntoTemplate writes the values under the paths as variables named after their JSON path, e.g.
+// `${spec_replicas}`, and puts the current values into variables
+func WithAutoVariables(variables map[string]interface{}, paths ...string) Option {
+	return interpreter.WithAutoVariables(variables, paths...)
+}
+
+// write time.Duration as nanoseconds rather than a duration string like "1m30s"
+func WithDurationAsNanoseconds() Option {
+	return interpreter.WithDurationAsNanoseconds()
+}
+
+// add the variables `now`, `today` and `unix` read from clock, time.Now or a fixed time in tests. without it
+// they are left for a later render like any other variable
+func WithClock(clock func() time.Time) Option {
+	return interpreter.WithClock(clock)
+}
+
+// write the values of T with encode and read them with decode, for the types without MarshalJSON/UnmarshalJSON.
+// decode is not called for a null read into a *T, the pointer stays nil.
+func RegisterCodec[T any](encode func(value T) ([]byte, error), decode func(data []byte) (T, error)) Option {
+	return interpreter.RegisterCodec[T](encode, decode)
 }
 
 // marshal a struct into json bytes. should alied with json.Marshal
-func Marshal(v interface{}) ([]byte, error) {
-	return interpreter.Marshal(v)
+func Marshal(v interface{}, options ...Option) ([]byte, error) {
+	return interpreter.MarshalWithOptions(v, options...)
 }
 
-func MarshalWithVariables(v interface{}, variables map[string]interface{}) ([]byte, error) {
-	return interpreter.MarshalWithVariables(v, variables)
+func MarshalWithVariables(v interface{}, variables map[string]interface{}, options ...Option) ([]byte, error) {
+	return interpreter.MarshalWithVariables(v, variables, options...)
 }
 
-func MarshalIntoTemplate(v interface{}) ([]byte, error) {
-	return interpreter.MarshalIntoTemplate(v)
+func MarshalIntoTemplate(v interface{}, options ...Option) ([]byte, error) {
+	return interpreter.MarshalIntoTemplate(v, options...)
 }
@@ -3,11 +3,19 @@ package jsonextend_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/jaksonlin/go-jsonextend"
+	"github.com/jaksonlin/go-jsonextend/ast"
+	"github.com/jaksonlin/go-jsonextend/interpreter"
+	"github.com/jaksonlin/go-jsonextend/token"
 )
 
 func TestPoc(t *testing.T) {
@@ -184,3 +192,796 @@ func TestUnmarshal4(t *testing.T) {
 	}
 
 }
+
+func TestSpread(t *testing.T) {
+	template := `{"name": "app", "...": ${labels}, "ports": [80, ${...ports}]}`
+	variables := map[string]interface{}{
+		"labels": map[string]interface{}{"env": "prod", "tier": "web"},
+		"ports":  []int{443, 8080},
+	}
+	var validator map[string]interface{}
+	err := jsonextend.Unmarshal(strings.NewReader(template), variables, &validator)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if validator["env"] != "prod" || validator["tier"] != "web" || len(validator["ports"].([]interface{})) != 3 {
+		t.FailNow()
+	}
+	result, err := jsonextend.Parse(strings.NewReader(template), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var checker map[string]interface{}
+	err = json.Unmarshal(result, &checker)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if checker["env"] != "prod" || len(checker["ports"].([]interface{})) != 3 {
+		t.FailNow()
+	}
+}
+
+func TestConditional(t *testing.T) {
+	template := `{"name": "app", "${?enableTLS}tls": {"port": 443}, "ports": [80, {"$if": ${enableTLS}, "$value": 443}]}`
+	type tls struct {
+		Port int `json:"port"`
+	}
+	type config struct {
+		Name  string `json:"name"`
+		TLS   *tls   `json:"tls"`
+		Ports []int  `json:"ports"`
+	}
+	var enabled config
+	err := jsonextend.Unmarshal(strings.NewReader(template), map[string]interface{}{"enableTLS": true}, &enabled)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if enabled.TLS == nil || enabled.TLS.Port != 443 || len(enabled.Ports) != 2 {
+		t.FailNow()
+	}
+	var disabled config
+	err = jsonextend.Unmarshal(strings.NewReader(template), map[string]interface{}{"enableTLS": false}, &disabled)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if disabled.TLS != nil || len(disabled.Ports) != 1 {
+		t.FailNow()
+	}
+}
+
+func TestLoop(t *testing.T) {
+	template := `{"services": [{"$for": "svc in ${services}", "$do": {"name": "${svc.name}", "port": ${svc.port}}}]}`
+	variables := map[string]interface{}{
+		"services": []map[string]interface{}{{"name": "web", "port": 80}, {"name": "api", "port": 8080}},
+	}
+	result, err := jsonextend.Parse(strings.NewReader(template), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var checker struct {
+		Services []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"services"`
+	}
+	err = json.Unmarshal(result, &checker)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(checker.Services) != 2 || checker.Services[1].Name != "api" || checker.Services[1].Port != 8080 {
+		t.FailNow()
+	}
+}
+
+func TestInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tls.jsonx": {Data: []byte(`{"cert": "${certPath}", "port": 443}`)},
+	}
+	result, err := jsonextend.Parse(strings.NewReader(`{"name": "app", "tls": ${include:tls.jsonx}}`), map[string]interface{}{"certPath": "/etc/cert.pem"}, jsonextend.WithIncludeFS(fsys))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var validator struct {
+		TLS struct {
+			Cert string `json:"cert"`
+		} `json:"tls"`
+	}
+	err = json.Unmarshal(result, &validator)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if validator.TLS.Cert != "/etc/cert.pem" {
+		t.FailNow()
+	}
+}
+
+func TestRelaxedMode(t *testing.T) {
+	template := `{
+		// comments, identifier keys, single quotes and trailing commas
+		name: 'app',
+		port: ${port},
+	}`
+	result, err := jsonextend.Parse(strings.NewReader(template), map[string]interface{}{"port": 8080}, jsonextend.WithRelaxedMode())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var validator struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	err = json.Unmarshal(result, &validator)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if validator.Name != "app" || validator.Port != 8080 {
+		t.FailNow()
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	result, err := jsonextend.Parse(strings.NewReader(`{"name": "${name}", "port": 8080}`), map[string]interface{}{"name": "app"}, jsonextend.WithStrictMode())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !json.Valid(result) {
+		t.FailNow()
+	}
+	_, err = jsonextend.Parse(strings.NewReader("{\n  \"port\": 080\n}"), nil, jsonextend.WithStrictMode())
+	if err == nil || err.Error() != "2:11: number has leading zero" {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := jsonextend.Limits{MaxDepth: 2, MaxDocumentSize: 1 << 10}
+	_, err := jsonextend.Parse(strings.NewReader(`{"a": [1, 2]}`), nil, jsonextend.WithLimits(limits))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	_, err = jsonextend.Parse(strings.NewReader(`{"a": [{}]}`), nil, jsonextend.WithLimits(limits))
+	if err == nil || err.Error() != "1:8: nesting depth exceeds the limit 2" {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	template := `{"Name": "first", "${field}": "second"}`
+	var out struct{ Name string }
+	err := jsonextend.Unmarshal(strings.NewReader(template), map[string]interface{}{"field": "Name"}, &out, jsonextend.WithDuplicateKeys(ast.DUPLICATE_KEY_FIRST_WINS))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.Name != "first" {
+		t.FailNow()
+	}
+	err = jsonextend.Unmarshal(strings.NewReader(template), map[string]interface{}{"field": "Name"}, &out, jsonextend.WithDuplicateKeys(ast.DUPLICATE_KEY_ERROR))
+	var duplicateKeyError *ast.DuplicateKeyError
+	if !errors.As(err, &duplicateKeyError) || duplicateKeyError.Key != "Name" {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestBytes(t *testing.T) {
+	type Config struct {
+		Name    string
+		Port    int
+		Tags    []string
+		Comment string
+	}
+	long := strings.Repeat(`ab\"c`, 2000)
+	template := []byte(`{"Name": "${name}", "Port": 8080, "Tags": ["a", "b\n"], "Comment": "` + long + `"}`)
+	var fromBytes, fromReader Config
+	err := jsonextend.UnmarshalBytes(template, map[string]interface{}{"name": "svc"}, &fromBytes)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	err = jsonextend.Unmarshal(bytes.NewReader(template), map[string]interface{}{"name": "svc"}, &fromReader)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if fmt.Sprint(fromBytes) != fmt.Sprint(fromReader) || fromBytes.Name != "svc" || fromBytes.Tags[1] != "b\n" {
+		t.FailNow()
+	}
+	if fromBytes.Comment != strings.Repeat(`ab"c`, 2000) {
+		t.FailNow()
+	}
+
+	parsed, err := jsonextend.ParseBytes(template, map[string]interface{}{"name": "svc"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected, _ := jsonextend.Parse(bytes.NewReader(template), map[string]interface{}{"name": "svc"})
+	if !bytes.Equal(parsed, expected) {
+		t.FailNow()
+	}
+
+	_, err = jsonextend.ParseBytes(template, nil, jsonextend.WithLimits(jsonextend.Limits{MaxDocumentSize: 64}))
+	if err == nil || !strings.Contains(err.Error(), "document size exceeds the limit 64") {
+		t.Log(err)
+		t.FailNow()
+	}
+	_, err = jsonextend.ParseBytes([]byte(`{"a": 01}`), nil, jsonextend.WithStrictMode())
+	if err == nil || err.Error() != "1:7: number has leading zero" {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	redact := ast.NewASTNodePlugin("redact", func(visitor ast.JsonVisitor, node ast.JsonNode) error {
+		node.SetVisited()
+		return visitor.VisitStringNode(&ast.JsonStringNode{Value: []byte(`"***"`)})
+	}, nil)
+	traced := make([]string, 0)
+	trace := ast.NewASTNodePlugin("trace", nil, func(visitor ast.JsonVisitor, node ast.JsonNode) error {
+		traced = append(traced, node.(*ast.JsonExtendedVariableNode).Variable)
+		return nil
+	})
+	template := `{"user": "${user}", "db": {"host": "localhost", "password": ${password}}, "replicas": ${replicas}}`
+	variables := map[string]interface{}{"user": "admin", "password": "secret", "replicas": 2}
+	options := []jsonextend.Option{
+		jsonextend.WithPlugin(jsonextend.MatchPath("$..password"), redact),
+		jsonextend.WithPlugin(jsonextend.MatchNodeType(ast.AST_VARIABLE), trace),
+	}
+	result, err := jsonextend.Parse(strings.NewReader(template), variables, options...)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var out map[string]interface{}
+	if err = json.Unmarshal(result, &out); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out["db"].(map[string]interface{})["password"] != "***" || out["user"] != "admin" {
+		t.Log(string(result))
+		t.FailNow()
+	}
+	// the post visit plugins run after the pre visit plugins of the redacted node too
+	if strings.Join(traced, ",") != "password,replicas" {
+		t.Log(traced)
+		t.FailNow()
+	}
+
+	type DB struct {
+		Host     string `json:"host"`
+		Password string `json:"password"`
+	}
+	type Config struct {
+		User     string `json:"user"`
+		DB       DB     `json:"db"`
+		Replicas int    `json:"replicas"`
+	}
+	lower := ast.NewASTNodePlugin("lower", func(visitor ast.JsonVisitor, node ast.JsonNode) error {
+		if stringNode, ok := node.(*ast.JsonStringNode); ok {
+			stringNode.Value = bytes.ToLower(stringNode.Value)
+		}
+		return nil
+	}, nil)
+	var config Config
+	err = jsonextend.Unmarshal(strings.NewReader(`{"user": "ADMIN", "db": {"host": "LOCALHOST", "password": ${password}}, "replicas": 2}`), variables, &config,
+		jsonextend.WithPlugin(jsonextend.MatchPath("$..password"), redact),
+		jsonextend.WithPlugin(jsonextend.MatchGoType(reflect.TypeOf(DB{})), ast.NewASTNodePlugin("db", nil, nil)),
+		jsonextend.WithPlugin(jsonextend.MatchGoType(reflect.TypeOf("")), lower))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if config.User != "admin" || config.DB.Host != "localhost" || config.DB.Password != "***" || config.Replicas != 2 {
+		t.Log(config)
+		t.FailNow()
+	}
+
+	if _, err = jsonextend.Parse(strings.NewReader(template), variables, jsonextend.WithPlugin(jsonextend.MatchPath("db"), redact)); !errors.Is(err, ast.ErrorASTInvalidPath) {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	milliseconds := jsonextend.RegisterCodec[time.Duration](func(d time.Duration) ([]byte, error) {
+		return json.Marshal(d.Milliseconds())
+	}, func(data []byte) (time.Duration, error) {
+		var ms int64
+		if err := json.Unmarshal(data, &ms); err != nil {
+			return 0, err
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	})
+	type Config struct {
+		Timeout time.Duration   `json:"timeout"`
+		Retry   *time.Duration  `json:"retry"`
+		Steps   []time.Duration `json:"steps"`
+		Count   int64           `json:"count"`
+	}
+	retry := 3 * time.Second
+	config := Config{Timeout: 5 * time.Second, Retry: &retry, Steps: []time.Duration{time.Second, 2 * time.Minute}, Count: 2}
+	result, err := jsonextend.Marshal(config, milliseconds)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(result) != `{"timeout":5000,"retry":3000,"steps":[1000,120000],"count":2}` {
+		t.Log(string(result))
+		t.FailNow()
+	}
+	// the codecs belong to the options, without them the duration is a duration string
+	result, err = jsonextend.Marshal(config)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !strings.Contains(string(result), `"timeout":"5s"`) {
+		t.Log(string(result))
+		t.FailNow()
+	}
+
+	var out Config
+	template := `{"timeout": ${timeout}, "retry": ${retry}, "steps": [1000, 120000], "count": 2}`
+	variables := map[string]interface{}{"timeout": 5 * time.Second, "retry": 3000}
+	if err = jsonextend.Unmarshal(strings.NewReader(template), variables, &out, milliseconds); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(out, config) {
+		t.Log(out)
+		t.FailNow()
+	}
+	rendered, err := jsonextend.Parse(strings.NewReader(`{"timeout": ${timeout}}`), variables, milliseconds)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !strings.Contains(string(rendered), `5000`) {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"timeout": "soon"}`), nil, &out, milliseconds); err == nil {
+		t.Log("expect the error of the decoder")
+		t.FailNow()
+	}
+
+	// a null pointer does not reach the decoder
+	strict := jsonextend.RegisterCodec[time.Duration](nil, func(data []byte) (time.Duration, error) {
+		if string(data) == "null" {
+			return 0, errors.New("null duration")
+		}
+		return time.ParseDuration(strings.Trim(string(data), `"`))
+	})
+	out = Config{Retry: &retry}
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"timeout": "1s", "retry": null}`), nil, &out, strict); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.Timeout != time.Second || out.Retry != nil {
+		t.Log(out)
+		t.FailNow()
+	}
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"timeout": null}`), nil, &out, strict); err == nil {
+		t.Log("expect the decoder to read null into a value")
+		t.FailNow()
+	}
+
+	// the numbers of an encoder keep all their digits
+	type ID struct{ value uint64 }
+	type Decimal struct{ digits string }
+	ids := jsonextend.RegisterCodec[ID](func(id ID) ([]byte, error) {
+		return []byte(strconv.FormatUint(id.value, 10)), nil
+	}, nil)
+	decimals := jsonextend.RegisterCodec[Decimal](func(d Decimal) ([]byte, error) {
+		return []byte(d.digits), nil
+	}, nil)
+	type Order struct {
+		ID     ID        `json:"id"`
+		Amount Decimal   `json:"amount"`
+		Parts  []Decimal `json:"parts"`
+	}
+	order := Order{ID: ID{9007199254740993}, Amount: Decimal{"12345678901234567890.123456789"}, Parts: []Decimal{{"0.10000000000000000001"}}}
+	result, err = jsonextend.Marshal(order, ids, decimals)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(result) != `{"id":9007199254740993,"amount":12345678901234567890.123456789,"parts":[0.10000000000000000001]}` {
+		t.Log(string(result))
+		t.FailNow()
+	}
+}
+
+func TestTime(t *testing.T) {
+	type Event struct {
+		At    time.Time     `json:"at"`
+		Day   time.Time     `json:"day" jsonext:"time=2006-01-02"`
+		Stamp time.Time     `json:"stamp" jsonext:"time=RFC1123"`
+		Wait  time.Duration `json:"wait"`
+		Next  *time.Time    `json:"next"`
+	}
+	at := time.Date(2024, 3, 1, 10, 30, 0, 500, time.UTC)
+	event := Event{At: at, Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Stamp: at.Truncate(time.Second), Wait: 90 * time.Second}
+	result, err := jsonextend.Marshal(event)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `{"at":"2024-03-01T10:30:00.0000005Z","day":"2024-03-01","stamp":"Fri, 01 Mar 2024 10:30:00 UTC","wait":"1m30s","next":null}`
+	if string(result) != expected {
+		t.Log(string(result))
+		t.FailNow()
+	}
+	var out Event
+	if err = jsonextend.Unmarshal(bytes.NewReader(result), nil, &out); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !out.At.Equal(event.At) || !out.Day.Equal(event.Day) || !out.Stamp.Equal(event.Stamp) || out.Wait != event.Wait || out.Next != nil {
+		t.Log(out)
+		t.FailNow()
+	}
+
+	result, err = jsonextend.Marshal(event, jsonextend.WithDurationAsNanoseconds())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !strings.Contains(string(result), `"wait":90000000000`) {
+		t.Log(string(result))
+		t.FailNow()
+	}
+	// the nanoseconds are read back as well as the duration strings
+	if err = jsonextend.Unmarshal(bytes.NewReader(result), nil, &out); err != nil || out.Wait != event.Wait {
+		t.Log(err, out.Wait)
+		t.FailNow()
+	}
+
+	clock := jsonextend.WithClock(func() time.Time { return at })
+	rendered, err := jsonextend.Parse(strings.NewReader(`{"at": ${now}, "day": "${today}", "unix": ${unix}, "note": "at ${now}"}`), nil, clock)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var values map[string]interface{}
+	if err = json.Unmarshal(rendered, &values); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if values["at"] != "2024-03-01T10:30:00.0000005Z" || values["day"] != "2024-03-01" || values["unix"] != float64(at.Unix()) || values["note"] != "at 2024-03-01T10:30:00.0000005Z" {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+	// the variables passed in come before the clock
+	rendered, err = jsonextend.Parse(strings.NewReader(`"${today}"`), map[string]interface{}{"today": "monday"}, clock)
+	if err != nil || string(rendered) != `"monday"` {
+		t.Log(string(rendered), err)
+		t.FailNow()
+	}
+	out = Event{}
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"at": ${now}, "wait": "2h"}`), nil, &out, clock); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !out.At.Equal(at) || out.Wait != 2*time.Hour {
+		t.Log(out)
+		t.FailNow()
+	}
+	// without a clock the variables are left for a later render
+	rendered, err = jsonextend.Parse(strings.NewReader(`{"at": ${now}, "note": "at ${now}"}`), map[string]interface{}{})
+	if err != nil || !strings.Contains(string(rendered), `"at" : ${now}`) || !strings.Contains(string(rendered), `"at ${now}"`) {
+		t.Log(string(rendered), err)
+		t.FailNow()
+	}
+	if _, err = jsonextend.Parse(strings.NewReader(`1`), nil, jsonextend.WithClock(nil)); !errors.Is(err, interpreter.ErrorClockNil) {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestStringTemplateTag(t *testing.T) {
+	type Service struct {
+		Name string `json:"name"`
+		URL  string `json:"url" jsonext:"s=https://${host}/api/${version}"`
+	}
+	template, err := jsonextend.MarshalIntoTemplate(Service{Name: "users", URL: "https://localhost/api/v1"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(template) != `{"name":"users","url":"https://${host}/api/${version}"}` {
+		t.Log(string(template))
+		t.FailNow()
+	}
+	variables := map[string]interface{}{"host": "example.com", "version": "v2"}
+	var out Service
+	if err = jsonextend.Unmarshal(bytes.NewReader(template), variables, &out); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if out.URL != "https://example.com/api/v2" {
+		t.Log(out)
+		t.FailNow()
+	}
+
+	// the reverse: the variables are taken out of the string matching the template
+	bound := make(map[string]interface{})
+	out = Service{}
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"name": "users", "url": "https://example.com/api/v2"}`), nil, &out, jsonextend.WithBoundVariables(bound)); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(bound, variables) || out.URL != "https://example.com/api/v2" {
+		t.Log(bound, out)
+		t.FailNow()
+	}
+	rendered, err := jsonextend.MarshalWithVariables(out, bound)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rendered) != `{"name":"users","url":"https://example.com/api/v2"}` {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+	// the variables take text spanning lines
+	bound = make(map[string]interface{})
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"url": "https://example.com/api/v2\nv3"}`), nil, &out, jsonextend.WithBoundVariables(bound)); err != nil || bound["version"] != "v2\nv3" {
+		t.Log(err, bound)
+		t.FailNow()
+	}
+	// a string not matching the template binds nothing
+	bound = make(map[string]interface{})
+	if err = jsonextend.Unmarshal(strings.NewReader(`{"url": "ftp://example.com"}`), nil, &out, jsonextend.WithBoundVariables(bound)); err != nil || len(bound) != 0 || out.URL != "ftp://example.com" {
+		t.Log(err, bound, out)
+		t.FailNow()
+	}
+}
+
+func TestExtract(t *testing.T) {
+	template := `{
+		"name": "${app}",
+		"url": "https://${host}:${port}/api",
+		"port": ${port},
+		"${?tls}tls": {"port": 443},
+		"labels": {"team": "core", "...": ${labels}},
+		"services": [{"$for": "svc in ${services}", "$do": {"name": "${svc.name}", "replicas": ${svc.replicas}}}],
+		"ports": [80, ${...extra}],
+		"db": {"host": "${db.host}"}
+	}`
+	variables := map[string]interface{}{
+		"app":      "web",
+		"host":     "example.com",
+		"port":     8080,
+		"tls":      true,
+		"labels":   map[string]interface{}{"env": "prod"},
+		"services": []interface{}{map[string]interface{}{"name": "a", "replicas": 2}, map[string]interface{}{"name": "b", "replicas": 3}},
+		"extra":    []interface{}{443},
+		"db":       map[string]interface{}{"host": "db.local"},
+	}
+	templateNode, err := jsonextend.ParseAST(strings.NewReader(template))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	rendered, err := jsonextend.Parse(strings.NewReader(template), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	document, err := jsonextend.ParseAST(bytes.NewReader(rendered))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	extracted, err := jsonextend.Extract(templateNode, document)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	// the values are read back the way Unmarshal reads them into an interface{}
+	expected := map[string]interface{}{}
+	data, _ := json.Marshal(variables)
+	_ = json.Unmarshal(data, &expected)
+	if !reflect.DeepEqual(extracted, expected) {
+		t.Log(extracted)
+		t.FailNow()
+	}
+	// rendering the template with the extracted variables gives the document back
+	again, err := jsonextend.Parse(strings.NewReader(template), extracted)
+	if err != nil || !bytes.Equal(again, rendered) {
+		t.Log(string(again), err)
+		t.FailNow()
+	}
+
+	parse := func(s string) ast.JsonNode {
+		node, err := jsonextend.ParseAST(strings.NewReader(s))
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		return node
+	}
+	// the member left out by a condition makes it false
+	extracted, err = jsonextend.Extract(parse(`{"a": 1, "${?tls}tls": true}`), parse(`{"a": 1}`))
+	if err != nil || extracted["tls"] != false {
+		t.Log(extracted, err)
+		t.FailNow()
+	}
+	var conflict *jsonextend.ExtractConflictError
+	_, err = jsonextend.Extract(parse(`{"a": ${x}, "b": "v${x}"}`), parse(`{"a": 1, "b": "v2"}`))
+	if !errors.As(err, &conflict) || conflict.Variable != "x" || conflict.FirstPath != "/a" || conflict.SecondPath != "/b" {
+		t.Log(err)
+		t.FailNow()
+	}
+	// the same value written as a number and in a string is not a conflict
+	extracted, err = jsonextend.Extract(parse(`{"a": ${x}, "b": "v${x}"}`), parse(`{"a": 2, "b": "v2"}`))
+	if err != nil || extracted["x"] != float64(2) {
+		t.Log(extracted, err)
+		t.FailNow()
+	}
+	// the text between the anchors may span lines, a repeated variable takes the same text each time
+	extracted, err = jsonextend.Extract(parse(`{"note": "${title}:\n${body}", "pair": "${a}-${a}", "${k}-${k}": 1}`), parse(`{"note": "todo:\nfirst\nsecond", "pair": "x-y-x-y", "p-q-p-q": 1}`))
+	if err != nil || extracted["title"] != "todo" || extracted["body"] != "first\nsecond" || extracted["a"] != "x-y" || extracted["k"] != "p-q" {
+		t.Log(extracted, err)
+		t.FailNow()
+	}
+	if _, err = jsonextend.Extract(parse(`{"pair": "${a}-${a}"}`), parse(`{"pair": "x-y"}`)); !errors.Is(err, interpreter.ErrorExtractMismatch) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if _, err = jsonextend.Extract(parse(`{"a": 1, "b": ${b}}`), parse(`{"a": 2, "b": 3}`)); !errors.Is(err, interpreter.ErrorExtractMismatch) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if _, err = jsonextend.Extract(parse(`{"a": 1}`), parse(`{"a": 1, "b": 3}`)); !errors.Is(err, interpreter.ErrorExtractMismatch) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if _, err = jsonextend.Extract(parse(`[${...a}, ${...b}]`), parse(`[1, 2]`)); !errors.Is(err, interpreter.ErrorExtractAmbiguous) {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestAutoVariables(t *testing.T) {
+	type Port struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type Spec struct {
+		Replicas int     `json:"replicas"`
+		Paused   bool    `json:"paused"`
+		Image    *string `json:"image"`
+		Ports    []Port  `json:"ports"`
+	}
+	type Deployment struct {
+		Name string `json:"name"`
+		Spec Spec   `json:"spec"`
+	}
+	deployment := Deployment{Name: "web", Spec: Spec{Replicas: 3, Ports: []Port{{"http", 80}, {"https", 443}}}}
+	expected, err := jsonextend.Marshal(deployment)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	variables := make(map[string]interface{})
+	template, err := jsonextend.MarshalIntoTemplate(deployment, jsonextend.WithAutoVariables(variables))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(template) != `{"name":${name},"spec":{"replicas":${spec_replicas},"paused":${spec_paused},"image":${spec_image},"ports":[{"name":${spec_ports_0_name},"port":${spec_ports_0_port}},{"name":${spec_ports_1_name},"port":${spec_ports_1_port}}]}}` {
+		t.Log(string(template))
+		t.FailNow()
+	}
+	if variables["spec_replicas"] != 3 || variables["spec_ports_1_name"] != "https" || variables["spec_image"] != nil {
+		t.Log(variables)
+		t.FailNow()
+	}
+	rendered, err := jsonextend.Parse(bytes.NewReader(template), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	var left, right interface{}
+	if err = json.Unmarshal(rendered, &left); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err = json.Unmarshal(expected, &right); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(left, right) {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+
+	// only the values under the paths
+	variables = make(map[string]interface{})
+	template, err = jsonextend.MarshalIntoTemplate(deployment, jsonextend.WithAutoVariables(variables, "$.spec.replicas", "$.spec.ports[*].port"))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(template) != `{"name":"web","spec":{"replicas":${spec_replicas},"paused":false,"image":null,"ports":[{"name":"http","port":${spec_ports_0_port}},{"name":"https","port":${spec_ports_1_port}}]}}` || len(variables) != 3 {
+		t.Log(string(template), variables)
+		t.FailNow()
+	}
+
+	// the names of the tagged variables and of the variables given are not taken
+	type Tagged struct {
+		A int `json:"a" jsonext:"v=b"`
+		B int `json:"b"`
+		C int `json:"c"`
+	}
+	variables = map[string]interface{}{"b": 1, "c": 3}
+	template, err = jsonextend.MarshalIntoTemplate(Tagged{A: 1, B: 2, C: 3}, jsonextend.WithAutoVariables(variables))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(template) != `{"a":${b},"b":${b_2},"c":${c_2}}` || variables["b"] != 1 || variables["b_2"] != 2 || variables["c_2"] != 3 {
+		t.Log(string(template), variables)
+		t.FailNow()
+	}
+	rendered, err = jsonextend.Parse(bytes.NewReader(template), variables)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(bytes.Join(bytes.Fields(rendered), nil)) != `{"a":1,"b":2,"c":3}` {
+		t.Log(string(rendered))
+		t.FailNow()
+	}
+
+	if _, err = jsonextend.MarshalIntoTemplate(deployment, jsonextend.WithAutoVariables(nil)); !errors.Is(err, interpreter.ErrorAutoVariablesNil) {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestPositions(t *testing.T) {
+	fsys := fstest.MapFS{"tls.jsonx": {Data: []byte("{\"port\": ${port}}")}}
+	root, err := jsonextend.ParseAST(strings.NewReader("{\"name\": \"app\",\n \"ports\": [80, ${include:tls.jsonx}]}"),
+		jsonextend.WithPositions(), jsonextend.WithIncludeFS(fsys))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := map[string]string{
+		"$":               "1:1",
+		"$.name":          "1:10",
+		"$.ports":         "2:11",
+		"$.ports[0]":      "2:12",
+		"$.ports[1].port": "tls.jsonx:1:10",
+	}
+	for path, position := range expected {
+		nodes, err := ast.Query(root, path)
+		if err != nil || len(nodes) != 1 {
+			t.Log(path, err)
+			t.FailNow()
+		}
+		if p, ok := nodes[0].GetMeta(ast.POSITION_META).(token.Position); !ok || p.String() != position {
+			t.Log(path, p)
+			t.FailNow()
+		}
+	}
+}
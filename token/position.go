@@ -0,0 +1,33 @@
+package token
+
+import "fmt"
+
+// location of a token in a document, Line and Column start from 1, Column counts bytes
+type Position struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// an error found at a position of a document. the tokenizer wraps the errors of reading a document with it, so
+// the cause is compared with errors.Is rather than ==
+type PositionError struct {
+	Position Position
+	Err      error
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position.String(), e.Err.Error())
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
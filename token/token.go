@@ -1,6 +1,9 @@
 package token
 
-import "reflect"
+import (
+	"encoding/json"
+	"reflect"
+)
 
 type TokenType uint
 
@@ -108,6 +111,10 @@ func GetTokenTypeByReflection(v reflect.Value) (TokenType, bool) {
 	if isNil {
 		return TOKEN_NULL, hasInterface
 	}
+	// the number text as it is, e.g. from a codec
+	if val.Type() == reflect.TypeOf(json.Number("")) {
+		return TOKEN_NUMBER, hasInterface
+	}
 
 	switch val.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -16,7 +16,7 @@ var (
 	ErrorInternalASTProcotolChanged        = errors.New("detect unexpect ast stack change, not kv, array, object, NodeType at top of stack")
 	ErrorUnexpectedEOF                     = errors.New("unexpected EOF")
 	ErrorTokenRouteNotConfigure            = errors.New("token route not configure")
-	ErrorExtendedVariableFormatIncorrect   = errors.New("variable should be of ${variableName} format")
+	ErrorExtendedVariableFormatIncorrect   = errors.New("variable should be of ${variableName}, ${...variableName} or ${include:path} format")
 )
 
 func NewErrorIncorrectToken(mode StateMode, token token.TokenType) error {
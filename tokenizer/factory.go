@@ -14,6 +14,23 @@ func NewTokenizerStateMachineFromIOReader(reader io.Reader) *TokenizerStateMachi
 	return newTokenizerStateMachine(astMan)
 }
 
+func NewTokenizerStateMachineFromIOReaderWithOptions(reader io.Reader, options []astbuilder.TokenProviderOptions) (*TokenizerStateMachine, error) {
+	astMan, err := bytebase.NewASTByteBaseBuilderWithOptions(reader, options)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenizerStateMachine(astMan), nil
+}
+
+// the document is read in place, the string nodes of the ast share the bytes of data
+func NewTokenizerStateMachineFromBytes(data []byte, options []astbuilder.TokenProviderOptions) (*TokenizerStateMachine, error) {
+	astMan, err := bytebase.NewASTByteBaseBuilderFromBytes(data, options)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenizerStateMachine(astMan), nil
+}
+
 func NewTokenizerStateMachineFromGoData(obj interface{}, options []astbuilder.TokenProviderOptions) (*TokenizerStateMachine, error) {
 	astMan, err := golang.NewASTGolangBaseBuilder(obj, options)
 	if err != nil {
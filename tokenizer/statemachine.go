@@ -1,6 +1,8 @@
 package tokenizer
 
 import (
+	"errors"
+
 	"github.com/jaksonlin/go-jsonextend/ast"
 	"github.com/jaksonlin/go-jsonextend/astbuilder"
 	"github.com/jaksonlin/go-jsonextend/token"
@@ -83,7 +85,7 @@ func (i *TokenizerStateMachine) ProcessData() error {
 	for {
 		// 1. the ast complete parsing json, end and not read the rest of bytes
 		if i.astBuilder.HasComplete() {
-			return nil
+			return i.checkDocumentEnd()
 		}
 		err := i.currentState.ProcessData(i.astBuilder)
 		// 2. the stream ends, and ast is still expecting content, fail.
@@ -91,16 +93,41 @@ func (i *TokenizerStateMachine) ProcessData() error {
 		if err != nil {
 			if err == io.EOF {
 				if !i.astBuilder.HasComplete() {
-					return ErrorUnexpectedEOF
+					return i.withPosition(ErrorUnexpectedEOF)
 				}
-				return nil
+				return i.checkDocumentEnd()
 			} else {
-				return err
+				return i.withPosition(err)
 			}
 		}
 	}
 }
 
+func (i *TokenizerStateMachine) checkDocumentEnd() error {
+	checker, ok := i.astBuilder.(astbuilder.DocumentEndChecker)
+	if !ok {
+		return nil
+	}
+	err := checker.CheckDocumentEnd()
+	if err != nil {
+		return i.withPosition(err)
+	}
+	return nil
+}
+
+// tell where the error is found when the builder reads from a document
+func (i *TokenizerStateMachine) withPosition(err error) error {
+	provider, ok := i.astBuilder.(astbuilder.PositionProvider)
+	if !ok {
+		return err
+	}
+	var duplicateKeyError *ast.DuplicateKeyError
+	if errors.As(err, &duplicateKeyError) { // names the positions of both keys already
+		return err
+	}
+	return &token.PositionError{Position: provider.Position(), Err: err}
+}
+
 func (i *TokenizerStateMachine) GetCurrentMode() StateMode {
 	return i.currentState.GetMode()
 }
@@ -2,11 +2,16 @@ package tokenizer_test
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"runtime/pprof"
 	"strings"
 	"testing"
 
+	"github.com/jaksonlin/go-jsonextend/astbuilder"
+	"github.com/jaksonlin/go-jsonextend/astbuilder/bytebase"
+	"github.com/jaksonlin/go-jsonextend/interpreter"
+	"github.com/jaksonlin/go-jsonextend/token"
 	"github.com/jaksonlin/go-jsonextend/tokenizer"
 
 	_ "net/http/pprof"
@@ -121,3 +126,215 @@ func TestNull(t *testing.T) {
 	}
 
 }
+
+func TestErrorPosition(t *testing.T) {
+	sm := tokenizer.NewTokenizerStateMachineFromIOReader(strings.NewReader("{\n  \"a\": 1,\n  \"b\": nul\n}"))
+	err := sm.ProcessData()
+	var positionError *token.PositionError
+	if !errors.As(err, &positionError) {
+		t.Log(err)
+		t.FailNow()
+	}
+	if positionError.Position.Line != 3 || positionError.Position.Column != 8 {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestRelaxedMode(t *testing.T) {
+	relaxed := []astbuilder.TokenProviderOptions{bytebase.EnableRelaxedMode}
+	testCases := map[string]string{
+		"// comment\n{name: 'it\\'s', /* block */ \"list\": [1, 2,],}": `{"name":"it's","list":[1,2]}`,
+		`{hex: 0x1F, plus: +1, lead: .5, trail: 5., neg: -0x10}`:       `{"hex":31,"plus":1,"lead":0.5,"trail":5,"neg":-16}`,
+		`{true: 'say "hi"', $v: ${v}}`:                                 `{"true":"say \"hi\"","$v":${v}}`,
+	}
+	for input, expected := range testCases {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), relaxed)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		err = sm.ProcessData()
+		if err != nil {
+			t.Log(input, err)
+			t.FailNow()
+		}
+		rs, err := interpreter.InterpretAST(sm.GetAST(), nil, nil)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if string(rs) != expected {
+			t.Log(string(rs))
+			t.FailNow()
+		}
+	}
+
+	invalid := map[string]error{
+		`[,]`:        bytebase.ErrorSyntaxCommaBehindLastItem,
+		`[1,,]`:      bytebase.ErrorSyntaxElementNotSeparatedByComma,
+		`{a: 1 /* x`: bytebase.ErrorUnterminatedComment,
+		`{a: 0x1G}`:  bytebase.ErrorIncorrectValueForState,
+		`{a: Inf}`:   bytebase.ErrorIncorrectValueForState,
+		`{a: 1 / 2}`: bytebase.ErrorIncorrectCharacter,
+	}
+	for input, expected := range invalid {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), relaxed)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		err = sm.ProcessData()
+		if !errors.Is(err, expected) {
+			t.Log(input, err)
+			t.FailNow()
+		}
+	}
+
+	// the relaxed syntax is rejected by default
+	sm := tokenizer.NewTokenizerStateMachineFromIOReader(strings.NewReader(`{a: 1}`))
+	if sm.ProcessData() == nil {
+		t.FailNow()
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	strict := []astbuilder.TokenProviderOptions{bytebase.EnableStrictMode}
+	valid := []string{`[0, -0.5e+3, 10]`, `["\ud83d\ude00 \u00e9 \/ \n"]`, "{\"${?x}a\": ${v}, \"b\": \"${y}\"}\r\n"}
+	for _, input := range valid {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), strict)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		err = sm.ProcessData()
+		if err != nil {
+			t.Log(input, err)
+			t.FailNow()
+		}
+	}
+
+	type invalidCase struct {
+		err    error
+		column int
+	}
+	invalid := map[string]invalidCase{
+		`{"a": 1 ,}`:   {bytebase.ErrorSyntaxCommaBehindLastItem, 9},
+		`[-01.5]`:      {bytebase.ErrorStrictLeadingZero, 3},
+		`[1.]`:         {bytebase.ErrorStrictNumberFormat, 4},
+		`["a\q"]`:      {bytebase.ErrorStrictInvalidEscape, 4},
+		`["ab\ud800"]`: {bytebase.ErrorStrictLoneSurrogate, 5},
+		`["\ude00"]`:   {bytebase.ErrorStrictLoneSurrogate, 3},
+		"[\"a\tb\"]":   {bytebase.ErrorStrictControlCharacter, 4},
+		`{"a": 1} {}`:  {bytebase.ErrorStrictTrailingContent, 10},
+		"[1,\v2]":      {bytebase.ErrorIncorrectCharacter, 4},
+	}
+	for input, expected := range invalid {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), strict)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		err = sm.ProcessData()
+		var positionError *token.PositionError
+		if !errors.Is(err, expected.err) || !errors.As(err, &positionError) || positionError.Position.Column != expected.column {
+			t.Log(input, err)
+			t.FailNow()
+		}
+	}
+
+	_, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(`1`), []astbuilder.TokenProviderOptions{bytebase.EnableRelaxedMode, bytebase.EnableStrictMode})
+	if err != bytebase.ErrorRelaxedAndStrictMode {
+		t.Log(err)
+		t.FailNow()
+	}
+}
+
+func TestLongString(t *testing.T) {
+	long := strings.Repeat("a\\\"", 3000)
+	sm := tokenizer.NewTokenizerStateMachineFromIOReader(strings.NewReader(`["` + long + `", 1]`))
+	err := sm.ProcessData()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	rs, err := interpreter.InterpretAST(sm.GetAST(), nil, nil)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if string(rs) != `["`+long+`",1]` {
+		t.FailNow()
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := bytebase.Limits{MaxDepth: 3, MaxDocumentSize: 64, MaxStringLength: 8, MaxArrayLength: 4}
+	options := []astbuilder.TokenProviderOptions{bytebase.WithLimits(limits)}
+	testCases := map[string]error{
+		`{"a": [[1, 2, 3, 4], "12345678", ${abcdefgh}]}`: nil,
+		`[[[[1]]]]`:                          bytebase.ErrorLimitDepth,
+		`{"a": {"b": [{}]}}`:                 bytebase.ErrorLimitDepth,
+		`[1, 2, 3, 4, 5]`:                    bytebase.ErrorLimitArrayLength,
+		`{"123456789": 1}`:                   bytebase.ErrorLimitStringLength,
+		`[${abcdefghi}]`:                     bytebase.ErrorLimitStringLength,
+		`"` + strings.Repeat(" ", 70):        bytebase.ErrorLimitDocumentSize,
+		`[1` + strings.Repeat(" ", 70) + `]`: bytebase.ErrorLimitDocumentSize,
+	}
+	for input, expected := range testCases {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), options)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		err = sm.ProcessData()
+		if expected == nil {
+			if err != nil {
+				t.Log(input, err)
+				t.FailNow()
+			}
+			continue
+		}
+		var limitError *bytebase.LimitError
+		if !errors.Is(err, expected) || !errors.As(err, &limitError) {
+			t.Log(input, err)
+			t.FailNow()
+		}
+	}
+
+	// the elements are counted, not the commas
+	relaxed := []astbuilder.TokenProviderOptions{bytebase.EnableRelaxedMode, bytebase.WithLimits(bytebase.Limits{MaxArrayLength: 4})}
+	for input, expected := range map[string]error{
+		`[1, 2, 3, 4,]`:                     nil,
+		`[true, null, ${a}, {"k": [1, 2]}]`: nil,
+		`['a', +1, .5, [],]`:                nil,
+		`['a', +1, .5, [], 'b']`:            bytebase.ErrorLimitArrayLength,
+	} {
+		sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(input), relaxed)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if err = sm.ProcessData(); !errors.Is(err, expected) {
+			t.Log(input, err)
+			t.FailNow()
+		}
+	}
+
+	// the variable is not read to its end before the length is checked
+	sm, err := tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(`[${`+strings.Repeat("a", 1<<16)), []astbuilder.TokenProviderOptions{bytebase.WithLimits(bytebase.Limits{MaxStringLength: 8})})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err = sm.ProcessData(); !errors.Is(err, bytebase.ErrorLimitStringLength) {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	_, err = tokenizer.NewTokenizerStateMachineFromIOReaderWithOptions(strings.NewReader(`1`), []astbuilder.TokenProviderOptions{bytebase.WithLimits(bytebase.Limits{MaxDepth: -1})})
+	if err != bytebase.ErrorLimitNegative {
+		t.Log(err)
+		t.FailNow()
+	}
+}
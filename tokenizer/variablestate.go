@@ -21,7 +21,7 @@ func (i *VariableState) ProcessData(provider astbuilder.TokenProvider) error {
 	if err != nil {
 		return err
 	}
-	if !util.RegStringWithVariable.Match(variable) {
+	if !util.IsExtendedVariable(variable) {
 		return ErrorExtendedVariableFormatIncorrect
 	}
 
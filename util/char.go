@@ -4,10 +4,120 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
-var RegStringWithVariable regexp.Regexp = *regexp.MustCompile(`\$\{([a-zA-Z\_]+\w*?)\}`)
+// `${name}` or `${name.field.0}`, the dotted form reaches into the fields/entries/elements of a variable
+var RegStringWithVariable regexp.Regexp = *regexp.MustCompile(`\$\{([a-zA-Z\_]\w*(?:\.\w+)*)\}`)
+
+// `${...name}` splices the entries of a map/slice variable into the enclosing object/array
+var RegSpreadVariable regexp.Regexp = *regexp.MustCompile(`^\$\{\.\.\.([a-zA-Z\_]\w*(?:\.\w+)*)\}$`)
+
+// `"${?name}key"` or `"${?!name}key"`, the object member is only kept when the variable is truthy (falsy for `?!`)
+var RegConditionPrefix regexp.Regexp = *regexp.MustCompile(`^\$\{\?(!?)([a-zA-Z\_]\w*(?:\.\w+)*)\}`)
+
+// `item in ${items}`, the clause of a `$for` loop
+var RegLoopClause regexp.Regexp = *regexp.MustCompile(`^\s*([a-zA-Z\_]\w*)\s+in\s+\$\{([a-zA-Z\_]\w*(?:\.\w+)*)\}\s*$`)
+
+// `${include:path/to/fragment.jsonx}` is replaced by the document at the path
+var RegIncludeVariable regexp.Regexp = *regexp.MustCompile(`^\$\{include:([^\s\{\}]+)\}$`)
+
+// a string with variables split at the variables, e.g. `https://${host}/api` is the literals `https://` and `/api`
+// around the variable host. the literals are one more than the names, a name repeats when the variable does.
+type StringTemplate struct {
+	literals []string
+	names    []string
+}
+
+func NewStringTemplate(template string) *StringTemplate {
+	locations := RegStringWithVariable.FindAllStringSubmatchIndex(template, -1)
+	rs := &StringTemplate{literals: make([]string, 0, len(locations)+1), names: make([]string, 0, len(locations))}
+	last := 0
+	for _, location := range locations {
+		rs.literals = append(rs.literals, template[last:location[0]])
+		rs.names = append(rs.names, template[location[2]:location[3]])
+		last = location[1]
+	}
+	rs.literals = append(rs.literals, template[last:])
+	return rs
+}
+
+// template -> *StringTemplate
+var stringTemplateCache sync.Map
+
+// the template split once, shared by all the values matched against it
+func GetStringTemplate(template string) *StringTemplate {
+	if rs, ok := stringTemplateCache.Load(template); ok {
+		return rs.(*StringTemplate)
+	}
+	actual, _ := stringTemplateCache.LoadOrStore(template, NewStringTemplate(template))
+	return actual.(*StringTemplate)
+}
+
+// the values of the variables of the template, e.g. `https://${host}/api` and `https://example.com/api` give host
+// `example.com`. a variable takes the shortest text that lets the rest match, a variable repeated in the template
+// takes the same text each time, so `${a}-${a}` and `x-y-x-y` give a `x-y`. false when the value does not match.
+func MatchStringTemplate(template string, value string) (map[string]string, bool) {
+	return GetStringTemplate(template).Match(value)
+}
+
+func (s *StringTemplate) Match(value string) (map[string]string, bool) {
+	if !strings.HasPrefix(value, s.literals[0]) {
+		return nil, false
+	}
+	rs := make(map[string]string, len(s.names))
+	if !s.match(value, len(s.literals[0]), 0, rs) {
+		return nil, false
+	}
+	return rs, true
+}
+
+// match the variables from the i-th on against value[pos:], backtracking to the next place the literal after the
+// variable is found when the rest does not match
+func (s *StringTemplate) match(value string, pos int, i int, rs map[string]string) bool {
+	if i == len(s.names) {
+		return pos == len(value)
+	}
+	name, literal := s.names[i], s.literals[i+1]
+	if bound, ok := rs[name]; ok {
+		if !strings.HasPrefix(value[pos:], bound+literal) {
+			return false
+		}
+		return s.match(value, pos+len(bound)+len(literal), i+1, rs)
+	}
+	if i == len(s.names)-1 {
+		if !strings.HasSuffix(value[pos:], literal) {
+			return false
+		}
+		rs[name] = value[pos : len(value)-len(literal)]
+		return true
+	}
+	for end := pos; end <= len(value); {
+		found := strings.Index(value[end:], literal)
+		if found < 0 {
+			break
+		}
+		end += found
+		rs[name] = value[pos:end]
+		if s.match(value, end+len(literal), i+1, rs) {
+			return true
+		}
+		delete(rs, name)
+		_, size := utf8.DecodeRuneInString(value[end:])
+		if size == 0 {
+			break
+		}
+		end += size
+	}
+	return false
+}
+
+// a variable token is a plain variable `${name}`, a spread variable `${...name}` or an include `${include:path}`
+func IsExtendedVariable(b []byte) bool {
+	return RegStringWithVariable.Match(b) || RegSpreadVariable.Match(b) || RegIncludeVariable.Match(b)
+}
 
 func IsSpaces(b byte) bool {
 	return b == 0x20 || (b < 0x0E && b > 0x08)
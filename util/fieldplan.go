@@ -0,0 +1,131 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// the json settings of a struct field, they are the same for all values of the struct type
+type fieldPlan struct {
+	name string
+	// path from the struct to the field through the embedded structs, for reflect.Value.FieldByIndex
+	index     []int
+	jsonTag   *JsonTagOptions
+	extendTag *JsonExtendOptions
+}
+
+// the fields of a struct or an embedded struct, in the order the flatten functions check them:
+// the fields with a json key name in the tag first, the others after, both from the last field to the first
+type structLevelPlan struct {
+	tagged   []*fieldPlan
+	untagged []*fieldPlan
+}
+
+// the levels are in the order of the walk through the embedded structs
+type structPlan struct {
+	levels []*structLevelPlan
+	// the result of FlattenJsonStructForUnmarshal does not depend on the value
+	unmarshalFields []*fieldPlan
+}
+
+// reflect.Type -> *structPlan, shared by the marshaller and the unmarshaller
+var structPlanCache sync.Map
+
+func getStructPlan(t reflect.Type) *structPlan {
+	if plan, ok := structPlanCache.Load(t); ok {
+		return plan.(*structPlan)
+	}
+	plan := newStructPlan(t)
+	actual, _ := structPlanCache.LoadOrStore(t, plan)
+	return actual.(*structPlan)
+}
+
+func newStructPlan(t reflect.Type) *structPlan {
+	type levelItem struct {
+		t     reflect.Type
+		index []int
+	}
+	plan := &structPlan{}
+	s := NewStack[levelItem]()
+	s.Push(levelItem{t: t})
+	for {
+		item, err := s.Pop()
+		if err != nil {
+			break
+		}
+		level := &structLevelPlan{}
+		for i := item.t.NumField() - 1; i >= 0; i -= 1 {
+			field := item.t.Field(i)
+			index := append(append(make([]int, 0, len(item.index)+1), item.index...), i)
+			// 0. Anonymous, next level to check
+			if field.Anonymous {
+				if field.Type.Kind() == reflect.Struct {
+					s.Push(levelItem{t: field.Type, index: index})
+				}
+				continue
+			}
+			// 1. skip none exported
+			if !field.IsExported() {
+				continue
+			}
+			jsonTag, ok := field.Tag.Lookup("json")
+			// 2. drop when the field is marked with `-`
+			if ok && jsonTag == "-" {
+				continue
+			}
+			// 3. no json tag or json tag without json key name, lower the precedent
+			if !ok || strings.HasPrefix(jsonTag, ",") {
+				untagged := &fieldPlan{name: field.Name, index: index, extendTag: getExtensionTags(field)}
+				if ok {
+					untagged.jsonTag = GetFieldNameAndOptions(jsonTag)
+				}
+				level.untagged = append(level.untagged, untagged)
+				continue
+			}
+			tagConfig := GetFieldNameAndOptions(jsonTag)
+			level.tagged = append(level.tagged, &fieldPlan{name: tagConfig.fieldName, index: index, jsonTag: tagConfig, extendTag: getExtensionTags(field)})
+		}
+		plan.levels = append(plan.levels, level)
+	}
+	plan.unmarshalFields = plan.resolveUnmarshalFields()
+	return plan
+}
+
+func (plan *structPlan) resolveUnmarshalFields() []*fieldPlan {
+	flattenFields := make(map[string]*fieldPlan)
+	order := make([]string, 0)
+	for _, level := range plan.levels {
+		jsonTagFields := make(map[string]bool)
+		for _, field := range level.tagged {
+			// check same level key collision
+			if createFromHere, ok := jsonTagFields[field.name]; !ok {
+				jsonTagFields[field.name] = false
+				// no collision with upper level, create and mark createFromHere, otherwise upper level take precedent, do nothing
+				if _, ok := flattenFields[field.name]; !ok {
+					jsonTagFields[field.name] = true
+					flattenFields[field.name] = field
+					order = append(order, field.name)
+				}
+			} else if createFromHere {
+				// collision occurs, and we have created value into the `flattenFields`, removed them
+				delete(flattenFields, field.name)
+			}
+		}
+		// check if any of none json tag field would conflict with json tag fields, if not add them in
+		for _, field := range level.untagged {
+			if _, ok := flattenFields[field.name]; !ok {
+				flattenFields[field.name] = field
+				order = append(order, field.name)
+			}
+		}
+	}
+	rs := make([]*fieldPlan, 0, len(flattenFields))
+	for _, name := range order {
+		if field, ok := flattenFields[name]; ok {
+			rs = append(rs, field)
+			delete(flattenFields, name)
+		}
+	}
+	return rs
+}
@@ -1,10 +1,13 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jaksonlin/go-jsonextend/token"
 )
@@ -68,6 +71,31 @@ type JsonTagOptions struct {
 type JsonExtendOptions struct {
 	FieldVariableKeyName   string
 	FieldVariableValueName string
+	FieldStringTemplate    string // the value is a string with variables, `jsonext:"s=https://${host}/api"`, the rest of the tag
+	TimeLayout             string // the layout of a time.Time field, `jsonext:"time=2006-01-02"` or a name like `time=RFC1123`
+}
+
+// the layouts of the time package that can be named in `jsonext:"time=..."`, e.g. for the ones with a comma
+var timeLayouts = map[string]string{
+	"Layout":      time.Layout,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
 }
 
 func GetFieldNameAndOptions(jsonTag string) *JsonTagOptions {
@@ -96,24 +124,39 @@ func getExtensionTags(field reflect.StructField) *JsonExtendOptions {
 	if !ok {
 		return nil
 	}
-	matches := extendTagPattern.FindAllStringSubmatch(tag, -1)
-	if len(matches) == 0 {
-		return nil
-	}
 	ret := &JsonExtendOptions{}
-	for _, match := range matches {
-		kv := strings.Split(match[1], "=")
-		if len(kv) != 2 {
+	// the string template is the rest of the tag, it can have commas
+	for rest, more := tag, true; more; {
+		var item string
+		item, rest, more = strings.Cut(rest, ",")
+		if template, ok := strings.CutPrefix(strings.TrimSpace(item), "s="); ok {
+			if more {
+				template += "," + rest
+			}
+			ret.FieldStringTemplate = template
+			break
+		}
+		// the layout is not a word, it is the rest of its comma separated item
+		if layout, ok := strings.CutPrefix(strings.TrimSpace(item), "time="); ok {
+			if named, ok := timeLayouts[layout]; ok {
+				layout = named
+			}
+			ret.TimeLayout = layout
 			continue
 		}
-		if kv[0] == "k" {
-			ret.FieldVariableKeyName = kv[1]
-		} else if kv[0] == "v" {
-			ret.FieldVariableValueName = kv[1]
+		for _, match := range extendTagPattern.FindAllStringSubmatch(item, -1) {
+			kv := strings.Split(match[1], "=")
+			if len(kv) != 2 {
+				continue
+			}
+			if kv[0] == "k" {
+				ret.FieldVariableKeyName = kv[1]
+			} else if kv[0] == "v" {
+				ret.FieldVariableValueName = kv[1]
+			}
 		}
-
 	}
-	if len(ret.FieldVariableKeyName) == 0 && len(ret.FieldVariableValueName) == 0 {
+	if len(ret.FieldVariableKeyName) == 0 && len(ret.FieldVariableValueName) == 0 && len(ret.FieldStringTemplate) == 0 && len(ret.TimeLayout) == 0 {
 		return nil
 	}
 	return ret
@@ -126,92 +169,16 @@ func FlattenJsonStructForUnmarshal(workItem reflect.Value) map[string]*JSONStruc
 	if workItem.Kind() != reflect.Struct {
 		return nil
 	}
-	s := NewStack[reflect.Value]()
-	s.Push(workItem)
-	var flattenFields map[string]*JSONStructField = make(map[string]*JSONStructField)
-	for {
-		item, err := s.Pop()
-		if err != nil {
-			break
-		}
-		var jsonTagFields map[string]bool = make(map[string]bool)
-		var noneJsonTagFields []int
-		// json field goes first
-		for i := item.NumField() - 1; i >= 0; i -= 1 {
-			field := item.Type().Field(i)
-			// 0. Anonymous, next level to check
-			if field.Anonymous {
-				s.Push(item.Field(i))
-				continue
-			}
-			// 1. skip none exported
-			if !field.IsExported() {
-				continue
-			}
-			jsonTag, ok := field.Tag.Lookup("json")
-			// 2. mark location for none json tag fields
-			if !ok {
-				noneJsonTagFields = append(noneJsonTagFields, i)
-				continue
-			}
-			if jsonTag == "-" {
-				continue
-			}
-			// 3. json tag without json key name, lower the precedent
-			if strings.HasPrefix(jsonTag, ",") {
-				// json tag without json key name, lower the precedent
-				// when a field name colllison with json tag name, the field will be dropped
-				noneJsonTagFields = append(noneJsonTagFields, i)
-				continue
-			}
-			tagConfig := GetFieldNameAndOptions(jsonTag)
-			extendTag := getExtensionTags(field)
-			fieldValue := item.Field(i)
-
-			// 4. check same level key collision
-			if createFromHere, ok := jsonTagFields[tagConfig.fieldName]; !ok {
-				jsonTagFields[tagConfig.fieldName] = false
-				// 4.1 no collision with upper level, create and mark createFromHere, otherwise upper level take precedent, do nothing
-				if _, ok := flattenFields[tagConfig.fieldName]; !ok {
-					jsonTagFields[tagConfig.fieldName] = true
-					flattenFields[tagConfig.fieldName] = &JSONStructField{
-						FieldName:    tagConfig.fieldName,
-						FieldValue:   fieldValue,
-						FieldJsonTag: tagConfig,
-						ExtendTag:    extendTag,
-					}
-				}
-			} else {
-				// 4.2 collision occurs, and we have created value into the `flattenFields`, removed them
-				if createFromHere {
-					delete(flattenFields, tagConfig.fieldName)
-				}
-			}
-		}
-		// 5. check if any of none json tag field would conflict with json tag fields, if not add them in
-		for _, noneJsonfieldIndex := range noneJsonTagFields {
-			field := item.Type().Field(noneJsonfieldIndex)
-			if _, ok := flattenFields[field.Name]; !ok {
-				fieldValue := item.Field(noneJsonfieldIndex)
-				result := &JSONStructField{
-					FieldName:    field.Name,
-					FieldValue:   fieldValue,
-					FieldJsonTag: nil,
-				}
-				jsonTag, ok := field.Tag.Lookup("json")
-
-				if ok {
-					// no json tag field name but have option
-					tagConfig := GetFieldNameAndOptions(jsonTag)
-					result.FieldJsonTag = tagConfig
-				}
-				extendTag := getExtensionTags(field)
-				result.ExtendTag = extendTag
-				flattenFields[field.Name] = result
-			}
+	plan := getStructPlan(workItem.Type())
+	flattenFields := make(map[string]*JSONStructField, len(plan.unmarshalFields))
+	for _, field := range plan.unmarshalFields {
+		flattenFields[field.name] = &JSONStructField{
+			FieldName:    field.name,
+			FieldValue:   workItem.FieldByIndex(field.index),
+			FieldJsonTag: field.jsonTag,
+			ExtendTag:    field.extendTag,
 		}
 	}
-
 	return flattenFields
 }
 
@@ -253,100 +220,55 @@ func FlattenJsonStructForMarshal(workItem reflect.Value) []*JSONStructField {
 	if workItem.Kind() != reflect.Struct {
 		return nil
 	}
-	s := NewStack[reflect.Value]()
-	s.Push(workItem)
+	plan := getStructPlan(workItem.Type())
 	var flattenFieldsState map[string]int = make(map[string]int)
 	var flattenFields []*JSONStructField = make([]*JSONStructField, 0)
 
-	for {
-		item, err := s.Pop()
-		if err != nil {
-			break
-		}
+	for _, level := range plan.levels {
 		var jsonTagFields map[string]bool = make(map[string]bool)
-		var noneJsonTagFields []int
-		// json field goes first
-		for i := item.NumField() - 1; i >= 0; i -= 1 {
-			field := item.Type().Field(i)
-			// 0. Anonymous, next level to check
-			if field.Anonymous {
-				s.Push(item.Field(i))
-				continue
-			}
-			// 1. skip none exported
-			if !field.IsExported() {
-				continue
-			}
-			jsonTag, ok := field.Tag.Lookup("json")
-			// 2. mark location for none json tag fields
-			if !ok {
-				noneJsonTagFields = append(noneJsonTagFields, i)
+		for _, field := range level.tagged {
+			// 1. check for omitempty
+			fieldValue := workItem.FieldByIndex(field.index)
+			if shouldDropField(fieldValue, field.jsonTag) {
 				continue
 			}
-			// 2.1 drop when the field is marked with `-`
-			if jsonTag == "-" {
-				continue
-			}
-			// 2.2 for json tag without json key name, lower the precedent
-			if strings.HasPrefix(jsonTag, ",") {
-				// no json key name in json tag, lower the precedent
-				// when a field name colllison with json tag name, the field will be dropped
-				noneJsonTagFields = append(noneJsonTagFields, i)
-				continue
-			}
-			// 2.3 check for omitempty
-			tagConfig := GetFieldNameAndOptions(jsonTag)
-			extendTag := getExtensionTags(field)
-			fieldValue := item.Field(i)
-			if shouldDropField(fieldValue, tagConfig) {
-				continue
-			}
-			// 3. check same level key collision
-			if createFromHere, ok := jsonTagFields[tagConfig.fieldName]; !ok {
-				jsonTagFields[tagConfig.fieldName] = false
-				// 4.1 no collision with upper level, create and mark createFromHere, otherwise upper level take precedent, do nothing
-				if _, ok := flattenFieldsState[tagConfig.fieldName]; !ok {
-					jsonTagFields[tagConfig.fieldName] = true
-					flattenFieldsState[tagConfig.fieldName] = len(flattenFields)
+			// 2. check same level key collision
+			if createFromHere, ok := jsonTagFields[field.name]; !ok {
+				jsonTagFields[field.name] = false
+				// 2.1 no collision with upper level, create and mark createFromHere, otherwise upper level take precedent, do nothing
+				if _, ok := flattenFieldsState[field.name]; !ok {
+					jsonTagFields[field.name] = true
+					flattenFieldsState[field.name] = len(flattenFields)
 					flattenFields = append(flattenFields, &JSONStructField{
-						FieldName:    tagConfig.fieldName,
+						FieldName:    field.name,
 						FieldValue:   fieldValue,
-						FieldJsonTag: tagConfig,
-						ExtendTag:    extendTag,
+						FieldJsonTag: field.jsonTag,
+						ExtendTag:    field.extendTag,
 					})
 				}
 			} else {
-				// 4.2 collision occurs, and we have created value into the `flattenFields`, removed them
+				// 2.2 collision occurs, and we have created value into the `flattenFields`, removed them
 				if createFromHere {
-					index := flattenFieldsState[tagConfig.fieldName]
+					index := flattenFieldsState[field.name]
 					flattenFields = append(flattenFields[:index], flattenFields[index+1:]...)
 				}
 			}
 		}
-		// 5. check if any of none json tag field would conflict with json tag fields, if not add them in
-		for _, noneJsonfieldIndex := range noneJsonTagFields {
-			field := item.Type().Field(noneJsonfieldIndex)
-			if _, ok := flattenFieldsState[field.Name]; !ok {
-				flattenFieldsState[field.Name] = len(flattenFields)
-				FieldValue := item.Field(noneJsonfieldIndex)
-				result := &JSONStructField{
-					FieldName:    field.Name,
-					FieldValue:   FieldValue,
-					FieldJsonTag: nil,
-				}
-				jsonTag, ok := field.Tag.Lookup("json")
-				if ok {
-					// no json tag field name but have option
-					tagConfig := GetFieldNameAndOptions(jsonTag)
-					// check for omitempty
-					if shouldDropField(FieldValue, tagConfig) {
-						continue
-					}
-					result.FieldJsonTag = tagConfig
+		// 3. check if any of none json tag field would conflict with json tag fields, if not add them in
+		for _, field := range level.untagged {
+			if _, ok := flattenFieldsState[field.name]; !ok {
+				flattenFieldsState[field.name] = len(flattenFields)
+				fieldValue := workItem.FieldByIndex(field.index)
+				// check for omitempty
+				if shouldDropField(fieldValue, field.jsonTag) {
+					continue
 				}
-				extendTag := getExtensionTags(field)
-				result.ExtendTag = extendTag
-				flattenFields = append(flattenFields, result)
+				flattenFields = append(flattenFields, &JSONStructField{
+					FieldName:    field.name,
+					FieldValue:   fieldValue,
+					FieldJsonTag: field.jsonTag,
+					ExtendTag:    field.extendTag,
+				})
 			}
 		}
 	}
@@ -370,6 +292,8 @@ func EncodePrimitiveValue(v interface{}) ([]byte, error) {
 		return token.NullBytes, nil
 	}
 	switch data := v.(type) {
+	case json.Number:
+		return []byte(data), nil
 	case string:
 		return EncodeToJsonString(data), nil
 	case float32, float64:
@@ -383,15 +307,36 @@ func EncodePrimitiveValue(v interface{}) ([]byte, error) {
 		return token.FalseBytes, nil
 	case nil:
 		return token.NullBytes, nil
-	case interface{}:
-		return EncodePrimitiveValue(data)
 	default:
+		// named types, e.g. time.Duration, are encoded by their kind
+		value := reflect.ValueOf(data)
+		for value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return token.NullBytes, nil
+			}
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.String:
+			return EncodePrimitiveValue(value.String())
+		case reflect.Float32, reflect.Float64:
+			return EncodePrimitiveValue(value.Float())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return EncodePrimitiveValue(value.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return EncodePrimitiveValue(value.Uint())
+		case reflect.Bool:
+			return EncodePrimitiveValue(value.Bool())
+		}
 		return nil, ErrorVariableDataKind
 	}
 }
 
 // json input value is always float64, convert to different numeric value based on out element kind
 func ConvertInterfaceNumberToFloat64(val interface{}) (float64, error) {
+	if number, ok := val.(json.Number); ok {
+		return number.Float64()
+	}
 
 	value := reflect.ValueOf(val)
 	if !value.IsValid() {
@@ -418,6 +363,9 @@ func ConvertInterfaceNumberToFloat64(val interface{}) (float64, error) {
 }
 
 func ConvertInterfaceNumberToInt64(val interface{}) (int64, error) {
+	if number, ok := val.(json.Number); ok {
+		return number.Int64()
+	}
 	value := reflect.ValueOf(val)
 	if !value.IsValid() {
 		return 0, ErrorInputNil
@@ -441,3 +389,41 @@ func ConvertInterfaceNumberToInt64(val interface{}) (int64, error) {
 	i64Value := value.Convert(i64Type)
 	return i64Value.Int(), nil
 }
+
+// walk into value along path, each step is a json field name of a struct, a key of a map or an index of a slice/array
+func LookupPath(value interface{}, path []string) (interface{}, bool) {
+	current := reflect.ValueOf(value)
+	for _, step := range path {
+		for current.IsValid() && (current.Kind() == reflect.Pointer || current.Kind() == reflect.Interface) {
+			current = current.Elem()
+		}
+		if !current.IsValid() {
+			return nil, false
+		}
+		switch current.Kind() {
+		case reflect.Struct:
+			field, ok := FlattenJsonStructForUnmarshal(current)[step]
+			if !ok {
+				return nil, false
+			}
+			current = field.FieldValue
+		case reflect.Map:
+			if current.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			current = current.MapIndex(reflect.ValueOf(step).Convert(current.Type().Key()))
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(step)
+			if err != nil || index < 0 || index >= current.Len() {
+				return nil, false
+			}
+			current = current.Index(index)
+		default:
+			return nil, false
+		}
+	}
+	if !current.IsValid() || !current.CanInterface() {
+		return nil, false
+	}
+	return current.Interface(), true
+}
@@ -24,7 +24,7 @@ func (s *Stack[T]) Clear() {
 }
 
 func (s *Stack[T]) Clone() *Stack[T] {
-	return &Stack[T]{s.s}
+	return &Stack[T]{append(make([]T, 0, len(s.s)), s.s...)}
 }
 
 func (s *Stack[T]) Get(i int) (T, error) {
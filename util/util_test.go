@@ -2,8 +2,11 @@ package util
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -25,3 +28,139 @@ func TestRemoveQuote(t *testing.T) {
 	}
 	fmt.Println(f)
 }
+
+func TestLookupPath(t *testing.T) {
+	type service struct {
+		Name  string `json:"name"`
+		Ports []int
+	}
+	data := map[string]interface{}{"svc": &service{Name: "web", Ports: []int{80, 443}}}
+	value, ok := LookupPath(data, []string{"svc", "name"})
+	if !ok || value != "web" {
+		t.FailNow()
+	}
+	value, ok = LookupPath(data, []string{"svc", "Ports", "1"})
+	if !ok || value != 443 {
+		t.FailNow()
+	}
+	_, ok = LookupPath(data, []string{"svc", "Ports", "2"})
+	if ok {
+		t.FailNow()
+	}
+}
+
+type planEmbedded struct {
+	ID    int    `json:"id"`
+	Label string `json:"name"` // shadowed by the outer name
+}
+
+type planStruct struct {
+	planEmbedded
+	Name    string `json:"name"`
+	Note    string `json:"note,omitempty"`
+	Plain   int
+	Options string `json:",omitempty" jsonext:"k=key,v=value"`
+	Skip    string `json:"-"`
+	private int
+}
+
+func TestStructPlanCache(t *testing.T) {
+	workItem := reflect.ValueOf(&planStruct{planEmbedded: planEmbedded{ID: 1}, Name: "a", Plain: 2}).Elem()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			FlattenJsonStructForMarshal(workItem)
+			FlattenJsonStructForUnmarshal(workItem)
+		}()
+	}
+	wg.Wait()
+	if getStructPlan(workItem.Type()) != getStructPlan(workItem.Type()) {
+		t.FailNow()
+	}
+
+	names := make([]string, 0)
+	for _, field := range FlattenJsonStructForMarshal(workItem) {
+		names = append(names, field.FieldName)
+	}
+	// Options is dropped by omitempty
+	if strings.Join(names, ",") != "name,Plain,id" {
+		t.Log(names)
+		t.FailNow()
+	}
+	fields := FlattenJsonStructForUnmarshal(workItem)
+	if len(fields) != 5 || fields["id"].FieldValue.Int() != 1 || !fields["id"].FieldValue.CanSet() {
+		t.Log(fields)
+		t.FailNow()
+	}
+	if fields["Options"].ExtendTag == nil || fields["Options"].ExtendTag.FieldVariableKeyName != "key" || !fields["note"].FieldJsonTag.Omitempty {
+		t.FailNow()
+	}
+}
+
+func BenchmarkFlattenJsonStructForMarshal(b *testing.B) {
+	workItem := reflect.ValueOf(planStruct{Name: "a", Note: "b"})
+	for i := 0; i < b.N; i++ {
+		FlattenJsonStructForMarshal(workItem)
+	}
+}
+
+func TestStackClone(t *testing.T) {
+	s := NewStack[int]()
+	s.PushElements([]int{1, 2})
+	clone := s.Clone()
+	clone.Pop()
+	clone.Push(3)
+	if v, _ := s.Peek(); v != 2 || s.Length() != 2 {
+		t.Log("the clone shares the stack with the original")
+		t.FailNow()
+	}
+}
+
+func TestMatchStringTemplate(t *testing.T) {
+	variables, ok := MatchStringTemplate("https://${host}/api/${version}?q=1", "https://example.com/api/v2?q=1")
+	if !ok || variables["host"] != "example.com" || variables["version"] != "v2" {
+		t.Log(variables)
+		t.FailNow()
+	}
+	if _, ok = MatchStringTemplate("https://${host}/api", "http://example.com/api"); ok {
+		t.Log("expect no match")
+		t.FailNow()
+	}
+	if _, ok = MatchStringTemplate("${a}-${a}", "x-y"); ok {
+		t.Log("expect the repeated variable to have one value")
+		t.FailNow()
+	}
+	// the repeated variable takes the text that matches every place it is in
+	if variables, ok = MatchStringTemplate("${a}-${a}", "x-y-x-y"); !ok || len(variables) != 1 || variables["a"] != "x-y" {
+		t.Log(variables, ok)
+		t.FailNow()
+	}
+	if variables, ok = MatchStringTemplate("${a}:${b}:${a}", "1:2:3:1:2"); !ok || variables["a"] != "1:2" || variables["b"] != "3" {
+		t.Log(variables, ok)
+		t.FailNow()
+	}
+	if variables, ok = MatchStringTemplate("# ${title}\n\n${body}.", "# notes\nfirst\n\nline\nlast."); !ok || variables["title"] != "notes\nfirst" || variables["body"] != "line\nlast" {
+		t.Log(variables, ok)
+		t.FailNow()
+	}
+	if variables, ok = MatchStringTemplate("no variables", "no variables"); !ok || len(variables) != 0 {
+		t.Log(variables, ok)
+		t.FailNow()
+	}
+	if GetStringTemplate("${a}-${a}") != GetStringTemplate("${a}-${a}") {
+		t.Log("expect the template to be split once")
+		t.FailNow()
+	}
+	type service struct {
+		URL string `jsonext:"k=address,s=https://${host}/api?a=1,b=2"`
+	}
+	field, _ := reflect.TypeOf(service{}).FieldByName("URL")
+	options := getExtensionTags(field)
+	if options.FieldStringTemplate != "https://${host}/api?a=1,b=2" || options.FieldVariableKeyName != "address" || options.FieldVariableValueName != "" {
+		t.Log(options)
+		t.FailNow()
+	}
+}